@@ -53,6 +53,7 @@ type BootConfigE struct {
 		AutoCreate bool     `yaml:"autoCreate" json:"autoCreate"`
 		Plugins    struct {
 			Prom  plugins.PromConfig  `yaml:"prom"`
+			Cache plugins.CacheConfig `yaml:"cache"`
 			Trace plugins.TraceConfig `yaml:"trace"`
 		} `yaml:"plugins" json:"plugins"`
 	} `yaml:"database" json:"database"`
@@ -290,6 +291,16 @@ func RegisterClickHouseEntryYAML(raw []byte) map[string]rkentry.Entry {
 				prom := plugins.NewProm(&db.Plugins.Prom)
 				opts = append(opts, WithPlugin(db.Name, prom))
 			}
+			if db.Plugins.Cache.Enabled {
+				if len(db.Plugins.Cache.RedisEntry) < 1 {
+					rkentry.ShutdownWithError(fmt.Errorf("redisEntry of cache plugin is required, database:%s", db.Name))
+				}
+				db.Plugins.Cache.DbAddr = element.Addr
+				db.Plugins.Cache.DbName = db.Name
+				db.Plugins.Cache.DbType = "clickhouse"
+				cache := plugins.NewCache(&db.Plugins.Cache)
+				opts = append(opts, WithPlugin(db.Name, cache))
+			}
 		}
 
 		entry := RegisterClickHouseEntry(opts...)
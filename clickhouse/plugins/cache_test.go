@@ -0,0 +1,112 @@
+package plugins
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/clickhouse"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"io"
+	"sync"
+	"testing"
+)
+
+type cacheUser struct {
+	ID   uint `gorm:"primaryKey"`
+	Name string
+}
+
+// fakeConn is a connection of database/sql which returns a user for every query
+type fakeConn struct {
+	rowsAffected int64
+	queries      int
+	mutex        sync.Mutex
+}
+
+func (c *fakeConn) Connect(context.Context) (driver.Conn, error) { return c, nil }
+func (c *fakeConn) Driver() driver.Driver                        { return c }
+func (c *fakeConn) Open(string) (driver.Conn, error)             { return c, nil }
+func (c *fakeConn) Close() error                                 { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error)                    { return c, nil }
+func (c *fakeConn) Commit() error                                { return nil }
+func (c *fakeConn) Rollback() error                              { return nil }
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) {
+	return nil, driver.ErrSkip
+}
+
+func (c *fakeConn) ExecContext(context.Context, string, []driver.NamedValue) (driver.Result, error) {
+	return driver.RowsAffected(c.rowsAffected), nil
+}
+
+func (c *fakeConn) QueryContext(context.Context, string, []driver.NamedValue) (driver.Rows, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.queries++
+
+	return &fakeRows{}, nil
+}
+
+func (c *fakeConn) count() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.queries
+}
+
+type fakeRows struct {
+	done bool
+}
+
+func (r *fakeRows) Columns() []string { return []string{"id", "name"} }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0], dest[1] = int64(1), "ut"
+	return nil
+}
+
+func TestCache_WithDialector(t *testing.T) {
+	conn := &fakeConn{rowsAffected: 0}
+	db, err := gorm.Open(clickhouse.New(clickhouse.Config{Conn: sql.OpenDB(conn), SkipInitializeWithVersion: true}), &gorm.Config{Logger: logger.Discard})
+	assert.Nil(t, err)
+
+	server := miniredis.RunT(t)
+	assert.Nil(t, db.Use(NewCache(&CacheConfig{Client: redis.NewClient(&redis.Options{Addr: server.Addr()})})))
+
+	// sql.DB is still accessible with wrapped pool
+	sqlDB, err := db.DB()
+	assert.Nil(t, err)
+	assert.NotNil(t, sqlDB)
+
+	ctx := WithQueryCache(context.TODO())
+	find := func() {
+		users := make([]*cacheUser, 0)
+		assert.Nil(t, db.WithContext(ctx).Find(&users).Error)
+		assert.Equal(t, []*cacheUser{{ID: 1, Name: "ut"}}, users)
+	}
+
+	// served by cache at the second time
+	find()
+	find()
+	assert.Equal(t, 1, conn.count())
+
+	// invalidated by update, mutations of clickhouse report no affected rows
+	assert.Nil(t, db.Model(&cacheUser{}).Where("id = ?", 1).Update("name", "updated").Error)
+	find()
+	assert.Equal(t, 2, conn.count())
+
+	// invalidated by delete in transaction
+	assert.Nil(t, db.Transaction(func(tx *gorm.DB) error {
+		return tx.Delete(&cacheUser{}, 1).Error
+	}))
+	find()
+	assert.Equal(t, 3, conn.count())
+}
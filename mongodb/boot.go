@@ -9,12 +9,23 @@ package rkmongo
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"github.com/rookie-ninja/rk-entry/v2/entry"
+	"github.com/rookie-ninja/rk-logger"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
 	mongoOpt "go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+	"go.mongodb.org/mongo-driver/tag"
 	"go.uber.org/zap"
+	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -56,20 +67,21 @@ type BootMongo struct {
 
 // BootMongoE sub struct for BootConfig
 type BootMongoE struct {
-	Name          string `yaml:"name" json:"name"`
-	Enabled       bool   `yaml:"enabled" json:"enabled"`
-	Description   string `yaml:"description" json:"description"`
-	Domain        string `yaml:"domain" json:"domain"`
-	SimpleURI     string `yaml:"simpleURI" json:"simpleURI"`
-	PingTimeoutMs int    `yaml:"pingTimeoutMs" json:"pingTimeoutMs"`
-	Database      []struct {
-		Name string `yaml:"name" json:"name"`
-	}
-	LoggerEntry        string  `yaml:"loggerEntry" json:"loggerEntry"`
-	CertEntry          string  `yaml:"certEntry" json:"certEntry"`
-	InsecureSkipVerify bool    `yaml:"insecureSkipVerify" json:"insecureSkipVerify"`
-	AppName            *string `yaml:"appName" json:"appName"`
-	Auth               *struct {
+	Name                   string               `yaml:"name" json:"name"`
+	Enabled                bool                 `yaml:"enabled" json:"enabled"`
+	Description            string               `yaml:"description" json:"description"`
+	Domain                 string               `yaml:"domain" json:"domain"`
+	SimpleURI              string               `yaml:"simpleURI" json:"simpleURI"`
+	PingTimeoutMs          int                  `yaml:"pingTimeoutMs" json:"pingTimeoutMs"`
+	MigrationLockTimeoutMs int                  `yaml:"migrationLockTimeoutMs" json:"migrationLockTimeoutMs"`
+	Database               []*BootMongoDatabase `yaml:"database" json:"database"`
+	LoggerEntry            string               `yaml:"loggerEntry" json:"loggerEntry"`
+	CertEntry              string               `yaml:"certEntry" json:"certEntry"`
+	InsecureSkipVerify     bool                 `yaml:"insecureSkipVerify" json:"insecureSkipVerify"`
+	TLSCAFile              string               `yaml:"tlsCAFile" json:"tlsCAFile"`
+	ServerName             string               `yaml:"serverName" json:"serverName"`
+	AppName                *string              `yaml:"appName" json:"appName"`
+	Auth                   *struct {
 		Mechanism           string            `yaml:"mechanism" json:"mechanism"`
 		MechanismProperties map[string]string `yaml:"mechanismProperties" json:"mechanismProperties"`
 		Source              string            `yaml:"source" json:"source"`
@@ -103,6 +115,151 @@ type BootMongoE struct {
 	SRVServiceName           *string `yaml:"srvServiceName" json:"srvServiceName"`
 	ZlibLevel                *int    `yaml:"zlibLevel" json:"zlibLevel"`
 	ZstdLevel                *int    `yaml:"zstdLevel" json:"zstdLevel"`
+	Transaction              struct {
+		MaxRetries        int `yaml:"maxRetries" json:"maxRetries"`
+		MinRetryBackoffMs int `yaml:"minRetryBackoffMs" json:"minRetryBackoffMs"`
+		MaxRetryBackoffMs int `yaml:"maxRetryBackoffMs" json:"maxRetryBackoffMs"`
+	} `yaml:"transaction" json:"transaction"`
+	ChangeStream struct {
+		TokenDatabase     string `yaml:"tokenDatabase" json:"tokenDatabase"`
+		TokenCollection   string `yaml:"tokenCollection" json:"tokenCollection"`
+		MinRetryBackoffMs int    `yaml:"minRetryBackoffMs" json:"minRetryBackoffMs"`
+		MaxRetryBackoffMs int    `yaml:"maxRetryBackoffMs" json:"maxRetryBackoffMs"`
+	} `yaml:"changeStream" json:"changeStream"`
+	Logger struct {
+		Level           string   `yaml:"level" json:"level"`
+		Encoding        string   `yaml:"encoding" json:"encoding"`
+		OutputPaths     []string `yaml:"outputPaths" json:"outputPaths"`
+		SlowThresholdMs int      `yaml:"slowThresholdMs" json:"slowThresholdMs"`
+	} `yaml:"logger" json:"logger"`
+}
+
+// BootMongoDatabase sub struct of database for BootMongoE
+type BootMongoDatabase struct {
+	Name           string `yaml:"name" json:"name"`
+	Default        bool   `yaml:"default" json:"default"`
+	ReadPreference *struct {
+		Mode           string              `yaml:"mode" json:"mode"`
+		TagSets        []map[string]string `yaml:"tagSets" json:"tagSets"`
+		MaxStalenessMs *int64              `yaml:"maxStalenessMs" json:"maxStalenessMs"`
+	} `yaml:"readPreference" json:"readPreference"`
+	ReadConcern   *string                `yaml:"readConcern" json:"readConcern"`
+	WriteConcern  *BootMongoWriteConcern `yaml:"writeConcern" json:"writeConcern"`
+	Registry      string                 `yaml:"registry" json:"registry"`
+	DryRun        bool                   `yaml:"dryRun" json:"dryRun"`
+	Collections   []*BootMongoCollection `yaml:"collections" json:"collections"`
+	Buckets       []*BootMongoBucket     `yaml:"buckets" json:"buckets"`
+	MigrationPath string                 `yaml:"migrationPath" json:"migrationPath"`
+}
+
+// BootMongoWriteConcern write concern of database and GridFS bucket
+type BootMongoWriteConcern struct {
+	W          string `yaml:"w" json:"w"`
+	J          *bool  `yaml:"j" json:"j"`
+	WTimeoutMs *int64 `yaml:"wtimeoutMs" json:"wtimeoutMs"`
+}
+
+var (
+	bsonRegistryMap   = make(map[string]*bsoncodec.Registry)
+	bsonRegistryMutex sync.RWMutex
+)
+
+// RegisterBsonRegistry register bsoncodec.Registry with name which could be selected by registry of database in YAML.
+// Call it in init() since YAML is parsed before bootstrap.
+func RegisterBsonRegistry(name string, registry *bsoncodec.Registry) {
+	if len(name) < 1 || registry == nil {
+		return
+	}
+
+	bsonRegistryMutex.Lock()
+	defer bsonRegistryMutex.Unlock()
+	bsonRegistryMap[name] = registry
+}
+
+// GetBsonRegistry returns bsoncodec.Registry registered with RegisterBsonRegistry
+func GetBsonRegistry(name string) *bsoncodec.Registry {
+	bsonRegistryMutex.RLock()
+	defer bsonRegistryMutex.RUnlock()
+	return bsonRegistryMap[name]
+}
+
+// ToWriteConcern convert BootMongoWriteConcern to writeconcern.WriteConcern
+func ToWriteConcern(config *BootMongoWriteConcern) *writeconcern.WriteConcern {
+	if config == nil {
+		return nil
+	}
+
+	wcOpts := make([]writeconcern.Option, 0)
+
+	if w := config.W; len(w) > 0 {
+		if w == "majority" {
+			wcOpts = append(wcOpts, writeconcern.WMajority())
+		} else if n, err := strconv.Atoi(w); err == nil {
+			wcOpts = append(wcOpts, writeconcern.W(n))
+		} else {
+			wcOpts = append(wcOpts, writeconcern.WTagSet(w))
+		}
+	}
+	if config.J != nil {
+		wcOpts = append(wcOpts, writeconcern.J(*config.J))
+	}
+	if config.WTimeoutMs != nil {
+		wcOpts = append(wcOpts, writeconcern.WTimeout(time.Duration(*config.WTimeoutMs)*time.Millisecond))
+	}
+
+	return writeconcern.New(wcOpts...)
+}
+
+// ToDatabaseOptions convert BootMongoDatabase to options.DatabaseOptions
+func ToDatabaseOptions(config *BootMongoDatabase) (*mongoOpt.DatabaseOptions, error) {
+	opt := mongoOpt.Database()
+
+	if config == nil {
+		return opt, nil
+	}
+
+	// read preference
+	if config.ReadPreference != nil {
+		mode, err := readpref.ModeFromString(config.ReadPreference.Mode)
+		if err != nil {
+			return nil, err
+		}
+
+		rpOpts := make([]readpref.Option, 0)
+		if len(config.ReadPreference.TagSets) > 0 {
+			rpOpts = append(rpOpts, readpref.WithTagSets(tag.NewTagSetsFromMaps(config.ReadPreference.TagSets)...))
+		}
+		if config.ReadPreference.MaxStalenessMs != nil {
+			rpOpts = append(rpOpts, readpref.WithMaxStaleness(time.Duration(*config.ReadPreference.MaxStalenessMs)*time.Millisecond))
+		}
+
+		rp, err := readpref.New(mode, rpOpts...)
+		if err != nil {
+			return nil, err
+		}
+		opt.SetReadPreference(rp)
+	}
+
+	// read concern
+	if config.ReadConcern != nil {
+		opt.SetReadConcern(readconcern.New(readconcern.Level(*config.ReadConcern)))
+	}
+
+	// write concern
+	if config.WriteConcern != nil {
+		opt.SetWriteConcern(ToWriteConcern(config.WriteConcern))
+	}
+
+	// registry
+	if len(config.Registry) > 0 {
+		registry := GetBsonRegistry(config.Registry)
+		if registry == nil {
+			return nil, fmt.Errorf("bson registry [%s] not registered", config.Registry)
+		}
+		opt.SetRegistry(registry)
+	}
+
+	return opt, nil
 }
 
 // ToClientOptions convert BootConfigMongo to options.ClientOptions
@@ -235,19 +392,114 @@ func RegisterMongoEntryYAML(raw []byte) map[string]rkentry.Entry {
 
 			certEntry := rkentry.GlobalAppCtx.GetCertEntry(element.CertEntry)
 
+			// assign logger entry
+			loggerEntry := rkentry.GlobalAppCtx.GetLoggerEntry(element.LoggerEntry)
+			if loggerEntry == nil {
+				loggerEntry = rkentry.GlobalAppCtx.GetLoggerEntryDefault()
+			}
+
+			logger := NewLogger(nil, ToLogLevel(element.Logger.Level), 5000*time.Millisecond)
+
+			// configure slow threshold
+			if element.Logger.SlowThresholdMs > 0 {
+				logger.SlowThreshold = time.Duration(element.Logger.SlowThresholdMs) * time.Millisecond
+			}
+
+			// Override zap logger encoding and output path if provided by user
+			if element.Logger.Encoding == "json" || len(element.Logger.OutputPaths) > 0 {
+				loggerConfig := *loggerEntry.LoggerConfig
+				if element.Logger.Encoding == "json" {
+					loggerConfig.Encoding = "json"
+				}
+
+				if len(element.Logger.OutputPaths) > 0 {
+					loggerConfig.OutputPaths = toAbsPath(element.Logger.OutputPaths...)
+				}
+
+				lumberjackConfig := loggerEntry.LumberjackConfig
+				if lumberjackConfig == nil {
+					lumberjackConfig = rklogger.NewLumberjackConfigDefault()
+				}
+
+				if newLogger, err := rklogger.NewZapLoggerWithConf(&loggerConfig, lumberjackConfig); err != nil {
+					rkentry.ShutdownWithError(err)
+				} else {
+					logger.delegate = newLogger
+				}
+			}
+
 			opts := []Option{
 				WithName(element.Name),
 				WithDescription(element.Description),
 				WithClientOptions(clientOpt),
 				WithCertEntry(certEntry),
 				WithPingTimeoutMs(element.PingTimeoutMs),
+				WithMigrationLockTimeoutMs(element.MigrationLockTimeoutMs),
+				WithTransactionRetry(element.Transaction.MaxRetries,
+					element.Transaction.MinRetryBackoffMs,
+					element.Transaction.MaxRetryBackoffMs),
+				WithChangeStreamToken(element.ChangeStream.TokenDatabase, element.ChangeStream.TokenCollection),
+				WithChangeStreamRetry(element.ChangeStream.MinRetryBackoffMs, element.ChangeStream.MaxRetryBackoffMs),
 				WithInsecureSkipVerify(element.InsecureSkipVerify),
-				WithLoggerEntry(rkentry.GlobalAppCtx.GetLoggerEntry(element.LoggerEntry)),
+				WithTLSCAFile(element.TLSCAFile),
+				WithServerName(element.ServerName),
+				WithLoggerEntry(loggerEntry),
+				WithLogger(logger),
 			}
 
 			// iterate database
+			defaultDb := ""
 			for i := range element.Database {
-				opts = append(opts, WithDatabase(element.Database[i].Name))
+				if element.Database[i].Default {
+					if len(defaultDb) > 0 {
+						rkentry.ShutdownWithError(fmt.Errorf("multiple default databases [%s, %s] in entry [%s]",
+							defaultDb, element.Database[i].Name, element.Name))
+					}
+					defaultDb = element.Database[i].Name
+					opts = append(opts, WithDefaultDatabase(defaultDb))
+				}
+
+				dbOpt, err := ToDatabaseOptions(element.Database[i])
+				if err != nil {
+					rkentry.ShutdownWithError(fmt.Errorf("invalid options of database [%s] in entry [%s], %v",
+						element.Database[i].Name, element.Name, err))
+				}
+
+				opts = append(opts, WithDatabase(element.Database[i].Name, dbOpt))
+
+				// iterate collections which would be ensured at bootstrap
+				opts = append(opts, WithCollectionDryRun(element.Database[i].Name, element.Database[i].DryRun))
+				for _, coll := range element.Database[i].Collections {
+					collOpt, err := ToCreateCollectionOptions(coll)
+					if err != nil {
+						rkentry.ShutdownWithError(err)
+					}
+
+					indexes := make([]mongo.IndexModel, 0)
+					for _, index := range coll.Indexes {
+						model, err := ToIndexModel(index)
+						if err != nil {
+							rkentry.ShutdownWithError(fmt.Errorf("invalid index of collection [%s], %v", coll.Name, err))
+						}
+						indexes = append(indexes, model)
+					}
+
+					opts = append(opts, WithCollection(element.Database[i].Name, coll.Name, collOpt, indexes...))
+				}
+
+				// iterate GridFS buckets
+				for _, bucket := range element.Database[i].Buckets {
+					opts = append(opts, WithBucket(element.Database[i].Name, ToBucketOptions(bucket)))
+				}
+
+				// load migration scripts
+				if len(element.Database[i].MigrationPath) > 0 {
+					migrations, err := LoadMigrationsFromDir(element.Database[i].MigrationPath)
+					if err != nil {
+						rkentry.ShutdownWithError(err)
+					}
+					opts = append(opts, WithMigration(element.Database[i].Name, migrations...))
+				}
 			}
 
 			entry := RegisterMongoEntry(opts...)
@@ -262,14 +514,27 @@ func RegisterMongoEntryYAML(raw []byte) map[string]rkentry.Entry {
 // RegisterMongoEntry will register Entry into GlobalAppCtx
 func RegisterMongoEntry(opts ...Option) *MongoEntry {
 	entry := &MongoEntry{
-		entryName:        "MongoDB",
-		entryType:        MongoEntryType,
-		entryDescription: "Mongo entry for mongo-go-driver client",
-		loggerEntry:      rkentry.GlobalAppCtx.GetLoggerEntryDefault(),
-		mongoDbMap:       make(map[string]*mongo.Database),
-		mongoDbOpts:      make(map[string][]*mongoOpt.DatabaseOptions),
-		pingTimeoutMs:    3 * time.Second,
-		Opts:             mongoOpt.Client().ApplyURI("mongodb://localhost:27017"),
+		entryName:            "MongoDB",
+		entryType:            MongoEntryType,
+		entryDescription:     "Mongo entry for mongo-go-driver client",
+		loggerEntry:          rkentry.GlobalAppCtx.GetLoggerEntryDefault(),
+		mongoDbMap:           make(map[string]*mongo.Database),
+		mongoDbOpts:          make(map[string][]*mongoOpt.DatabaseOptions),
+		collections:          make(map[string][]*collectionInner),
+		collectionDryRun:     make(map[string]bool),
+		buckets:              make(map[string][]*bucketInner),
+		migrations:           make(map[string][]*Migration),
+		migrationLockTimeout: time.Minute,
+		migrationLockLease:   10 * time.Minute,
+		txMaxRetries:         3,
+		txMinRetryBackoff:    10 * time.Millisecond,
+		txMaxRetryBackoff:    time.Second,
+		csTokenColl:          ResumeTokenCollection,
+		csMinRetryBackoff:    100 * time.Millisecond,
+		csMaxRetryBackoff:    10 * time.Second,
+		pingTimeoutMs:        3 * time.Second,
+		logger:               NewLogger(nil, Warn, 5000*time.Millisecond),
+		Opts:                 mongoOpt.Client().ApplyURI("mongodb://localhost:27017"),
 	}
 
 	for i := range opts {
@@ -297,18 +562,43 @@ func RegisterMongoEntry(opts ...Option) *MongoEntry {
 
 // MongoEntry will init mongo.Client with provided arguments
 type MongoEntry struct {
-	entryName          string                                 `yaml:"entryName" yaml:"entryName"`
-	entryType          string                                 `yaml:"entryType" yaml:"entryType"`
-	entryDescription   string                                 `yaml:"-" json:"-"`
-	Opts               *mongoOpt.ClientOptions                `yaml:"-" json:"-"`
-	Client             *mongo.Client                          `yaml:"-" json:"-"`
-	mongoDbMap         map[string]*mongo.Database             `yaml:"-" json:"-"`
-	mongoDbOpts        map[string][]*mongoOpt.DatabaseOptions `yaml:"-" json:"-"`
-	certEntry          *rkentry.CertEntry                     `yaml:"-" json:"-"`
-	insecureSkipVerify bool                                   `yaml:"-" json:"-"`
-	loggerEntry        *rkentry.LoggerEntry                   `yaml:"-" json:"-"`
-	pingTimeoutMs      time.Duration                          `yaml:"-" json:"-"`
-	bootstrapOnce      sync.Once                              `json:"-" yaml:"-"`
+	entryName            string                                 `yaml:"entryName" yaml:"entryName"`
+	entryType            string                                 `yaml:"entryType" yaml:"entryType"`
+	entryDescription     string                                 `yaml:"-" json:"-"`
+	Opts                 *mongoOpt.ClientOptions                `yaml:"-" json:"-"`
+	Client               *mongo.Client                          `yaml:"-" json:"-"`
+	externalClient       bool                                   `yaml:"-" json:"-"`
+	mongoDbMap           map[string]*mongo.Database             `yaml:"-" json:"-"`
+	mongoDbOpts          map[string][]*mongoOpt.DatabaseOptions `yaml:"-" json:"-"`
+	dbNames              []string                               `yaml:"-" json:"-"`
+	defaultDbName        string                                 `yaml:"-" json:"-"`
+	collections          map[string][]*collectionInner          `yaml:"-" json:"-"`
+	collectionDryRun     map[string]bool                        `yaml:"-" json:"-"`
+	buckets              map[string][]*bucketInner              `yaml:"-" json:"-"`
+	migrations           map[string][]*Migration                `yaml:"-" json:"-"`
+	migrationLockTimeout time.Duration                          `yaml:"-" json:"-"`
+	migrationLockLease   time.Duration                          `yaml:"-" json:"-"`
+	txMaxRetries         int                                    `yaml:"-" json:"-"`
+	txMinRetryBackoff    time.Duration                          `yaml:"-" json:"-"`
+	txMaxRetryBackoff    time.Duration                          `yaml:"-" json:"-"`
+	csTokenDb            string                                 `yaml:"-" json:"-"`
+	csTokenColl          string                                 `yaml:"-" json:"-"`
+	csMinRetryBackoff    time.Duration                          `yaml:"-" json:"-"`
+	csMaxRetryBackoff    time.Duration                          `yaml:"-" json:"-"`
+	csCancels            []context.CancelFunc                   `yaml:"-" json:"-"`
+	csStopped            bool                                   `yaml:"-" json:"-"`
+	csWg                 sync.WaitGroup                         `yaml:"-" json:"-"`
+	csMutex              sync.Mutex                             `yaml:"-" json:"-"`
+	certEntry            *rkentry.CertEntry                     `yaml:"-" json:"-"`
+	insecureSkipVerify   bool                                   `yaml:"-" json:"-"`
+	tlsCAFile            string                                 `yaml:"-" json:"-"`
+	serverName           string                                 `yaml:"-" json:"-"`
+	loggerEntry          *rkentry.LoggerEntry                   `yaml:"-" json:"-"`
+	logger               *Logger                                `yaml:"-" json:"-"`
+	pingTimeoutMs        time.Duration                          `yaml:"-" json:"-"`
+	topology             *MongoTopology                         `yaml:"-" json:"-"`
+	topologyMutex        sync.Mutex                             `yaml:"-" json:"-"`
+	bootstrapOnce        sync.Once                              `json:"-" yaml:"-"`
 }
 
 // Bootstrap MongoEntry
@@ -330,45 +620,95 @@ func (entry *MongoEntry) Bootstrap(ctx context.Context) {
 		entry.loggerEntry.Info("Bootstrap mongoDbEntry", fields...)
 
 		// enable TLS if exist
-		if entry.certEntry != nil {
-			entry.Opts.TLSConfig = &tls.Config{
-				Certificates:       make([]tls.Certificate, 0),
-				InsecureSkipVerify: entry.insecureSkipVerify,
+		if entry.isTlsEnabled() {
+			tlsConfig, err := entry.newTLSConfig()
+			if err != nil {
+				entry.loggerEntry.Error("Creating TLS config for mongoDB client failed", zap.Error(err))
+				rkentry.ShutdownWithError(err)
 			}
+			entry.Opts.TLSConfig = tlsConfig
+		}
 
-			if entry.certEntry.Certificate != nil {
-				entry.Opts.TLSConfig.Certificates = append(entry.Opts.TLSConfig.Certificates, *entry.certEntry.Certificate)
+		if entry.logger.delegate == nil {
+			entry.logger.delegate = entry.loggerEntry.Logger
+		}
+
+		// connect to mongo, skip if client provided by WithClient
+		if entry.Client == nil {
+			// log commands with monitor, which could not be attached to client provided by WithClient
+			entry.Opts.SetMonitor(chainMonitor(entry.Opts.Monitor, entry.logger.NewMonitor()))
+
+			entry.loggerEntry.Info(fmt.Sprintf("Creating mongoDB client at %v", entry.Opts.Hosts))
+
+			if client, err := mongo.Connect(context.Background(), entry.Opts); err != nil {
+				entry.loggerEntry.Error(fmt.Sprintf("Creating mongoDB client at %v failed", entry.Opts.Hosts))
+				rkentry.ShutdownWithError(err)
+			} else {
+				entry.loggerEntry.Info(fmt.Sprintf("Creating mongoDB client at %v success", entry.Opts.Hosts))
+				entry.Client = client
 			}
 
-			if entry.certEntry.RootCA != nil {
-				entry.Opts.TLSConfig.Certificates = append(entry.Opts.TLSConfig.Certificates, tls.Certificate{
-					Certificate: [][]byte{entry.certEntry.RootCA.Raw},
-				})
+			// try ping
+			pingCtx, cancel := context.WithTimeout(context.Background(), entry.pingTimeoutMs)
+			defer cancel()
+			if err := entry.Client.Ping(pingCtx, nil); err != nil {
+				entry.loggerEntry.Error(fmt.Sprintf("Ping mongoDB at %v failed", entry.Opts.Hosts))
+				rkentry.ShutdownWithError(err)
 			}
+
+			// snapshot of topology reported in String()
+			entry.Topology(context.Background())
 		}
 
-		// connect to mongo
-		entry.loggerEntry.Info(fmt.Sprintf("Creating mongoDB client at %v", entry.Opts.Hosts))
+		// create database in declared order
+		for _, k := range entry.dbNames {
+			entry.mongoDbMap[k] = entry.Client.Database(k, entry.mongoDbOpts[k]...)
+			entry.loggerEntry.Info(fmt.Sprintf("Creating database instance [%s] success", k))
+		}
 
-		if client, err := mongo.Connect(context.Background(), entry.Opts); err != nil {
-			entry.loggerEntry.Error(fmt.Sprintf("Creating mongoDB client at %v failed", entry.Opts.Hosts))
-			rkentry.ShutdownWithError(err)
-		} else {
-			entry.loggerEntry.Info(fmt.Sprintf("Creating mongoDB client at %v success", entry.Opts.Hosts))
-			entry.Client = client
+		// create GridFS buckets
+		for k, v := range entry.buckets {
+			db, ok := entry.mongoDbMap[k]
+			if !ok {
+				db = entry.Client.Database(k)
+			}
+
+			for _, inner := range v {
+				bucket, err := gridfs.NewBucket(db, inner.opts)
+				if err != nil {
+					entry.loggerEntry.Error(fmt.Sprintf("Creating bucket [%s] of database [%s] failed", inner.name, k), zap.Error(err))
+					rkentry.ShutdownWithError(err)
+				}
+				inner.bucket = bucket
+				entry.loggerEntry.Info(fmt.Sprintf("Creating bucket [%s] of database [%s] success", inner.name, k))
+			}
 		}
 
-		// try ping
-		pingCtx, _ := context.WithTimeout(context.Background(), entry.pingTimeoutMs)
-		if err := entry.Client.Ping(pingCtx, nil); err != nil {
-			entry.loggerEntry.Error(fmt.Sprintf("Ping mongoDB at %v failed", entry.Opts.Hosts))
-			rkentry.ShutdownWithError(err)
+		// ensure collections and indexes
+		for k := range entry.collections {
+			db, ok := entry.mongoDbMap[k]
+			if !ok {
+				db = entry.Client.Database(k)
+			}
+
+			if err := entry.ensureCollections(context.Background(), db, entry.collectionDryRun[k]); err != nil {
+				entry.loggerEntry.Error(fmt.Sprintf("Ensuring collections of database [%s] failed", k), zap.Error(err))
+				rkentry.ShutdownWithError(err)
+			}
+			entry.loggerEntry.Info(fmt.Sprintf("Ensuring collections of database [%s] success", k))
 		}
 
-		// create database
-		for k, v := range entry.mongoDbOpts {
-			entry.mongoDbMap[k] = entry.Client.Database(k, v...)
-			entry.loggerEntry.Info(fmt.Sprintf("Creating database instance [%s] success", k))
+		// apply migrations
+		for k, v := range entry.migrations {
+			db, ok := entry.mongoDbMap[k]
+			if !ok {
+				db = entry.Client.Database(k)
+			}
+
+			if err := entry.migrate(context.Background(), db, v); err != nil {
+				entry.loggerEntry.Error(fmt.Sprintf("Applying migrations of database [%s] failed", k), zap.Error(err))
+				rkentry.ShutdownWithError(err)
+			}
 		}
 	})
 }
@@ -390,7 +730,9 @@ func (entry *MongoEntry) Interrupt(ctx context.Context) {
 
 	entry.loggerEntry.Info("Interrupt mongoDbEntry", fields...)
 
-	if entry.Client != nil {
+	entry.stopChangeStreams()
+
+	if entry.Client != nil && !entry.externalClient {
 		if err := entry.Client.Disconnect(context.Background()); err != nil {
 			entry.loggerEntry.Warn(fmt.Sprintf("Disconnecting from mongoDB at %v failed", entry.Opts.Hosts))
 		} else {
@@ -416,7 +758,23 @@ func (entry *MongoEntry) GetDescription() string {
 
 // String returns json marshalled string
 func (entry *MongoEntry) String() string {
-	bytes, err := json.Marshal(entry)
+	m := map[string]interface{}{
+		"entryName":        entry.entryName,
+		"entryType":        entry.entryType,
+		"entryDescription": entry.entryDescription,
+		"hosts":            entry.Opts.Hosts,
+		"databases":        entry.dbNames,
+		"defaultDatabase":  entry.defaultDatabaseName(),
+	}
+
+	// snapshot of the last Topology() call, String() never queries mongo
+	entry.topologyMutex.Lock()
+	if entry.topology != nil {
+		m["topology"] = entry.topology
+	}
+	entry.topologyMutex.Unlock()
+
+	bytes, err := json.Marshal(m)
 	if err != nil || len(bytes) < 1 {
 		return "{}"
 	}
@@ -424,6 +782,143 @@ func (entry *MongoEntry) String() string {
 	return string(bytes)
 }
 
+// IsHealthy checks healthy status of mongo by ping with pingTimeoutMs
+func (entry *MongoEntry) IsHealthy() bool {
+	if entry.Client == nil {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), entry.pingTimeoutMs)
+	defer cancel()
+
+	return entry.Client.Ping(ctx, nil) == nil
+}
+
+// MongoTopology is the topology of mongo reported by Topology()
+type MongoTopology struct {
+	PrimaryReachable bool     `json:"primaryReachable"`
+	Primary          string   `json:"primary,omitempty"`
+	ReplicaSet       string   `json:"replicaSet,omitempty"`
+	Members          []string `json:"members,omitempty"`
+	ServerVersion    string   `json:"serverVersion,omitempty"`
+	Error            string   `json:"error,omitempty"`
+	// CheckedAt is the time when topology was queried
+	CheckedAt time.Time `json:"checkedAt"`
+}
+
+// Topology queries topology of mongo with ping, hello and buildInfo commands within pingTimeoutMs,
+// including whether primary is reachable, replica set members and server version.
+//
+// Result is kept as snapshot reported in String(), which is taken at Bootstrap if client is not provided
+// by WithClient and refreshed by every call of Topology().
+func (entry *MongoEntry) Topology(ctx context.Context) *MongoTopology {
+	res := &MongoTopology{CheckedAt: time.Now()}
+	defer func() {
+		snapshot := *res
+		entry.topologyMutex.Lock()
+		defer entry.topologyMutex.Unlock()
+		entry.topology = &snapshot
+	}()
+
+	if entry.Client == nil {
+		res.Error = fmt.Sprintf("mongo client of entry [%s] is not initialized, please call Bootstrap first", entry.entryName)
+		return res
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, entry.pingTimeoutMs)
+	defer cancel()
+
+	res.PrimaryReachable = entry.Client.Ping(ctx, readpref.Primary()) == nil
+
+	admin := entry.Client.Database("admin")
+
+	hello := struct {
+		SetName string   `bson:"setName"`
+		Hosts   []string `bson:"hosts"`
+		Primary string   `bson:"primary"`
+	}{}
+	// hello is supported since 4.4.2, fallback to isMaster for legacy servers
+	if err := admin.RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err != nil {
+		if err := admin.RunCommand(ctx, bson.D{{Key: "isMaster", Value: 1}}).Decode(&hello); err != nil {
+			res.Error = err.Error()
+			return res
+		}
+	}
+	res.ReplicaSet = hello.SetName
+	res.Members = hello.Hosts
+	res.Primary = hello.Primary
+
+	buildInfo := struct {
+		Version string `bson:"version"`
+	}{}
+	if err := admin.RunCommand(ctx, bson.D{{Key: "buildInfo", Value: 1}}).Decode(&buildInfo); err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	res.ServerVersion = buildInfo.Version
+
+	return res
+}
+
+// isTlsEnabled checks whether TLS config needs to be created or updated.
+// TLS enabled by simpleURI would be updated only if insecureSkipVerify is true.
+func (entry *MongoEntry) isTlsEnabled() bool {
+	if entry.certEntry != nil || len(entry.tlsCAFile) > 0 || len(entry.serverName) > 0 {
+		return true
+	}
+
+	return entry.Opts.TLSConfig != nil && entry.insecureSkipVerify
+}
+
+// newTLSConfig creates tls.Config based on TLS config parsed from simpleURI if exists.
+// Client certificate is from certEntry, trusted CAs are from certEntry and tlsCAFile.
+func (entry *MongoEntry) newTLSConfig() (*tls.Config, error) {
+	res := &tls.Config{}
+	if entry.Opts.TLSConfig != nil {
+		res = entry.Opts.TLSConfig.Clone()
+	}
+
+	if entry.insecureSkipVerify {
+		res.InsecureSkipVerify = true
+	}
+
+	if len(entry.serverName) > 0 {
+		res.ServerName = entry.serverName
+	}
+
+	if entry.certEntry != nil && entry.certEntry.Certificate != nil {
+		res.Certificates = append(res.Certificates, *entry.certEntry.Certificate)
+	}
+
+	if entry.certEntry != nil && entry.certEntry.RootCA != nil {
+		if res.RootCAs == nil {
+			res.RootCAs = x509.NewCertPool()
+		}
+		res.RootCAs.AddCert(entry.certEntry.RootCA)
+	}
+
+	if len(entry.tlsCAFile) > 0 {
+		caPem, err := os.ReadFile(entry.tlsCAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		if res.RootCAs == nil {
+			res.RootCAs = x509.NewCertPool()
+		}
+		if !res.RootCAs.AppendCertsFromPEM(caPem) {
+			return nil, fmt.Errorf("no valid certificate found in tlsCAFile:%s", entry.tlsCAFile)
+		}
+	}
+
+	return res, nil
+}
+
+// AddMigration adds migrations of database, which should be called before Bootstrap
+func (entry *MongoEntry) AddMigration(dbName string, migrations ...*Migration) {
+	WithMigration(dbName, migrations...)(entry)
+}
+
 // GetMongoClient returns mongo.Client
 func (entry *MongoEntry) GetMongoClient() *mongo.Client {
 	return entry.Client
@@ -439,12 +934,22 @@ func (entry *MongoEntry) GetMongoClientOptions() *mongoOpt.ClientOptions {
 	return entry.Opts
 }
 
-// GetDefaultMongoDB returns first mongo.Database
+// GetDefaultMongoDB returns mongo.Database marked as default, or the first declared one if none marked
 func (entry *MongoEntry) GetDefaultMongoDB() *mongo.Database {
-	for _, v := range entry.mongoDbMap {
-		return v
+	return entry.mongoDbMap[entry.defaultDatabaseName()]
+}
+
+// defaultDatabaseName returns name of database marked as default, or the first declared one if none marked
+func (entry *MongoEntry) defaultDatabaseName() string {
+	if len(entry.defaultDbName) > 0 {
+		return entry.defaultDbName
 	}
-	return nil
+
+	if len(entry.dbNames) > 0 {
+		return entry.dbNames[0]
+	}
+
+	return ""
 }
 
 // ************ Option ************
@@ -473,22 +978,196 @@ func WithCertEntry(in *rkentry.CertEntry) Option {
 	}
 }
 
+// WithInsecureSkipVerify provide InsecureSkipVerify of tls.Config
 func WithInsecureSkipVerify(skip bool) Option {
 	return func(entry *MongoEntry) {
 		entry.insecureSkipVerify = skip
 	}
 }
 
+// WithTLSCAFile provide PEM file of CA used to verify certificate of server
+func WithTLSCAFile(caFile string) Option {
+	return func(entry *MongoEntry) {
+		entry.tlsCAFile = caFile
+	}
+}
+
+// WithServerName provide ServerName of tls.Config which overrides host name of server
+func WithServerName(serverName string) Option {
+	return func(entry *MongoEntry) {
+		entry.serverName = serverName
+	}
+}
+
 func WithDatabase(dbName string, dbOpts ...*mongoOpt.DatabaseOptions) Option {
 	return func(entry *MongoEntry) {
 		if _, ok := entry.mongoDbOpts[dbName]; !ok {
 			entry.mongoDbOpts[dbName] = make([]*mongoOpt.DatabaseOptions, 0)
+			entry.dbNames = append(entry.dbNames, dbName)
 		}
 
 		entry.mongoDbOpts[dbName] = append(entry.mongoDbOpts[dbName], dbOpts...)
 	}
 }
 
+// WithDefaultDatabase provide name of database returned by GetDefaultMongoDB, database would be declared if missing
+func WithDefaultDatabase(dbName string) Option {
+	return func(entry *MongoEntry) {
+		if len(dbName) < 1 {
+			return
+		}
+
+		WithDatabase(dbName)(entry)
+		entry.defaultDbName = dbName
+	}
+}
+
+// WithCollection provide collection with indexes which would be created at Bootstrap if missing
+func WithCollection(dbName, collName string, collOpt *mongoOpt.CreateCollectionOptions, indexes ...mongo.IndexModel) Option {
+	return func(entry *MongoEntry) {
+		if len(dbName) < 1 || len(collName) < 1 {
+			return
+		}
+
+		// generate index name for drift detection
+		for i := range indexes {
+			if indexes[i].Options == nil {
+				indexes[i].Options = mongoOpt.Index()
+			}
+			if keys, ok := indexes[i].Keys.(bson.D); ok && indexes[i].Options.Name == nil {
+				indexes[i].Options.SetName(toIndexName(keys))
+			}
+		}
+
+		entry.collections[dbName] = append(entry.collections[dbName], &collectionInner{
+			name:    collName,
+			opts:    collOpt,
+			indexes: indexes,
+		})
+	}
+}
+
+// WithBucket provide GridFS bucket of database which would be created at Bootstrap, name of bucket is fs if missing
+func WithBucket(dbName string, opt *mongoOpt.BucketOptions) Option {
+	return func(entry *MongoEntry) {
+		if opt == nil {
+			opt = mongoOpt.GridFSBucket()
+		}
+
+		if opt.Name == nil || len(*opt.Name) < 1 {
+			opt.SetName(mongoOpt.DefaultName)
+		}
+
+		for _, inner := range entry.buckets[dbName] {
+			if inner.name == *opt.Name {
+				inner.opts = opt
+				return
+			}
+		}
+
+		entry.buckets[dbName] = append(entry.buckets[dbName], &bucketInner{
+			name: *opt.Name,
+			opts: opt,
+		})
+	}
+}
+
+// WithCollectionDryRun provide dry run mode of database, collections and indexes would not be created,
+// only differences would be logged at Bootstrap
+func WithCollectionDryRun(dbName string, dryRun bool) Option {
+	return func(entry *MongoEntry) {
+		entry.collectionDryRun[dbName] = dryRun
+	}
+}
+
+// WithMigration provide versioned migrations of database which would be applied in order at Bootstrap
+func WithMigration(dbName string, migrations ...*Migration) Option {
+	return func(entry *MongoEntry) {
+		if len(dbName) < 1 {
+			return
+		}
+
+		for i := range migrations {
+			if migrations[i] != nil {
+				entry.migrations[dbName] = append(entry.migrations[dbName], migrations[i])
+			}
+		}
+	}
+}
+
+// WithMigrationLockTimeoutMs provide timeout of waiting for migration lock held by other process
+func WithMigrationLockTimeoutMs(tout int) Option {
+	return func(entry *MongoEntry) {
+		if tout > 0 {
+			entry.migrationLockTimeout = time.Duration(tout) * time.Millisecond
+		}
+	}
+}
+
+// WithTransactionRetry provide maximum retries and backoff of WithTransaction, non-positive value would be ignored
+func WithTransactionRetry(maxRetries, minBackoffMs, maxBackoffMs int) Option {
+	return func(entry *MongoEntry) {
+		if maxRetries > 0 {
+			entry.txMaxRetries = maxRetries
+		}
+		if minBackoffMs > 0 {
+			entry.txMinRetryBackoff = time.Duration(minBackoffMs) * time.Millisecond
+		}
+		if maxBackoffMs > 0 {
+			entry.txMaxRetryBackoff = time.Duration(maxBackoffMs) * time.Millisecond
+		}
+	}
+}
+
+// WithChangeStreamToken provide database and collection which resume tokens of change streams would be saved into.
+// Resume tokens would be saved into database watched if tokenDb is empty.
+func WithChangeStreamToken(tokenDb, tokenColl string) Option {
+	return func(entry *MongoEntry) {
+		if len(tokenDb) > 0 {
+			entry.csTokenDb = tokenDb
+		}
+		if len(tokenColl) > 0 {
+			entry.csTokenColl = tokenColl
+		}
+	}
+}
+
+// WithChangeStreamRetry provide backoff of restarting change streams, non-positive value would be ignored
+func WithChangeStreamRetry(minBackoffMs, maxBackoffMs int) Option {
+	return func(entry *MongoEntry) {
+		if minBackoffMs > 0 {
+			entry.csMinRetryBackoff = time.Duration(minBackoffMs) * time.Millisecond
+		}
+		if maxBackoffMs > 0 {
+			entry.csMaxRetryBackoff = time.Duration(maxBackoffMs) * time.Millisecond
+		}
+	}
+}
+
+// WithLogger provide Logger which logs commands, logger of loggerEntry would be used if delegate of Logger is nil
+func WithLogger(logger *Logger) Option {
+	return func(entry *MongoEntry) {
+		if logger != nil {
+			entry.logger = logger
+		}
+	}
+}
+
+// WithClient provide connected mongo.Client which would be used at Bootstrap instead of connecting with options.
+// Client is owned by caller and would not be disconnected at Interrupt.
+// Mainly used for unit tests with mock deployment, please refer to package rkmongotest.
+//
+// Commands of client are not logged by Logger of entry, since monitor of connected client could not be changed.
+// Create client with monitor of Logger and provide the same Logger with WithLogger if commands should be logged.
+func WithClient(client *mongo.Client) Option {
+	return func(entry *MongoEntry) {
+		if client != nil {
+			entry.Client = client
+			entry.externalClient = true
+		}
+	}
+}
+
 // WithClientOptions provide options.ClientOptions
 func WithClientOptions(opt *mongoOpt.ClientOptions) Option {
 	return func(e *MongoEntry) {
@@ -7,10 +7,22 @@ package rkmongo
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
 	"fmt"
+	"github.com/rookie-ninja/rk-entry/v2/entry"
 	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
 	"gopkg.in/yaml.v3"
 	"io/ioutil"
+	"math/big"
 	"os"
 	"path"
 	"testing"
@@ -101,6 +113,65 @@ func TestToClientOptions(t *testing.T) {
 	assert.Equal(t, 1, *opts.ZstdLevel)
 }
 
+func TestToDatabaseOptions(t *testing.T) {
+	defer assertNotPanic(t)
+
+	// with nil
+	opts, err := ToDatabaseOptions(nil)
+	assert.NotNil(t, opts)
+	assert.Nil(t, err)
+
+	// happy case
+	RegisterBsonRegistry("ut-registry", bson.NewRegistryBuilder().Build())
+	dbYamlStr := `
+name: "database"
+readPreference:
+  mode: "secondaryPreferred"
+  tagSets:
+    - dc: "east"
+  maxStalenessMs: 120000
+readConcern: "majority"
+writeConcern:
+  w: "majority"
+  j: true
+  wtimeoutMs: 1000
+registry: "ut-registry"
+`
+	config := &BootMongoDatabase{}
+	assert.Nil(t, yaml.Unmarshal([]byte(dbYamlStr), config))
+	opts, err = ToDatabaseOptions(config)
+	assert.Nil(t, err)
+
+	assert.Equal(t, readpref.SecondaryPreferredMode, opts.ReadPreference.Mode())
+	assert.Len(t, opts.ReadPreference.TagSets(), 1)
+	maxStaleness, _ := opts.ReadPreference.MaxStaleness()
+	assert.Equal(t, 2*time.Minute, maxStaleness)
+	assert.Equal(t, "majority", opts.ReadConcern.GetLevel())
+	assert.Equal(t, "majority", opts.WriteConcern.GetW())
+	assert.True(t, opts.WriteConcern.GetJ())
+	assert.Equal(t, time.Second, opts.WriteConcern.GetWTimeout())
+	assert.Equal(t, GetBsonRegistry("ut-registry"), opts.Registry)
+
+	// numeric w
+	config.WriteConcern.W = "2"
+	opts, err = ToDatabaseOptions(config)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, opts.WriteConcern.GetW())
+
+	// invalid read preference mode
+	config.ReadPreference.Mode = "invalid"
+	opts, err = ToDatabaseOptions(config)
+	assert.NotNil(t, err)
+	assert.Nil(t, opts)
+
+	// missing registry
+	config.ReadPreference = nil
+	config.Registry = "not-exist"
+	opts, err = ToDatabaseOptions(config)
+	assert.NotNil(t, err)
+	assert.Nil(t, opts)
+}
+
 func TestRegisterMongoEntriesFromConfig(t *testing.T) {
 	defer assertNotPanic(t)
 
@@ -161,6 +232,173 @@ func TestMongoEntry_Interrupt(t *testing.T) {
 	entry.Interrupt(context.TODO())
 }
 
+func TestMongoEntry_GetDefaultMongoDB(t *testing.T) {
+	// without database
+	entry := RegisterMongoEntry()
+	assert.Nil(t, entry.GetDefaultMongoDB())
+	assert.Empty(t, entry.defaultDatabaseName())
+	rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	// first declared database
+	entry = RegisterMongoEntry(
+		WithDatabase("db-1"),
+		WithDatabase("db-2"),
+		WithDatabase("db-3"))
+	assert.Equal(t, []string{"db-1", "db-2", "db-3"}, entry.dbNames)
+	assert.Equal(t, "db-1", entry.defaultDatabaseName())
+
+	client, err := mongo.NewClient(entry.Opts)
+	assert.Nil(t, err)
+	for _, name := range entry.dbNames {
+		entry.mongoDbMap[name] = client.Database(name)
+	}
+	assert.Equal(t, "db-1", entry.GetDefaultMongoDB().Name())
+
+	// database marked as default
+	WithDefaultDatabase("db-2")(entry)
+	assert.Equal(t, "db-2", entry.GetDefaultMongoDB().Name())
+	assert.Len(t, entry.dbNames, 3)
+	assert.Contains(t, entry.String(), `"defaultDatabase":"db-2"`)
+	rkentry.GlobalAppCtx.RemoveEntry(entry)
+}
+
+func TestRegisterMongoEntryYAML_WithDefaultDatabase(t *testing.T) {
+	bootConfigStr := `
+mongo:
+  - name: "ut-mongo-default"
+    enabled: true
+    database:
+      - name: "db-1"
+      - name: "db-2"
+        default: true
+`
+
+	entries := RegisterMongoEntryYAML([]byte(bootConfigStr))
+	entry := entries["ut-mongo-default"].(*MongoEntry)
+	assert.Equal(t, []string{"db-1", "db-2"}, entry.dbNames)
+	assert.Equal(t, "db-2", entry.defaultDatabaseName())
+	rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	// multiple default databases
+	defer assertPanic(t)
+	RegisterMongoEntryYAML([]byte(`
+mongo:
+  - name: "ut-mongo-default"
+    enabled: true
+    database:
+      - name: "db-1"
+        default: true
+      - name: "db-2"
+        default: true
+`))
+}
+
+func TestMongoEntry_IsHealthy(t *testing.T) {
+	entry := RegisterMongoEntry(WithPingTimeoutMs(10))
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	// without bootstrap
+	assert.False(t, entry.IsHealthy())
+	assert.NotContains(t, entry.String(), "topology")
+	assert.NotEmpty(t, entry.Topology(context.TODO()).Error)
+
+	// with disconnected client
+	client, err := mongo.NewClient(entry.Opts)
+	assert.Nil(t, err)
+	entry.Client = client
+	assert.False(t, entry.IsHealthy())
+
+	// topology with error
+	topology := entry.Topology(context.TODO())
+	assert.False(t, topology.PrimaryReachable)
+	assert.NotEmpty(t, topology.Error)
+	assert.False(t, topology.CheckedAt.IsZero())
+
+	// String() reports snapshot of the last Topology() without querying mongo
+	entry.Client = nil
+	m := map[string]interface{}{}
+	assert.Nil(t, json.Unmarshal([]byte(entry.String()), &m))
+	assert.Equal(t, false, m["topology"].(map[string]interface{})["primaryReachable"])
+	assert.Equal(t, topology.Error, m["topology"].(map[string]interface{})["error"])
+}
+
+func TestMongoEntry_newTLSConfig(t *testing.T) {
+	defer assertNotPanic(t)
+
+	// without TLS
+	entry := RegisterMongoEntry()
+	assert.False(t, entry.isTlsEnabled())
+
+	// skip verify without TLS enabled in simpleURI
+	WithInsecureSkipVerify(true)(entry)
+	assert.False(t, entry.isTlsEnabled())
+
+	// skip verify with TLS enabled in simpleURI
+	entry.Opts.ApplyURI("mongodb://localhost:27017/?tls=true")
+	assert.True(t, entry.isTlsEnabled())
+	tlsConfig, err := entry.newTLSConfig()
+	assert.Nil(t, err)
+	assert.True(t, tlsConfig.InsecureSkipVerify)
+
+	// with cert entry, CA file and server name
+	certPem, keyPem := generateCerts()
+	cert, err := tls.X509KeyPair(certPem, keyPem)
+	assert.Nil(t, err)
+	block, _ := pem.Decode(certPem)
+	rootCA, err := x509.ParseCertificate(block.Bytes)
+	assert.Nil(t, err)
+
+	caFile := path.Join(t.TempDir(), "ca.pem")
+	assert.Nil(t, ioutil.WriteFile(caFile, certPem, os.ModePerm))
+
+	entry = RegisterMongoEntry(
+		WithCertEntry(&rkentry.CertEntry{RootCA: rootCA, Certificate: &cert}),
+		WithTLSCAFile(caFile),
+		WithServerName("ut-server"))
+	assert.True(t, entry.isTlsEnabled())
+
+	tlsConfig, err = entry.newTLSConfig()
+	assert.Nil(t, err)
+	assert.Len(t, tlsConfig.Certificates, 1)
+	assert.NotNil(t, tlsConfig.RootCAs)
+	assert.Equal(t, "ut-server", tlsConfig.ServerName)
+	assert.False(t, tlsConfig.InsecureSkipVerify)
+
+	// with invalid CA file
+	assert.Nil(t, ioutil.WriteFile(caFile, []byte("invalid"), os.ModePerm))
+	tlsConfig, err = entry.newTLSConfig()
+	assert.NotNil(t, err)
+	assert.Nil(t, tlsConfig)
+}
+
+func generateCerts() ([]byte, []byte) {
+	// Create certs and return as []byte
+	ca := &x509.Certificate{
+		Subject: pkix.Name{
+			Organization: []string{"Fake cert."},
+		},
+		SerialNumber:          big.NewInt(42),
+		NotAfter:              time.Now().Add(2 * time.Hour),
+		IsCA:                  true,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+
+	// Create a Private Key
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	// Use CA Cert to sign a CSR and create a Public Cert
+	csr := &key.PublicKey
+	cert, _ := x509.CreateCertificate(rand.Reader, ca, ca, csr, key)
+
+	// Convert keys into pem.Block
+	c := &pem.Block{Type: "CERTIFICATE", Bytes: cert}
+	k := &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}
+
+	return pem.EncodeToMemory(c), pem.EncodeToMemory(k)
+}
+
 func assertNotPanic(t *testing.T) {
 	if r := recover(); r != nil {
 		// Expect panic to be called with non nil error
@@ -0,0 +1,261 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkmongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	mongoOpt "go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+	"time"
+)
+
+// ResumeTokenCollection is the default collection which resume tokens of change streams would be saved into
+const ResumeTokenCollection = "_rk_resume_tokens"
+
+// ChangeStreamHandler handles event of change stream.
+// Resume token would be saved only if nil returned, otherwise, change stream would be restarted
+// from last saved resume token, which means event would be delivered at least once.
+type ChangeStreamHandler func(ctx context.Context, event bson.Raw) error
+
+// ChangeStream declares a change stream consumed by MongoEntry.Watch
+//
+// Database and Collection declare target of change stream:
+// 1: Both empty, watch all databases of client
+// 2: Collection empty, watch all collections of database
+// 3: Both provided, watch collection
+type ChangeStream struct {
+	// Name is the identity of change stream, resume token would be saved with it
+	Name string
+	// Database watched, empty if watch client
+	Database string
+	// Collection watched, empty if watch client or database
+	Collection string
+	// Pipeline applied to change stream, optional
+	Pipeline mongo.Pipeline
+	// Options of change stream, optional, resume token would be overridden by saved one
+	Options *mongoOpt.ChangeStreamOptions
+	// Handler of change events, required
+	Handler ChangeStreamHandler
+}
+
+type resumeTokenRecord struct {
+	Name      string    `bson:"_id"`
+	Token     bson.Raw  `bson:"token"`
+	UpdatedAt time.Time `bson:"updatedAt"`
+}
+
+// Watch starts consuming change stream in background until ctx done or entry interrupted.
+//
+// Resume token is saved into changeStream.tokenCollection of changeStream.tokenDatabase after each event handled,
+// tokenDatabase is the database watched by default, which is required if change stream watches client.
+// Events of token collection are excluded from change stream which watches database or client.
+// Change stream would be restarted with exponential backoff if error occurs.
+func (entry *MongoEntry) Watch(ctx context.Context, cs *ChangeStream) error {
+	if err := entry.validateChangeStream(cs); err != nil {
+		return err
+	}
+
+	if entry.Client == nil {
+		return fmt.Errorf("mongo client of entry [%s] is not initialized, please call Bootstrap first", entry.entryName)
+	}
+
+	entry.csMutex.Lock()
+	defer entry.csMutex.Unlock()
+
+	if entry.csStopped {
+		return fmt.Errorf("entry [%s] is interrupted", entry.entryName)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	entry.csCancels = append(entry.csCancels, cancel)
+
+	entry.csWg.Add(1)
+	go entry.runChangeStream(ctx, cs)
+
+	return nil
+}
+
+// validateChangeStream checks required fields of ChangeStream
+func (entry *MongoEntry) validateChangeStream(cs *ChangeStream) error {
+	if cs == nil {
+		return errors.New("nil change stream")
+	}
+
+	if len(cs.Name) < 1 {
+		return errors.New("name of change stream is required")
+	}
+
+	if cs.Handler == nil {
+		return fmt.Errorf("handler of change stream [%s] is required", cs.Name)
+	}
+
+	if len(cs.Database) < 1 && len(cs.Collection) > 0 {
+		return fmt.Errorf("database of change stream [%s] is required if collection provided", cs.Name)
+	}
+
+	if len(entry.changeStreamTokenDatabase(cs)) < 1 {
+		return fmt.Errorf("changeStream.tokenDatabase is required since change stream [%s] watches client", cs.Name)
+	}
+
+	return nil
+}
+
+// stopChangeStreams cancels all change streams and waits for them to exit, called at Interrupt
+func (entry *MongoEntry) stopChangeStreams() {
+	entry.csMutex.Lock()
+	entry.csStopped = true
+	for i := range entry.csCancels {
+		entry.csCancels[i]()
+	}
+	entry.csCancels = nil
+	entry.csMutex.Unlock()
+
+	entry.csWg.Wait()
+}
+
+// runChangeStream consumes change stream and restarts it with backoff until ctx done
+func (entry *MongoEntry) runChangeStream(ctx context.Context, cs *ChangeStream) {
+	defer entry.csWg.Done()
+
+	fields := []zap.Field{
+		zap.String("entryName", entry.entryName),
+		zap.String("changeStream", cs.Name),
+		zap.String("database", cs.Database),
+		zap.String("collection", cs.Collection),
+	}
+
+	entry.loggerEntry.Info("Starting change stream", fields...)
+
+	attempt := 0
+	for {
+		handled, err := entry.consumeChangeStream(ctx, cs)
+		if ctx.Err() != nil {
+			entry.loggerEntry.Info("Stopping change stream", fields...)
+			return
+		}
+
+		// reset backoff since change stream worked before error occurred
+		if handled {
+			attempt = 0
+		}
+		attempt++
+
+		backoff := expBackoff(entry.csMinRetryBackoff, entry.csMaxRetryBackoff, attempt)
+		entry.loggerEntry.Warn("Restarting change stream",
+			append(fields, zap.Int("attempt", attempt), zap.Duration("backoff", backoff), zap.Error(err))...)
+
+		select {
+		case <-ctx.Done():
+			entry.loggerEntry.Info("Stopping change stream", fields...)
+			return
+		case <-time.After(backoff):
+		}
+	}
+}
+
+// consumeChangeStream opens change stream from saved resume token and handles events until error occurs.
+// Returns true if any event handled.
+func (entry *MongoEntry) consumeChangeStream(ctx context.Context, cs *ChangeStream) (bool, error) {
+	tokenColl := entry.Client.Database(entry.changeStreamTokenDatabase(cs)).Collection(entry.csTokenColl)
+
+	token, err := loadResumeToken(ctx, tokenColl, cs.Name)
+	if err != nil {
+		return false, err
+	}
+
+	opts := mongoOpt.MergeChangeStreamOptions(cs.Options)
+	if token != nil {
+		opts.SetResumeAfter(nil)
+		opts.SetStartAtOperationTime(nil)
+		opts.SetStartAfter(token)
+	}
+
+	pipeline := entry.changeStreamPipeline(cs)
+
+	var stream *mongo.ChangeStream
+	switch {
+	case len(cs.Collection) > 0:
+		stream, err = entry.Client.Database(cs.Database).Collection(cs.Collection).Watch(ctx, pipeline, opts)
+	case len(cs.Database) > 0:
+		stream, err = entry.Client.Database(cs.Database).Watch(ctx, pipeline, opts)
+	default:
+		stream, err = entry.Client.Watch(ctx, pipeline, opts)
+	}
+	if err != nil {
+		return false, err
+	}
+	defer stream.Close(context.Background())
+
+	handled := false
+	for stream.Next(ctx) {
+		if err := cs.Handler(ctx, stream.Current); err != nil {
+			return handled, err
+		}
+		handled = true
+
+		if err := saveResumeToken(ctx, tokenColl, cs.Name, stream.ResumeToken()); err != nil {
+			return handled, err
+		}
+	}
+
+	return handled, stream.Err()
+}
+
+// changeStreamTokenDatabase returns database of resume token collection
+func (entry *MongoEntry) changeStreamTokenDatabase(cs *ChangeStream) string {
+	if len(entry.csTokenDb) > 0 {
+		return entry.csTokenDb
+	}
+
+	return cs.Database
+}
+
+// changeStreamPipeline returns pipeline of change stream, events of resume token collection are excluded
+// if database of it is watched, otherwise saving resume token would produce new events endlessly.
+func (entry *MongoEntry) changeStreamPipeline(cs *ChangeStream) mongo.Pipeline {
+	pipeline := mongo.Pipeline{}
+
+	if len(cs.Collection) < 1 {
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: bson.M{
+			"$nor": bson.A{
+				bson.M{"ns.db": entry.changeStreamTokenDatabase(cs), "ns.coll": entry.csTokenColl},
+			},
+		}}})
+	}
+
+	return append(pipeline, cs.Pipeline...)
+}
+
+// loadResumeToken returns saved resume token, nil if missing
+func loadResumeToken(ctx context.Context, coll *mongo.Collection, name string) (bson.Raw, error) {
+	record := &resumeTokenRecord{}
+	if err := coll.FindOne(ctx, bson.M{"_id": name}).Decode(record); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return record.Token, nil
+}
+
+// saveResumeToken upserts resume token of change stream
+func saveResumeToken(ctx context.Context, coll *mongo.Collection, name string, token bson.Raw) error {
+	if token == nil {
+		return nil
+	}
+
+	_, err := coll.UpdateOne(ctx,
+		bson.M{"_id": name},
+		bson.M{"$set": bson.M{"token": token, "updatedAt": time.Now()}},
+		mongoOpt.Update().SetUpsert(true))
+
+	return err
+}
@@ -0,0 +1,135 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkmongo
+
+import (
+	"context"
+	"github.com/rookie-ninja/rk-entry/v2/entry"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"testing"
+	"time"
+)
+
+func TestMongoEntry_validateChangeStream(t *testing.T) {
+	entry := RegisterMongoEntry()
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	handler := func(ctx context.Context, event bson.Raw) error {
+		return nil
+	}
+
+	// nil change stream
+	assert.NotNil(t, entry.validateChangeStream(nil))
+
+	// missing name
+	assert.NotNil(t, entry.validateChangeStream(&ChangeStream{Handler: handler}))
+
+	// missing handler
+	assert.NotNil(t, entry.validateChangeStream(&ChangeStream{Name: "ut"}))
+
+	// collection without database
+	assert.NotNil(t, entry.validateChangeStream(&ChangeStream{Name: "ut", Collection: "coll", Handler: handler}))
+
+	// watch client without token database
+	assert.NotNil(t, entry.validateChangeStream(&ChangeStream{Name: "ut", Handler: handler}))
+
+	// happy case
+	assert.Nil(t, entry.validateChangeStream(&ChangeStream{Name: "ut", Database: "db", Handler: handler}))
+
+	// watch client with token database
+	WithChangeStreamToken("db", "")(entry)
+	assert.Nil(t, entry.validateChangeStream(&ChangeStream{Name: "ut", Handler: handler}))
+}
+
+func TestMongoEntry_changeStreamPipeline(t *testing.T) {
+	entry := RegisterMongoEntry()
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	userStage := bson.D{{Key: "$match", Value: bson.M{"operationType": "insert"}}}
+	excludeTokens := func(db string) bson.D {
+		return bson.D{{Key: "$match", Value: bson.M{
+			"$nor": bson.A{bson.M{"ns.db": db, "ns.coll": entry.csTokenColl}},
+		}}}
+	}
+
+	// watch database which contains token collection, writes of resume token are excluded before user stages
+	pipeline := entry.changeStreamPipeline(&ChangeStream{Name: "ut", Database: "db", Pipeline: mongo.Pipeline{userStage}})
+	assert.Equal(t, mongo.Pipeline{excludeTokens("db"), userStage}, pipeline)
+
+	// watch client
+	WithChangeStreamToken("tokens", "")(entry)
+	pipeline = entry.changeStreamPipeline(&ChangeStream{Name: "ut"})
+	assert.Equal(t, mongo.Pipeline{excludeTokens("tokens")}, pipeline)
+
+	// watch collection, nothing excluded
+	pipeline = entry.changeStreamPipeline(&ChangeStream{Name: "ut", Database: "db", Collection: "coll"})
+	assert.Empty(t, pipeline)
+}
+
+func TestMongoEntry_Watch(t *testing.T) {
+	entry := RegisterMongoEntry(WithChangeStreamRetry(1, 5))
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	cs := &ChangeStream{
+		Name:       "ut",
+		Database:   "db",
+		Collection: "coll",
+		Handler: func(ctx context.Context, event bson.Raw) error {
+			return nil
+		},
+	}
+
+	// without bootstrap
+	assert.NotNil(t, entry.Watch(context.TODO(), cs))
+
+	// with disconnected client, change stream keeps restarting until interrupted
+	client, err := mongo.NewClient(entry.Opts)
+	assert.Nil(t, err)
+	entry.Client = client
+
+	assert.Nil(t, entry.Watch(context.TODO(), cs))
+	time.Sleep(20 * time.Millisecond)
+
+	done := make(chan struct{})
+	go func() {
+		entry.Interrupt(context.TODO())
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		assert.Fail(t, "change stream not stopped at Interrupt")
+	}
+
+	// watch after interrupted
+	assert.NotNil(t, entry.Watch(context.TODO(), cs))
+}
+
+func TestRegisterMongoEntryYAML_WithChangeStream(t *testing.T) {
+	bootConfigStr := `
+mongo:
+  - name: "ut-mongo-change-stream"
+    enabled: true
+    changeStream:
+      tokenDatabase: "tokens"
+      tokenCollection: "resume_tokens"
+      minRetryBackoffMs: 10
+      maxRetryBackoffMs: 100
+`
+
+	entries := RegisterMongoEntryYAML([]byte(bootConfigStr))
+	entry := entries["ut-mongo-change-stream"].(*MongoEntry)
+
+	assert.Equal(t, "tokens", entry.csTokenDb)
+	assert.Equal(t, "resume_tokens", entry.csTokenColl)
+	assert.Equal(t, 10*time.Millisecond, entry.csMinRetryBackoff)
+	assert.Equal(t, 100*time.Millisecond, entry.csMaxRetryBackoff)
+
+	rkentry.GlobalAppCtx.RemoveEntry(entry)
+}
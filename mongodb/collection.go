@@ -0,0 +1,366 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkmongo
+
+import (
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	mongoOpt "go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+	"strconv"
+	"strings"
+)
+
+// BootMongoCollection collection declared under database which would be ensured at Bootstrap
+type BootMongoCollection struct {
+	Name               string `yaml:"name" json:"name"`
+	Capped             bool   `yaml:"capped" json:"capped"`
+	SizeBytes          int64  `yaml:"sizeBytes" json:"sizeBytes"`
+	MaxDocuments       int64  `yaml:"maxDocuments" json:"maxDocuments"`
+	ExpireAfterSeconds *int64 `yaml:"expireAfterSeconds" json:"expireAfterSeconds"`
+	TimeSeries         *struct {
+		TimeField   string `yaml:"timeField" json:"timeField"`
+		MetaField   string `yaml:"metaField" json:"metaField"`
+		Granularity string `yaml:"granularity" json:"granularity"`
+	} `yaml:"timeSeries" json:"timeSeries"`
+	JSONSchema       string `yaml:"jsonSchema" json:"jsonSchema"`
+	ValidationLevel  string `yaml:"validationLevel" json:"validationLevel"`
+	ValidationAction string `yaml:"validationAction" json:"validationAction"`
+	Collation        *struct {
+		Locale          string `yaml:"locale" json:"locale"`
+		CaseLevel       bool   `yaml:"caseLevel" json:"caseLevel"`
+		CaseFirst       string `yaml:"caseFirst" json:"caseFirst"`
+		Strength        int    `yaml:"strength" json:"strength"`
+		NumericOrdering bool   `yaml:"numericOrdering" json:"numericOrdering"`
+	} `yaml:"collation" json:"collation"`
+	Indexes []*BootMongoIndex `yaml:"indexes" json:"indexes"`
+}
+
+// BootMongoIndex index declared under collection
+//
+// Keys are declared as field:type, like userId, createdAt:-1, location:2dsphere, type is 1 if missing.
+// PartialFilter is a document in extended JSON.
+type BootMongoIndex struct {
+	Name               string   `yaml:"name" json:"name"`
+	Keys               []string `yaml:"keys" json:"keys"`
+	Unique             bool     `yaml:"unique" json:"unique"`
+	Sparse             bool     `yaml:"sparse" json:"sparse"`
+	ExpireAfterSeconds *int32   `yaml:"expireAfterSeconds" json:"expireAfterSeconds"`
+	PartialFilter      string   `yaml:"partialFilter" json:"partialFilter"`
+}
+
+type collectionInner struct {
+	name    string
+	opts    *mongoOpt.CreateCollectionOptions
+	indexes []mongo.IndexModel
+}
+
+// existing index returned by listIndexes
+type indexInner struct {
+	Name                    string `bson:"name"`
+	Key                     bson.D `bson:"key"`
+	Unique                  bool   `bson:"unique"`
+	Sparse                  bool   `bson:"sparse"`
+	ExpireAfterSeconds      *int64 `bson:"expireAfterSeconds"`
+	PartialFilterExpression bson.D `bson:"partialFilterExpression"`
+}
+
+// ToCreateCollectionOptions convert BootMongoCollection to options.CreateCollectionOptions
+func ToCreateCollectionOptions(config *BootMongoCollection) (*mongoOpt.CreateCollectionOptions, error) {
+	opt := mongoOpt.CreateCollection()
+
+	if config == nil {
+		return opt, nil
+	}
+
+	if config.Capped {
+		opt.SetCapped(true)
+		opt.SetSizeInBytes(config.SizeBytes)
+		if config.MaxDocuments > 0 {
+			opt.SetMaxDocuments(config.MaxDocuments)
+		}
+	}
+
+	if config.ExpireAfterSeconds != nil {
+		opt.SetExpireAfterSeconds(*config.ExpireAfterSeconds)
+	}
+
+	if config.TimeSeries != nil {
+		ts := mongoOpt.TimeSeries().SetTimeField(config.TimeSeries.TimeField)
+		if len(config.TimeSeries.MetaField) > 0 {
+			ts.SetMetaField(config.TimeSeries.MetaField)
+		}
+		if len(config.TimeSeries.Granularity) > 0 {
+			ts.SetGranularity(config.TimeSeries.Granularity)
+		}
+		opt.SetTimeSeriesOptions(ts)
+	}
+
+	if len(config.JSONSchema) > 0 {
+		schema := bson.D{}
+		if err := bson.UnmarshalExtJSON([]byte(config.JSONSchema), false, &schema); err != nil {
+			return nil, fmt.Errorf("invalid jsonSchema of collection [%s], %v", config.Name, err)
+		}
+		opt.SetValidator(bson.D{{Key: "$jsonSchema", Value: schema}})
+	}
+
+	if len(config.ValidationLevel) > 0 {
+		opt.SetValidationLevel(config.ValidationLevel)
+	}
+
+	if len(config.ValidationAction) > 0 {
+		opt.SetValidationAction(config.ValidationAction)
+	}
+
+	if config.Collation != nil {
+		opt.SetCollation(&mongoOpt.Collation{
+			Locale:          config.Collation.Locale,
+			CaseLevel:       config.Collation.CaseLevel,
+			CaseFirst:       config.Collation.CaseFirst,
+			Strength:        config.Collation.Strength,
+			NumericOrdering: config.Collation.NumericOrdering,
+		})
+	}
+
+	return opt, nil
+}
+
+// ToIndexModel convert BootMongoIndex to mongo.IndexModel, index name would be generated if missing
+func ToIndexModel(config *BootMongoIndex) (mongo.IndexModel, error) {
+	res := mongo.IndexModel{}
+
+	if config == nil || len(config.Keys) < 1 {
+		return res, fmt.Errorf("keys of index is required")
+	}
+
+	keys := bson.D{}
+	for _, k := range config.Keys {
+		field, typ := k, "1"
+		if i := strings.LastIndex(k, ":"); i > 0 {
+			field, typ = k[:i], k[i+1:]
+		}
+
+		if n, err := strconv.Atoi(typ); err == nil {
+			keys = append(keys, bson.E{Key: field, Value: int32(n)})
+		} else {
+			keys = append(keys, bson.E{Key: field, Value: typ})
+		}
+	}
+
+	opt := mongoOpt.Index().SetName(config.Name)
+	if len(config.Name) < 1 {
+		opt.SetName(toIndexName(keys))
+	}
+
+	if config.Unique {
+		opt.SetUnique(true)
+	}
+
+	if config.Sparse {
+		opt.SetSparse(true)
+	}
+
+	if config.ExpireAfterSeconds != nil {
+		opt.SetExpireAfterSeconds(*config.ExpireAfterSeconds)
+	}
+
+	if len(config.PartialFilter) > 0 {
+		filter := bson.D{}
+		if err := bson.UnmarshalExtJSON([]byte(config.PartialFilter), false, &filter); err != nil {
+			return res, fmt.Errorf("invalid partialFilter of index [%s], %v", *opt.Name, err)
+		}
+		opt.SetPartialFilterExpression(filter)
+	}
+
+	res.Keys = keys
+	res.Options = opt
+
+	return res, nil
+}
+
+// ensureCollections creates missing collections and indexes, drift of existing indexes would be logged.
+// Nothing would be created if dryRun is true.
+func (entry *MongoEntry) ensureCollections(ctx context.Context, db *mongo.Database, dryRun bool) error {
+	collList := entry.collections[db.Name()]
+	if len(collList) < 1 {
+		return nil
+	}
+
+	existing, err := db.ListCollectionNames(ctx, bson.D{})
+	if err != nil {
+		return err
+	}
+
+	for _, coll := range collList {
+		fields := []zap.Field{
+			zap.String("database", db.Name()),
+			zap.String("collection", coll.name),
+			zap.Bool("dryRun", dryRun),
+		}
+
+		if !containsString(existing, coll.name) {
+			entry.loggerEntry.Info("Creating missing collection", fields...)
+			if !dryRun {
+				if err := db.CreateCollection(ctx, coll.name, coll.opts); err != nil {
+					return err
+				}
+			}
+		}
+
+		if err := entry.ensureIndexes(ctx, db.Collection(coll.name), coll.indexes, dryRun); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ensureIndexes creates missing indexes and logs drift of existing indexes
+func (entry *MongoEntry) ensureIndexes(ctx context.Context, coll *mongo.Collection, indexes []mongo.IndexModel, dryRun bool) error {
+	if len(indexes) < 1 {
+		return nil
+	}
+
+	existing := make(map[string]*indexInner)
+
+	cursor, err := coll.Indexes().List(ctx)
+	if err != nil {
+		// collection is not created in dry run mode
+		if !dryRun {
+			return err
+		}
+	} else {
+		list := make([]*indexInner, 0)
+		if err := cursor.All(ctx, &list); err != nil {
+			return err
+		}
+		for i := range list {
+			existing[list[i].Name] = list[i]
+		}
+	}
+
+	for _, model := range indexes {
+		// index without name could not be compared, mongo ignores it if exists with the same spec
+		if model.Options == nil || model.Options.Name == nil {
+			if !dryRun {
+				if _, err := coll.Indexes().CreateOne(ctx, model); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		name := *model.Options.Name
+		fields := []zap.Field{
+			zap.String("database", coll.Database().Name()),
+			zap.String("collection", coll.Name()),
+			zap.String("index", name),
+			zap.Bool("dryRun", dryRun),
+		}
+
+		current, ok := existing[name]
+		if !ok {
+			entry.loggerEntry.Info("Creating missing index", fields...)
+			if !dryRun {
+				if _, err := coll.Indexes().CreateOne(ctx, model); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		if diff := diffIndex(current, model); len(diff) > 0 {
+			entry.loggerEntry.Warn("Index drift detected, please recreate index manually",
+				append(fields, zap.Strings("diff", diff))...)
+		}
+	}
+
+	return nil
+}
+
+// diffIndex compares existing index with declared index model
+func diffIndex(current *indexInner, model mongo.IndexModel) []string {
+	res := make([]string, 0)
+	opt := model.Options
+
+	if keys, ok := model.Keys.(bson.D); ok {
+		if want, got := toIndexName(keys), toIndexName(current.Key); want != got {
+			res = append(res, fmt.Sprintf("keys: want %s, got %s", want, got))
+		}
+	}
+
+	if want := opt.Unique != nil && *opt.Unique; want != current.Unique {
+		res = append(res, fmt.Sprintf("unique: want %v, got %v", want, current.Unique))
+	}
+
+	if want := opt.Sparse != nil && *opt.Sparse; want != current.Sparse {
+		res = append(res, fmt.Sprintf("sparse: want %v, got %v", want, current.Sparse))
+	}
+
+	want, got := "none", "none"
+	if opt.ExpireAfterSeconds != nil {
+		want = strconv.Itoa(int(*opt.ExpireAfterSeconds))
+	}
+	if current.ExpireAfterSeconds != nil {
+		got = strconv.FormatInt(*current.ExpireAfterSeconds, 10)
+	}
+	if want != got {
+		res = append(res, fmt.Sprintf("expireAfterSeconds: want %s, got %s", want, got))
+	}
+
+	want, got = "none", "none"
+	if opt.PartialFilterExpression != nil {
+		if bytes, err := bson.MarshalExtJSON(opt.PartialFilterExpression, false, false); err == nil {
+			want = string(bytes)
+		}
+	}
+	if len(current.PartialFilterExpression) > 0 {
+		if bytes, err := bson.MarshalExtJSON(current.PartialFilterExpression, false, false); err == nil {
+			got = string(bytes)
+		}
+	}
+	if want != got {
+		res = append(res, fmt.Sprintf("partialFilter: want %s, got %s", want, got))
+	}
+
+	return res
+}
+
+// toIndexName generates index name the same way as mongo does, like userId_1_createdAt_-1
+func toIndexName(keys bson.D) string {
+	res := make([]string, 0)
+
+	for _, e := range keys {
+		var v string
+		switch t := e.Value.(type) {
+		case int32:
+			v = strconv.Itoa(int(t))
+		case int64:
+			v = strconv.FormatInt(t, 10)
+		case int:
+			v = strconv.Itoa(t)
+		case float64:
+			v = strconv.FormatFloat(t, 'f', -1, 64)
+		default:
+			v = fmt.Sprintf("%v", t)
+		}
+		res = append(res, e.Key+"_"+v)
+	}
+
+	return strings.Join(res, "_")
+}
+
+func containsString(list []string, s string) bool {
+	for i := range list {
+		if list[i] == s {
+			return true
+		}
+	}
+
+	return false
+}
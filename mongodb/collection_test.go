@@ -0,0 +1,165 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkmongo
+
+import (
+	"github.com/rookie-ninja/rk-entry/v2/entry"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"gopkg.in/yaml.v3"
+	"testing"
+)
+
+const collYamlStr = `
+name: "events"
+capped: true
+sizeBytes: 1024
+maxDocuments: 10
+timeSeries:
+  timeField: "ts"
+  metaField: "meta"
+  granularity: "hours"
+jsonSchema: '{"bsonType": "object", "required": ["name"]}'
+validationLevel: "strict"
+validationAction: "error"
+collation:
+  locale: "en"
+  strength: 2
+indexes:
+  - keys: ["userId", "createdAt:-1"]
+    unique: true
+  - name: "ttl"
+    keys: ["expireAt"]
+    expireAfterSeconds: 0
+    sparse: true
+    partialFilter: '{"status": "active"}'
+`
+
+func TestToCreateCollectionOptions(t *testing.T) {
+	// with nil
+	opts, err := ToCreateCollectionOptions(nil)
+	assert.NotNil(t, opts)
+	assert.Nil(t, err)
+
+	// happy case
+	config := &BootMongoCollection{}
+	assert.Nil(t, yaml.Unmarshal([]byte(collYamlStr), config))
+	opts, err = ToCreateCollectionOptions(config)
+	assert.Nil(t, err)
+
+	assert.True(t, *opts.Capped)
+	assert.Equal(t, int64(1024), *opts.SizeInBytes)
+	assert.Equal(t, int64(10), *opts.MaxDocuments)
+	assert.Equal(t, "ts", opts.TimeSeriesOptions.TimeField)
+	assert.Equal(t, "meta", *opts.TimeSeriesOptions.MetaField)
+	assert.Equal(t, "hours", *opts.TimeSeriesOptions.Granularity)
+	assert.NotNil(t, opts.Validator)
+	assert.Equal(t, "strict", *opts.ValidationLevel)
+	assert.Equal(t, "error", *opts.ValidationAction)
+	assert.Equal(t, "en", opts.Collation.Locale)
+	assert.Equal(t, 2, opts.Collation.Strength)
+
+	// invalid json schema
+	config.JSONSchema = "invalid"
+	opts, err = ToCreateCollectionOptions(config)
+	assert.NotNil(t, err)
+	assert.Nil(t, opts)
+}
+
+func TestToIndexModel(t *testing.T) {
+	// with nil
+	_, err := ToIndexModel(nil)
+	assert.NotNil(t, err)
+
+	config := &BootMongoCollection{}
+	assert.Nil(t, yaml.Unmarshal([]byte(collYamlStr), config))
+
+	// generated name
+	model, err := ToIndexModel(config.Indexes[0])
+	assert.Nil(t, err)
+	assert.Equal(t, bson.D{{Key: "userId", Value: int32(1)}, {Key: "createdAt", Value: int32(-1)}}, model.Keys)
+	assert.Equal(t, "userId_1_createdAt_-1", *model.Options.Name)
+	assert.True(t, *model.Options.Unique)
+
+	// TTL with partial filter
+	model, err = ToIndexModel(config.Indexes[1])
+	assert.Nil(t, err)
+	assert.Equal(t, "ttl", *model.Options.Name)
+	assert.Equal(t, int32(0), *model.Options.ExpireAfterSeconds)
+	assert.True(t, *model.Options.Sparse)
+	assert.NotNil(t, model.Options.PartialFilterExpression)
+
+	// invalid partial filter
+	config.Indexes[1].PartialFilter = "invalid"
+	_, err = ToIndexModel(config.Indexes[1])
+	assert.NotNil(t, err)
+}
+
+func TestDiffIndex(t *testing.T) {
+	model, err := ToIndexModel(&BootMongoIndex{
+		Keys:          []string{"location:2dsphere"},
+		Unique:        true,
+		PartialFilter: `{"status": "active"}`,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "location_2dsphere", *model.Options.Name)
+
+	// without drift
+	current := &indexInner{
+		Name:                    "location_2dsphere",
+		Key:                     bson.D{{Key: "location", Value: "2dsphere"}},
+		Unique:                  true,
+		PartialFilterExpression: bson.D{{Key: "status", Value: "active"}},
+	}
+	assert.Empty(t, diffIndex(current, model))
+
+	// with drift
+	ttl := int64(10)
+	current.Unique = false
+	current.ExpireAfterSeconds = &ttl
+	current.PartialFilterExpression = nil
+	assert.Len(t, diffIndex(current, model), 3)
+}
+
+func TestToIndexName(t *testing.T) {
+	assert.Equal(t, "a_1_b_-1_c_text", toIndexName(bson.D{
+		{Key: "a", Value: int32(1)},
+		{Key: "b", Value: float64(-1)},
+		{Key: "c", Value: "text"},
+	}))
+}
+
+func TestRegisterMongoEntryYAML_WithCollections(t *testing.T) {
+	bootConfigStr := `
+mongo:
+  - name: "ut-mongo-collections"
+    enabled: true
+    database:
+      - name: "database"
+        dryRun: true
+        collections:
+          - name: "events"
+            jsonSchema: '{"bsonType": "object"}'
+            indexes:
+              - keys: ["userId", "createdAt:-1"]
+                expireAfterSeconds: 60
+`
+
+	entries := RegisterMongoEntryYAML([]byte(bootConfigStr))
+	entry := entries["ut-mongo-collections"].(*MongoEntry)
+
+	assert.True(t, entry.collectionDryRun["database"])
+	assert.Len(t, entry.collections["database"], 1)
+
+	coll := entry.collections["database"][0]
+	assert.Equal(t, "events", coll.name)
+	assert.NotNil(t, coll.opts.Validator)
+	assert.Len(t, coll.indexes, 1)
+	assert.Equal(t, "userId_1_createdAt_-1", *coll.indexes[0].Options.Name)
+	assert.Equal(t, int32(60), *coll.indexes[0].Options.ExpireAfterSeconds)
+
+	rkentry.GlobalAppCtx.RemoveEntry(entry)
+}
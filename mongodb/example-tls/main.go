@@ -3,7 +3,6 @@ package main
 import (
 	"context"
 	"embed"
-	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/rookie-ninja/rk-boot/v2"
 	"github.com/rookie-ninja/rk-db/mongodb"
@@ -12,7 +11,6 @@ import (
 	"github.com/rs/xid"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 	"net/http"
 )
 
@@ -27,14 +25,6 @@ func init() {
 	rkentry.GlobalAppCtx.AddEmbedFS(rkentry.CertEntryType, "my-cert", &certsFS)
 }
 
-func createCollection(db *mongo.Database, name string) {
-	opts := options.CreateCollection()
-	err := db.CreateCollection(context.TODO(), name, opts)
-	if err != nil {
-		fmt.Println("collection exists may be, continue")
-	}
-}
-
 func main() {
 	boot := rkboot.NewBoot()
 
@@ -42,7 +32,6 @@ func main() {
 
 	// Auto migrate database and init global userDb variable
 	db := rkmongo.GetMongoDB("my-mongo", "users")
-	createCollection(db, "meta")
 
 	userCollection = db.Collection("meta")
 
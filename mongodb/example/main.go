@@ -11,7 +11,6 @@ import (
 	"github.com/rs/xid"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 	"net/http"
 )
 
@@ -19,14 +18,6 @@ var (
 	userCollection *mongo.Collection
 )
 
-func createCollection(db *mongo.Database, name string) {
-	opts := options.CreateCollection()
-	err := db.CreateCollection(context.TODO(), name, opts)
-	if err != nil {
-		fmt.Println("collection exists may be, continue")
-	}
-}
-
 func main() {
 	boot := rkboot.NewBoot()
 
@@ -34,7 +25,6 @@ func main() {
 
 	// Auto migrate database and init global userDb variable
 	db := rkmongo.GetMongoDB("my-mongo", "users")
-	createCollection(db, "meta")
 
 	userCollection = db.Collection("meta")
 
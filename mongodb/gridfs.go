@@ -0,0 +1,201 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkmongo
+
+import (
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	mongoOpt "go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"io"
+)
+
+// BootMongoBucket GridFS bucket declared under database which would be created at Bootstrap
+type BootMongoBucket struct {
+	Name           string                 `yaml:"name" json:"name"`
+	ChunkSizeBytes int32                  `yaml:"chunkSizeBytes" json:"chunkSizeBytes"`
+	WriteConcern   *BootMongoWriteConcern `yaml:"writeConcern" json:"writeConcern"`
+}
+
+type bucketInner struct {
+	name   string
+	opts   *mongoOpt.BucketOptions
+	bucket *gridfs.Bucket
+}
+
+// ToBucketOptions convert BootMongoBucket to options.BucketOptions
+func ToBucketOptions(config *BootMongoBucket) *mongoOpt.BucketOptions {
+	opt := mongoOpt.GridFSBucket()
+
+	if config == nil {
+		return opt
+	}
+
+	if len(config.Name) > 0 {
+		opt.SetName(config.Name)
+	}
+
+	if config.ChunkSizeBytes > 0 {
+		opt.SetChunkSizeBytes(config.ChunkSizeBytes)
+	}
+
+	if config.WriteConcern != nil {
+		opt.SetWriteConcern(ToWriteConcern(config.WriteConcern))
+	}
+
+	return opt
+}
+
+// GetBucket returns gridfs.Bucket of database created at Bootstrap.
+//
+// Deadline of returned bucket is shared, please use UploadFromStream and DownloadToStream
+// of MongoEntry if deadline is required.
+func (entry *MongoEntry) GetBucket(dbName, bucketName string) *gridfs.Bucket {
+	if inner := entry.getBucketInner(dbName, bucketName); inner != nil {
+		return inner.bucket
+	}
+
+	return nil
+}
+
+// UploadFromStream uploads file to bucket from source with deadline of ctx,
+// upload would be aborted if ctx is canceled. A span would be created if tracer exists in context.
+func (entry *MongoEntry) UploadFromStream(ctx context.Context, dbName, bucketName, filename string,
+	source io.Reader, opts ...*mongoOpt.UploadOptions) (primitive.ObjectID, error) {
+	_, span := getTracer(ctx).Start(ctx, "mongo.gridfs.upload")
+	span.SetAttributes(
+		attribute.String("db.system", "mongodb"),
+		attribute.String("db.name", dbName),
+		attribute.String("db.mongodb.bucket", bucketName),
+		attribute.String("db.mongodb.filename", filename),
+	)
+	defer span.End()
+
+	bucket, err := entry.newBucket(ctx, dbName, bucketName)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return primitive.NilObjectID, err
+	}
+
+	src := &ctxReader{ctx: ctx, delegate: source}
+	id, err := bucket.UploadFromStream(filename, src, opts...)
+	span.SetAttributes(attribute.Int64("db.mongodb.bytes", src.n))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return id, err
+	}
+	span.SetAttributes(attribute.String("db.mongodb.file_id", id.Hex()))
+
+	return id, nil
+}
+
+// DownloadToStream downloads file from bucket to dest with deadline of ctx,
+// download would be stopped if ctx is canceled. A span would be created if tracer exists in context.
+func (entry *MongoEntry) DownloadToStream(ctx context.Context, dbName, bucketName string,
+	fileID interface{}, dest io.Writer) (int64, error) {
+	_, span := getTracer(ctx).Start(ctx, "mongo.gridfs.download")
+	span.SetAttributes(
+		attribute.String("db.system", "mongodb"),
+		attribute.String("db.name", dbName),
+		attribute.String("db.mongodb.bucket", bucketName),
+		attribute.String("db.mongodb.file_id", fmt.Sprintf("%v", fileID)),
+	)
+	defer span.End()
+
+	bucket, err := entry.newBucket(ctx, dbName, bucketName)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return 0, err
+	}
+
+	n, err := bucket.DownloadToStream(fileID, &ctxWriter{ctx: ctx, delegate: dest})
+	span.SetAttributes(attribute.Int64("db.mongodb.bytes", n))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	return n, err
+}
+
+// newBucket creates gridfs.Bucket with the same options as declared one, since deadline is state of bucket
+func (entry *MongoEntry) newBucket(ctx context.Context, dbName, bucketName string) (*gridfs.Bucket, error) {
+	inner := entry.getBucketInner(dbName, bucketName)
+	if inner == nil {
+		return nil, fmt.Errorf("bucket [%s] of database [%s] not found in entry [%s]", bucketName, dbName, entry.entryName)
+	}
+
+	db := entry.GetMongoDB(dbName)
+	if db == nil {
+		if entry.Client == nil {
+			return nil, fmt.Errorf("mongo client of entry [%s] is not initialized, please call Bootstrap first", entry.entryName)
+		}
+		db = entry.Client.Database(dbName)
+	}
+
+	bucket, err := gridfs.NewBucket(db, inner.opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := bucket.SetWriteDeadline(deadline); err != nil {
+			return nil, err
+		}
+		if err := bucket.SetReadDeadline(deadline); err != nil {
+			return nil, err
+		}
+	}
+
+	return bucket, nil
+}
+
+func (entry *MongoEntry) getBucketInner(dbName, bucketName string) *bucketInner {
+	for _, inner := range entry.buckets[dbName] {
+		if inner.name == bucketName {
+			return inner
+		}
+	}
+
+	return nil
+}
+
+// ctxReader stops reading once ctx is done
+type ctxReader struct {
+	ctx      context.Context
+	delegate io.Reader
+	n        int64
+}
+
+func (r *ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	n, err := r.delegate.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// ctxWriter stops writing once ctx is done
+type ctxWriter struct {
+	ctx      context.Context
+	delegate io.Writer
+}
+
+func (w *ctxWriter) Write(p []byte) (int, error) {
+	if err := w.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return w.delegate.Write(p)
+}
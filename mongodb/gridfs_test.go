@@ -0,0 +1,133 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkmongo
+
+import (
+	"bytes"
+	"context"
+	"github.com/rookie-ninja/rk-entry/v2/entry"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	mongoOpt "go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+	"testing"
+	"time"
+)
+
+func TestToBucketOptions(t *testing.T) {
+	// with nil
+	opt := ToBucketOptions(nil)
+	assert.Equal(t, mongoOpt.DefaultName, *opt.Name)
+
+	// happy case
+	opt = ToBucketOptions(&BootMongoBucket{
+		Name:           "attachments",
+		ChunkSizeBytes: 1024,
+		WriteConcern:   &BootMongoWriteConcern{W: "majority"},
+	})
+	assert.Equal(t, "attachments", *opt.Name)
+	assert.Equal(t, int32(1024), *opt.ChunkSizeBytes)
+	assert.Equal(t, writeconcern.New(writeconcern.WMajority()), opt.WriteConcern)
+}
+
+func TestWithBucket(t *testing.T) {
+	entry := RegisterMongoEntry(
+		WithBucket("database", nil),
+		WithBucket("database", mongoOpt.GridFSBucket().SetName("attachments")),
+		WithBucket("database", mongoOpt.GridFSBucket().SetName("attachments").SetChunkSizeBytes(1024)))
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	assert.Len(t, entry.buckets["database"], 2)
+	assert.Equal(t, mongoOpt.DefaultName, entry.buckets["database"][0].name)
+	assert.Equal(t, int32(1024), *entry.getBucketInner("database", "attachments").opts.ChunkSizeBytes)
+
+	// not bootstrapped
+	assert.Nil(t, entry.GetBucket("database", "attachments"))
+	assert.Nil(t, entry.GetBucket("database", "not-exist"))
+}
+
+func TestMongoEntry_UploadFromStream(t *testing.T) {
+	entry := RegisterMongoEntry(WithDatabase("database"), WithBucket("database", nil))
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	// bucket not found
+	_, err := entry.UploadFromStream(context.TODO(), "database", "not-exist", "file", bytes.NewBufferString("ut"))
+	assert.NotNil(t, err)
+
+	// not bootstrapped
+	_, err = entry.UploadFromStream(context.TODO(), "database", mongoOpt.DefaultName, "file", bytes.NewBufferString("ut"))
+	assert.NotNil(t, err)
+
+	// bucket with deadline of ctx
+	client, err := mongo.NewClient(entry.Opts)
+	assert.Nil(t, err)
+	entry.Client = client
+
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second)
+	defer cancel()
+	bucket, err := entry.newBucket(ctx, "database", mongoOpt.DefaultName)
+	assert.Nil(t, err)
+	assert.NotNil(t, bucket)
+}
+
+func TestMongoEntry_DownloadToStream(t *testing.T) {
+	entry := RegisterMongoEntry(WithDatabase("database"), WithBucket("database", nil))
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	// bucket not found
+	n, err := entry.DownloadToStream(context.TODO(), "database", "not-exist", primitive.NewObjectID(), &bytes.Buffer{})
+	assert.NotNil(t, err)
+	assert.Zero(t, n)
+}
+
+func TestCtxReaderWriter(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+
+	reader := &ctxReader{ctx: ctx, delegate: bytes.NewBufferString("ut")}
+	buf := make([]byte, 1)
+	n, err := reader.Read(buf)
+	assert.Equal(t, 1, n)
+	assert.Nil(t, err)
+
+	writer := &ctxWriter{ctx: ctx, delegate: &bytes.Buffer{}}
+	n, err = writer.Write([]byte("ut"))
+	assert.Equal(t, 2, n)
+	assert.Nil(t, err)
+
+	// canceled
+	cancel()
+	_, err = reader.Read(buf)
+	assert.Equal(t, context.Canceled, err)
+	_, err = writer.Write([]byte("ut"))
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, int64(1), reader.n)
+}
+
+func TestRegisterMongoEntryYAML_WithBuckets(t *testing.T) {
+	bootConfigStr := `
+mongo:
+  - name: "ut-mongo-buckets"
+    enabled: true
+    database:
+      - name: "database"
+        buckets:
+          - name: "attachments"
+            chunkSizeBytes: 1024
+            writeConcern:
+              w: "1"
+`
+
+	entries := RegisterMongoEntryYAML([]byte(bootConfigStr))
+	entry := entries["ut-mongo-buckets"].(*MongoEntry)
+
+	inner := entry.getBucketInner("database", "attachments")
+	assert.NotNil(t, inner)
+	assert.Equal(t, int32(1024), *inner.opts.ChunkSizeBytes)
+	assert.Equal(t, writeconcern.New(writeconcern.W(1)), inner.opts.WriteConcern)
+
+	rkentry.GlobalAppCtx.RemoveEntry(entry)
+}
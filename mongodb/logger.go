@@ -0,0 +1,276 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkmongo
+
+import (
+	"context"
+	"fmt"
+	"github.com/rookie-ninja/rk-entry/v2/middleware"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/event"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LogLevel of Logger
+type LogLevel int
+
+const (
+	// Silent logs nothing
+	Silent LogLevel = iota + 1
+	// Error logs failed commands
+	Error
+	// Warn logs failed and slow commands
+	Warn
+	// Debug logs all commands at info level of zap logger
+	Debug
+)
+
+const redactedValue = "?"
+
+var (
+	traceStr     = "[%.3fms] [%s.%s] %s"
+	traceWarnStr = "%s\t[%.3fms] [%s.%s] %s"
+	traceErrStr  = "%s\t[%.3fms] [%s.%s] %s"
+)
+
+// ToLogLevel converts string to LogLevel, one of debug, warn, error and silent, Warn would be returned if not matched
+func ToLogLevel(level string) LogLevel {
+	switch strings.ToLower(level) {
+	case "debug":
+		return Debug
+	case "error":
+		return Error
+	case "silent":
+		return Silent
+	default:
+		return Warn
+	}
+}
+
+// Logger logs mongo commands with event.CommandMonitor, values in command document are redacted
+type Logger struct {
+	delegate      *zap.Logger
+	SlowThreshold time.Duration
+	LogLevel      LogLevel
+	started       sync.Map
+}
+
+type startedCommand struct {
+	database string
+	name     string
+	// command is copied by driver before published, it is redacted only if logged
+	command bson.Raw
+}
+
+// NewLogger creates Logger with zap.Logger
+func NewLogger(delegate *zap.Logger, level LogLevel, slowThreshold time.Duration) *Logger {
+	return &Logger{
+		delegate:      delegate,
+		LogLevel:      level,
+		SlowThreshold: slowThreshold,
+	}
+}
+
+// NewMonitor returns event.CommandMonitor which logs commands
+func (l *Logger) NewMonitor() *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Started:   l.Started,
+		Succeeded: l.Succeeded,
+		Failed:    l.Failed,
+	}
+}
+
+// Started records command which would be logged after finished
+func (l *Logger) Started(ctx context.Context, e *event.CommandStartedEvent) {
+	if l.LogLevel <= Silent {
+		return
+	}
+
+	l.started.Store(startedKey(e.ConnectionID, e.RequestID), &startedCommand{
+		database: e.DatabaseName,
+		name:     e.CommandName,
+		command:  e.Command,
+	})
+}
+
+// Succeeded logs command if slow or LogLevel is Debug
+func (l *Logger) Succeeded(ctx context.Context, e *event.CommandSucceededEvent) {
+	l.trace(ctx, &e.CommandFinishedEvent, "")
+}
+
+// Failed logs failed command
+func (l *Logger) Failed(ctx context.Context, e *event.CommandFailedEvent) {
+	l.trace(ctx, &e.CommandFinishedEvent, e.Failure)
+}
+
+func (l *Logger) trace(ctx context.Context, e *event.CommandFinishedEvent, failure string) {
+	v, ok := l.started.LoadAndDelete(startedKey(e.ConnectionID, e.RequestID))
+	if !ok {
+		return
+	}
+	cmd := v.(*startedCommand)
+
+	logger := l.getLogger(ctx)
+	elapsed := time.Duration(e.DurationNanos)
+	elapsedMs := float64(elapsed.Nanoseconds()) / 1e6
+
+	switch {
+	case len(failure) > 0 && l.LogLevel >= Error:
+		logger.Error(fmt.Sprintf(traceErrStr, failure, elapsedMs, cmd.database, cmd.name, l.format(cmd.command)))
+	case elapsed > l.SlowThreshold && l.SlowThreshold != 0 && l.LogLevel >= Warn:
+		slowLog := fmt.Sprintf("SLOW COMMAND >= %v", l.SlowThreshold)
+		logger.Warn(fmt.Sprintf(traceWarnStr, slowLog, elapsedMs, cmd.database, cmd.name, l.format(cmd.command)))
+	case l.LogLevel >= Debug:
+		// zap logger of loggerEntry is at info level by default, same as gorm logger of SQL entries
+		logger.Info(fmt.Sprintf(traceStr, elapsedMs, cmd.database, cmd.name, l.format(cmd.command)))
+	}
+}
+
+func (l *Logger) getLogger(ctx context.Context) *zap.Logger {
+	logger := l.delegate
+
+	if ctx != nil {
+		if v := ctx.Value(rkmid.LoggerKey.String()); v != nil {
+			if loggerFromCtx, ok := v.(*zap.Logger); ok {
+				logger = loggerFromCtx
+			}
+		}
+	}
+
+	return logger
+}
+
+// format redacts and trims command
+func (l *Logger) format(command bson.Raw) string {
+	return l.trimMessage(redactCommand(command))
+}
+
+func (l *Logger) trimMessage(msg string) string {
+	if len(msg) > 200 {
+		msg = msg[:200] + "..."
+	}
+
+	return msg
+}
+
+func startedKey(connId string, requestId int64) string {
+	return fmt.Sprintf("%s/%d", connId, requestId)
+}
+
+// redactCommand converts command document to extended JSON with all values redacted except command name,
+// like {"find": "users", "filter": {"name": "?"}}
+func redactCommand(raw bson.Raw) string {
+	elems, err := raw.Elements()
+	if err != nil || len(elems) < 1 {
+		return "{}"
+	}
+
+	doc := bson.D{}
+	for i, elem := range elems {
+		// value of first element is the collection or 1
+		if i == 0 {
+			doc = append(doc, bson.E{Key: elem.Key(), Value: elem.Value()})
+			continue
+		}
+
+		// skip metadata added by driver
+		if strings.HasPrefix(elem.Key(), "$") || elem.Key() == "lsid" || elem.Key() == "txnNumber" {
+			continue
+		}
+
+		doc = append(doc, bson.E{Key: elem.Key(), Value: redactValue(elem.Value())})
+	}
+
+	bytes, err := bson.MarshalExtJSON(doc, false, false)
+	if err != nil {
+		return "{}"
+	}
+
+	return string(bytes)
+}
+
+// redactValue keeps structure of document and array, scalars are replaced with ?
+func redactValue(val bson.RawValue) interface{} {
+	switch val.Type {
+	case bsontype.EmbeddedDocument:
+		elems, err := val.Document().Elements()
+		if err != nil {
+			return redactedValue
+		}
+		res := bson.D{}
+		for _, elem := range elems {
+			res = append(res, bson.E{Key: elem.Key(), Value: redactValue(elem.Value())})
+		}
+		return res
+	case bsontype.Array:
+		values, err := val.Array().Values()
+		if err != nil {
+			return redactedValue
+		}
+		res := bson.A{}
+		for i := range values {
+			res = append(res, redactValue(values[i]))
+		}
+		return res
+	default:
+		return redactedValue
+	}
+}
+
+// chainMonitor calls both of monitors
+func chainMonitor(first, second *event.CommandMonitor) *event.CommandMonitor {
+	if first == nil {
+		return second
+	}
+
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			if first.Started != nil {
+				first.Started(ctx, e)
+			}
+			if second.Started != nil {
+				second.Started(ctx, e)
+			}
+		},
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			if first.Succeeded != nil {
+				first.Succeeded(ctx, e)
+			}
+			if second.Succeeded != nil {
+				second.Succeeded(ctx, e)
+			}
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			if first.Failed != nil {
+				first.Failed(ctx, e)
+			}
+			if second.Failed != nil {
+				second.Failed(ctx, e)
+			}
+		},
+	}
+}
+
+func toAbsPath(p ...string) []string {
+	res := make([]string, 0)
+
+	for i := range p {
+		if filepath.IsAbs(filepath.ToSlash(p[i])) || p[i] == "stdout" || p[i] == "stderr" {
+			res = append(res, p[i])
+			continue
+		}
+		wd, _ := os.Getwd()
+		res = append(res, filepath.ToSlash(filepath.Join(wd, p[i])))
+	}
+
+	return res
+}
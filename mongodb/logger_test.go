@@ -0,0 +1,148 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkmongo
+
+import (
+	"context"
+	"github.com/rookie-ninja/rk-entry/v2/entry"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"testing"
+	"time"
+)
+
+func TestToLogLevel(t *testing.T) {
+	assert.Equal(t, Debug, ToLogLevel("debug"))
+	assert.Equal(t, Warn, ToLogLevel("warn"))
+	assert.Equal(t, Error, ToLogLevel("ERROR"))
+	assert.Equal(t, Silent, ToLogLevel("silent"))
+	assert.Equal(t, Warn, ToLogLevel(""))
+}
+
+func TestRedactCommand(t *testing.T) {
+	raw, err := bson.Marshal(bson.D{
+		{Key: "find", Value: "users"},
+		{Key: "filter", Value: bson.D{
+			{Key: "name", Value: "secret"},
+			{Key: "age", Value: bson.D{{Key: "$in", Value: bson.A{1, 2}}}},
+		}},
+		{Key: "limit", Value: 10},
+		{Key: "lsid", Value: bson.D{{Key: "id", Value: "id"}}},
+		{Key: "$db", Value: "database"},
+	})
+	assert.Nil(t, err)
+
+	assert.Equal(t,
+		`{"find":"users","filter":{"name":"?","age":{"$in":["?","?"]}},"limit":"?"}`,
+		redactCommand(raw))
+
+	// empty document
+	assert.Equal(t, "{}", redactCommand(nil))
+}
+
+func TestLogger_NewMonitor(t *testing.T) {
+	// level of zap logger follows default logger entry
+	core, logs := observer.New(rkentry.GlobalAppCtx.GetLoggerEntryDefault().Logger.Core())
+	logger := NewLogger(zap.New(core), Warn, 10*time.Millisecond)
+	monitor := logger.NewMonitor()
+
+	raw, _ := bson.Marshal(bson.D{{Key: "find", Value: "users"}, {Key: "filter", Value: bson.D{{Key: "name", Value: "secret"}}}})
+	start := func(id int64) {
+		monitor.Started(context.TODO(), &event.CommandStartedEvent{
+			Command:      raw,
+			DatabaseName: "database",
+			CommandName:  "find",
+			RequestID:    id,
+			ConnectionID: "conn",
+		})
+	}
+	finished := func(id int64, elapsed time.Duration) event.CommandFinishedEvent {
+		return event.CommandFinishedEvent{
+			DurationNanos: elapsed.Nanoseconds(),
+			CommandName:   "find",
+			RequestID:     id,
+			ConnectionID:  "conn",
+		}
+	}
+
+	// fast command, command is not redacted until logged
+	start(1)
+	v, ok := logger.started.Load(startedKey("conn", 1))
+	assert.True(t, ok)
+	assert.Equal(t, bson.Raw(raw), v.(*startedCommand).command)
+	monitor.Succeeded(context.TODO(), &event.CommandSucceededEvent{CommandFinishedEvent: finished(1, time.Millisecond)})
+	assert.Equal(t, 0, logs.Len())
+
+	// slow command
+	start(2)
+	monitor.Succeeded(context.TODO(), &event.CommandSucceededEvent{CommandFinishedEvent: finished(2, time.Second)})
+	assert.Equal(t, 1, logs.FilterLevelExact(zapcore.WarnLevel).Len())
+	assert.NotContains(t, logs.All()[0].Message, "secret")
+	assert.Contains(t, logs.All()[0].Message, "database.find")
+
+	// failed command
+	start(3)
+	monitor.Failed(context.TODO(), &event.CommandFailedEvent{CommandFinishedEvent: finished(3, time.Millisecond), Failure: "ut-failure"})
+	assert.Equal(t, 1, logs.FilterLevelExact(zapcore.ErrorLevel).Len())
+
+	// debug level
+	logger.LogLevel = Debug
+	start(4)
+	monitor.Succeeded(context.TODO(), &event.CommandSucceededEvent{CommandFinishedEvent: finished(4, time.Millisecond)})
+	assert.Equal(t, 1, logs.FilterLevelExact(zapcore.InfoLevel).Len())
+	assert.NotContains(t, logs.All()[2].Message, "secret")
+
+	// silent level
+	logger.LogLevel = Silent
+	start(5)
+	monitor.Failed(context.TODO(), &event.CommandFailedEvent{CommandFinishedEvent: finished(5, time.Second), Failure: "ut-failure"})
+	assert.Equal(t, 3, logs.Len())
+}
+
+func TestChainMonitor(t *testing.T) {
+	second := &event.CommandMonitor{}
+	assert.Equal(t, second, chainMonitor(nil, second))
+
+	calls := 0
+	first := &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			calls++
+		},
+	}
+	second.Started = first.Started
+
+	monitor := chainMonitor(first, second)
+	monitor.Started(context.TODO(), &event.CommandStartedEvent{})
+	monitor.Succeeded(context.TODO(), &event.CommandSucceededEvent{})
+	monitor.Failed(context.TODO(), &event.CommandFailedEvent{})
+	assert.Equal(t, 2, calls)
+}
+
+func TestRegisterMongoEntryYAML_WithLogger(t *testing.T) {
+	bootConfigStr := `
+mongo:
+  - name: "ut-mongo-logger"
+    enabled: true
+    logger:
+      level: "debug"
+      slowThresholdMs: 100
+      encoding: "json"
+      outputPaths: ["stdout"]
+`
+
+	entries := RegisterMongoEntryYAML([]byte(bootConfigStr))
+	entry := entries["ut-mongo-logger"].(*MongoEntry)
+
+	assert.Equal(t, Debug, entry.logger.LogLevel)
+	assert.Equal(t, 100*time.Millisecond, entry.logger.SlowThreshold)
+	assert.NotNil(t, entry.logger.delegate)
+
+	rkentry.GlobalAppCtx.RemoveEntry(entry)
+}
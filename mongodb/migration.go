@@ -0,0 +1,291 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkmongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	mongoOpt "go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// MigrationCollection records applied migrations and lock of migration
+	MigrationCollection = "_rk_migrations"
+
+	migrationLockId = "lock"
+)
+
+// Migration is a versioned migration of database which would be applied in order at Bootstrap
+type Migration struct {
+	Version     int64
+	Description string
+	Up          func(ctx context.Context, db *mongo.Database) error
+}
+
+type migrationRecord struct {
+	Version     int64     `bson:"_id"`
+	Description string    `bson:"description"`
+	AppliedAt   time.Time `bson:"appliedAt"`
+}
+
+// NewMigrationFromJSON creates Migration which runs commands in extended JSON array with Database.RunCommand
+//
+// Example:
+// [{"update": "users", "updates": [{"q": {}, "u": {"$set": {"active": true}}, "multi": true}]}]
+func NewMigrationFromJSON(version int64, description string, raw []byte) (*Migration, error) {
+	wrapper := struct {
+		Commands []bson.D `bson:"commands"`
+	}{}
+
+	doc := append(append([]byte(`{"commands":`), raw...), '}')
+	if err := bson.UnmarshalExtJSON(doc, false, &wrapper); err != nil {
+		return nil, fmt.Errorf("invalid migration script of version %d, %v", version, err)
+	}
+
+	return &Migration{
+		Version:     version,
+		Description: description,
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			for i := range wrapper.Commands {
+				if err := db.RunCommand(ctx, wrapper.Commands[i]).Err(); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}, nil
+}
+
+// LoadMigrationsFromDir creates Migration from JSON scripts in directory.
+// Script should be named as <version>_<description>.json, like 0001_add_active_to_users.json
+func LoadMigrationsFromDir(dir string) ([]*Migration, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*Migration, 0)
+	for _, f := range files {
+		if f.IsDir() || filepath.Ext(f.Name()) != ".json" {
+			continue
+		}
+
+		name := strings.TrimSuffix(f.Name(), ".json")
+		tokens := strings.SplitN(name, "_", 2)
+		version, err := strconv.ParseInt(tokens[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version of migration script %s", f.Name())
+		}
+
+		description := ""
+		if len(tokens) > 1 {
+			description = tokens[1]
+		}
+
+		raw, err := os.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m, err := NewMigrationFromJSON(version, description, raw)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, m)
+	}
+
+	return res, nil
+}
+
+// migrate applies migrations of database in order of version, applied migrations would be skipped.
+// A lock document is used to make sure only one process applies migrations at the same time.
+func (entry *MongoEntry) migrate(ctx context.Context, db *mongo.Database, migrations []*Migration) error {
+	if len(migrations) < 1 {
+		return nil
+	}
+
+	sorted := make([]*Migration, len(migrations))
+	copy(sorted, migrations)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Version < sorted[j].Version
+	})
+
+	for i := range sorted {
+		if sorted[i].Up == nil {
+			return fmt.Errorf("missing Up() of migration version %d", sorted[i].Version)
+		}
+		if i > 0 && sorted[i].Version == sorted[i-1].Version {
+			return fmt.Errorf("duplicate migration version %d", sorted[i].Version)
+		}
+	}
+
+	coll := db.Collection(MigrationCollection)
+	owner := primitive.NewObjectID().Hex()
+
+	if err := entry.lockMigration(ctx, coll, owner); err != nil {
+		return err
+	}
+	defer entry.unlockMigration(coll, owner)
+
+	// renew lease while migrating, migrations are stopped if lock is taken by others
+	var lost int32
+	ctx, cancel := context.WithCancel(ctx)
+	renewDone := make(chan struct{})
+	go func() {
+		defer close(renewDone)
+		if !entry.renewMigrationLock(ctx, coll, owner) {
+			atomic.StoreInt32(&lost, 1)
+			cancel()
+		}
+	}()
+	defer func() {
+		cancel()
+		<-renewDone
+	}()
+
+	// read applied versions after lock acquired since other process may applied migrations
+	applied := make(map[int64]bool)
+	cursor, err := coll.Find(ctx, bson.M{"_id": bson.M{"$ne": migrationLockId}})
+	if err != nil {
+		return err
+	}
+	records := make([]*migrationRecord, 0)
+	if err := cursor.All(ctx, &records); err != nil {
+		return err
+	}
+	for i := range records {
+		applied[records[i].Version] = true
+	}
+
+	for _, m := range sorted {
+		if applied[m.Version] {
+			continue
+		}
+
+		if atomic.LoadInt32(&lost) == 1 {
+			return errors.New("migration lock is lost")
+		}
+
+		fields := []zap.Field{
+			zap.String("database", db.Name()),
+			zap.Int64("version", m.Version),
+			zap.String("description", m.Description),
+		}
+
+		entry.loggerEntry.Info("Applying migration", fields...)
+		if err := m.Up(ctx, db); err != nil {
+			entry.loggerEntry.Error("Applying migration failed", append(fields, zap.Error(err))...)
+			return err
+		}
+
+		if atomic.LoadInt32(&lost) == 1 {
+			return fmt.Errorf("migration lock is lost while applying version %d", m.Version)
+		}
+
+		if _, err := coll.InsertOne(ctx, &migrationRecord{
+			Version:     m.Version,
+			Description: m.Description,
+			AppliedAt:   time.Now(),
+		}); err != nil {
+			return err
+		}
+		entry.loggerEntry.Info("Applying migration success", fields...)
+	}
+
+	return nil
+}
+
+// lockMigration waits until lock document is acquired or migrationLockTimeout reached.
+// Lock expires after migrationLockLease in case of process crashed without releasing it.
+func (entry *MongoEntry) lockMigration(ctx context.Context, coll *mongo.Collection, owner string) error {
+	deadline := time.Now().Add(entry.migrationLockTimeout)
+
+	for {
+		now := time.Now()
+		filter := bson.M{
+			"_id": migrationLockId,
+			"$or": bson.A{
+				bson.M{"owner": owner},
+				bson.M{"expireAt": bson.M{"$lt": now}},
+			},
+		}
+		update := bson.M{
+			"$set": bson.M{"owner": owner, "expireAt": now.Add(entry.migrationLockLease)},
+		}
+
+		_, err := coll.UpdateOne(ctx, filter, update, mongoOpt.Update().SetUpsert(true))
+		if err == nil {
+			return nil
+		}
+
+		// lock is held by others if upsert failed with duplicate key
+		if !mongo.IsDuplicateKeyError(err) {
+			return err
+		}
+
+		if now.After(deadline) {
+			return errors.New("timeout while waiting for migration lock")
+		}
+
+		entry.loggerEntry.Info("Waiting for migration lock", zap.String("collection", coll.Name()))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// renewMigrationLock extends lease of lock owned by owner periodically until ctx done,
+// false would be returned if lock is not owned by owner anymore.
+func (entry *MongoEntry) renewMigrationLock(ctx context.Context, coll *mongo.Collection, owner string) bool {
+	ticker := time.NewTicker(entry.migrationLockLease / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return true
+		case <-ticker.C:
+		}
+
+		res, err := coll.UpdateOne(ctx,
+			bson.M{"_id": migrationLockId, "owner": owner},
+			bson.M{"$set": bson.M{"expireAt": time.Now().Add(entry.migrationLockLease)}})
+		if err != nil {
+			if ctx.Err() != nil {
+				return true
+			}
+			// lease is still valid until expireAt, try again at next tick
+			entry.loggerEntry.Warn("Renewing migration lock failed", zap.Error(err))
+			continue
+		}
+
+		if res.MatchedCount < 1 {
+			entry.loggerEntry.Error("Migration lock is taken by others", zap.String("collection", coll.Name()))
+			return false
+		}
+	}
+}
+
+// unlockMigration releases lock document owned by owner
+func (entry *MongoEntry) unlockMigration(coll *mongo.Collection, owner string) {
+	if _, err := coll.DeleteOne(context.Background(), bson.M{"_id": migrationLockId, "owner": owner}); err != nil {
+		entry.loggerEntry.Warn("Releasing migration lock failed", zap.Error(err))
+	}
+}
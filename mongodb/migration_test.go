@@ -0,0 +1,180 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkmongo
+
+import (
+	"context"
+	"github.com/rookie-ninja/rk-entry/v2/entry"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestNewMigrationFromJSON(t *testing.T) {
+	// happy case
+	m, err := NewMigrationFromJSON(1, "desc", []byte(`[{"create": "users"}, {"drop": "legacy"}]`))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), m.Version)
+	assert.Equal(t, "desc", m.Description)
+	assert.NotNil(t, m.Up)
+
+	// invalid script
+	m, err = NewMigrationFromJSON(1, "desc", []byte(`{"create": "users"}`))
+	assert.NotNil(t, err)
+	assert.Nil(t, m)
+}
+
+func TestLoadMigrationsFromDir(t *testing.T) {
+	// missing dir
+	_, err := LoadMigrationsFromDir(path.Join(t.TempDir(), "not-exist"))
+	assert.NotNil(t, err)
+
+	// happy case
+	dir := t.TempDir()
+	assert.Nil(t, ioutil.WriteFile(path.Join(dir, "0002_drop_legacy.json"), []byte(`[{"drop": "legacy"}]`), os.ModePerm))
+	assert.Nil(t, ioutil.WriteFile(path.Join(dir, "0001.json"), []byte(`[{"create": "users"}]`), os.ModePerm))
+	assert.Nil(t, ioutil.WriteFile(path.Join(dir, "README.md"), []byte(`ignored`), os.ModePerm))
+
+	migrations, err := LoadMigrationsFromDir(dir)
+	assert.Nil(t, err)
+	assert.Len(t, migrations, 2)
+	assert.Equal(t, int64(1), migrations[0].Version)
+	assert.Equal(t, int64(2), migrations[1].Version)
+	assert.Equal(t, "drop_legacy", migrations[1].Description)
+
+	// invalid version
+	assert.Nil(t, ioutil.WriteFile(path.Join(dir, "first.json"), []byte(`[]`), os.ModePerm))
+	_, err = LoadMigrationsFromDir(dir)
+	assert.NotNil(t, err)
+}
+
+func TestMongoEntry_migrate(t *testing.T) {
+	up := func(ctx context.Context, db *mongo.Database) error {
+		return nil
+	}
+
+	entry := RegisterMongoEntry(
+		WithMigration("database", &Migration{Version: 1, Up: up}, nil),
+		WithMigrationLockTimeoutMs(100))
+	entry.AddMigration("database", &Migration{Version: 2, Up: up})
+	assert.Len(t, entry.migrations["database"], 2)
+
+	// duplicate version
+	assert.NotNil(t, entry.migrate(context.TODO(), nil, []*Migration{
+		{Version: 2, Up: up},
+		{Version: 1, Up: up},
+		{Version: 2, Up: up},
+	}))
+
+	// missing up
+	assert.NotNil(t, entry.migrate(context.TODO(), nil, []*Migration{{Version: 1}}))
+
+	// nothing to migrate
+	assert.Nil(t, entry.migrate(context.TODO(), nil, nil))
+
+	rkentry.GlobalAppCtx.RemoveEntry(entry)
+}
+
+func TestMongoEntry_migrateWithMock(t *testing.T) {
+	// rkmongotest could not be imported here since it depends on this package, mock deployment is created directly
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("apply", func(mt *mtest.T) {
+		entry := RegisterMongoEntry()
+		defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+		applied := make([]int64, 0)
+		up := func(version int64) func(ctx context.Context, db *mongo.Database) error {
+			return func(ctx context.Context, db *mongo.Database) error {
+				applied = append(applied, version)
+				return nil
+			}
+		}
+
+		mt.AddMockResponses(
+			// lock
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+			// applied versions
+			mtest.CreateCursorResponse(0, "db._rk_migrations", mtest.FirstBatch,
+				bson.D{{Key: "_id", Value: int64(1)}, {Key: "description", Value: "applied"}}),
+			// record of version 2
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+			// unlock
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}))
+
+		err := entry.migrate(context.TODO(), mt.Client.Database("db"), []*Migration{
+			{Version: 2, Description: "second", Up: up(2)},
+			{Version: 1, Description: "applied", Up: up(1)},
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, []int64{2}, applied)
+
+		lock := mt.GetStartedEvent()
+		assert.Equal(t, "update", lock.CommandName)
+		assert.Equal(t, MigrationCollection, lock.Command.Lookup("update").StringValue())
+		assert.True(t, lock.Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("upsert").Boolean())
+
+		assert.Equal(t, "find", mt.GetStartedEvent().CommandName)
+
+		insert := mt.GetStartedEvent()
+		assert.Equal(t, "insert", insert.CommandName)
+		record := insert.Command.Lookup("documents").Array().Index(0).Value().Document()
+		assert.Equal(t, int64(2), record.Lookup("_id").Int64())
+		assert.Equal(t, "second", record.Lookup("description").StringValue())
+
+		unlock := mt.GetStartedEvent()
+		assert.Equal(t, "delete", unlock.CommandName)
+	})
+
+	mt.Run("lock held by others", func(mt *mtest.T) {
+		entry := RegisterMongoEntry(WithMigrationLockTimeoutMs(100))
+		defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+		duplicate := mtest.CreateWriteErrorsResponse(mtest.WriteError{Index: 0, Code: 11000, Message: "duplicate key error"})
+		mt.AddMockResponses(duplicate, duplicate)
+
+		called := false
+		err := entry.migrate(context.TODO(), mt.Client.Database("db"), []*Migration{
+			{Version: 1, Up: func(ctx context.Context, db *mongo.Database) error {
+				called = true
+				return nil
+			}},
+		})
+		assert.NotNil(t, err)
+		assert.False(t, called)
+	})
+
+	mt.Run("renew lock", func(mt *mtest.T) {
+		entry := RegisterMongoEntry()
+		defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+		entry.migrationLockLease = 30 * time.Millisecond
+
+		coll := mt.Client.Database("db").Collection(MigrationCollection)
+
+		// renewed, then lost
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}, bson.E{Key: "nModified", Value: 0}))
+		assert.False(t, entry.renewMigrationLock(context.TODO(), coll, "owner"))
+
+		renew := mt.GetStartedEvent()
+		assert.Equal(t, "update", renew.CommandName)
+		filter := renew.Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("q").Document()
+		assert.Equal(t, "owner", filter.Lookup("owner").StringValue())
+
+		// stopped by ctx
+		ctx, cancel := context.WithCancel(context.TODO())
+		cancel()
+		assert.True(t, entry.renewMigrationLock(ctx, coll, "owner"))
+	})
+}
@@ -0,0 +1,64 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+// Package rkmongotest provides utilities for testing code based on rkmongo.MongoEntry without mongo server.
+//
+// MongoEntry is built on top of mock deployment of mtest, responses could be queued with
+// mtest.T.AddMockResponses and commands could be asserted with mtest.T.GetStartedEvent.
+//
+//	func TestGetUser(t *testing.T) {
+//		mt := rkmongotest.New(t)
+//
+//		mt.Run("get user", func(mt *mtest.T) {
+//			entry := rkmongotest.NewEntry(mt, rkmongo.WithDatabase("users"))
+//
+//			mt.AddMockResponses(mtest.CreateCursorResponse(0, "users.meta", mtest.FirstBatch,
+//				bson.D{{"id", "1"}, {"name", "rk"}}))
+//
+//			user, err := GetUser(entry.GetMongoDB("users"), "1")
+//			assert.Nil(t, err)
+//			assert.Equal(t, "find", mt.GetStartedEvent().CommandName)
+//		})
+//	}
+package rkmongotest
+
+import (
+	"context"
+	"github.com/rookie-ninja/rk-db/mongodb"
+	"github.com/rookie-ninja/rk-entry/v2/entry"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"testing"
+)
+
+// New creates mtest.T with mock deployment, sub tests created by Run would use mock client.
+// mtest.T would be closed at cleanup of t.
+func New(t *testing.T, opts ...*mtest.Options) *mtest.T {
+	mt := mtest.New(t, append([]*mtest.Options{mtest.NewOptions().ClientType(mtest.Mock)}, opts...)...)
+	t.Cleanup(mt.Close)
+
+	return mt
+}
+
+// NewEntry creates and bootstraps rkmongo.MongoEntry with mock client of mt, which should be called in mtest.T.Run.
+//
+// Databases and GridFS buckets are created, collections and migrations declared would send commands to
+// mock deployment, so responses should be queued before if they are declared.
+// Entry would be interrupted and removed from rkentry.GlobalAppCtx at cleanup of mt.
+// Commands are not logged by Logger of entry, since monitor of mock client is owned by mtest.
+func NewEntry(mt *mtest.T, opts ...rkmongo.Option) *rkmongo.MongoEntry {
+	if mt.Client == nil {
+		mt.Fatal("mock client is nil, please call NewEntry in mtest.T.Run")
+	}
+
+	entry := rkmongo.RegisterMongoEntry(append(opts, rkmongo.WithClient(mt.Client))...)
+	entry.Bootstrap(context.Background())
+
+	mt.Cleanup(func() {
+		entry.Interrupt(context.Background())
+		rkentry.GlobalAppCtx.RemoveEntry(entry)
+	})
+
+	return entry
+}
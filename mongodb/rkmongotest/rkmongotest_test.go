@@ -0,0 +1,61 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkmongotest
+
+import (
+	"context"
+	"github.com/rookie-ninja/rk-db/mongodb"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"testing"
+)
+
+func TestNewEntry(t *testing.T) {
+	mt := New(t)
+
+	mt.Run("find", func(mt *mtest.T) {
+		entry := NewEntry(mt,
+			rkmongo.WithName("ut-mongo-mock"),
+			rkmongo.WithDatabase("users"),
+			rkmongo.WithBucket("users", nil))
+
+		assert.Equal(t, "ut-mongo-mock", entry.GetName())
+		assert.Equal(t, "users", entry.GetDefaultMongoDB().Name())
+		assert.NotNil(t, entry.GetBucket("users", "fs"))
+		assert.Equal(t, entry, rkmongo.GetMongoEntry("ut-mongo-mock"))
+		// monitor is not attached to mock client
+		assert.Nil(t, entry.Opts.Monitor)
+
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "users.meta", mtest.FirstBatch,
+			bson.D{{Key: "id", Value: "1"}, {Key: "name", Value: "rk"}}))
+
+		res := bson.M{}
+		err := entry.GetMongoDB("users").Collection("meta").FindOne(context.TODO(), bson.M{"id": "1"}).Decode(&res)
+		assert.Nil(t, err)
+		assert.Equal(t, "rk", res["name"])
+
+		event := mt.GetStartedEvent()
+		assert.Equal(t, "find", event.CommandName)
+		assert.Equal(t, "users", event.DatabaseName)
+	})
+
+	mt.Run("insert with write error", func(mt *mtest.T) {
+		entry := NewEntry(mt, rkmongo.WithDatabase("users"))
+
+		mt.AddMockResponses(mtest.CreateWriteErrorsResponse(mtest.WriteError{
+			Index:   0,
+			Code:    11000,
+			Message: "duplicate key error",
+		}))
+
+		_, err := entry.GetMongoDB("users").Collection("meta").InsertOne(context.TODO(), bson.M{"id": "1"})
+		assert.True(t, mongo.IsDuplicateKeyError(err))
+	})
+
+	assert.Nil(t, rkmongo.GetMongoEntry("ut-mongo-mock"))
+}
@@ -0,0 +1,178 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkmongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/rookie-ninja/rk-entry/v2/middleware"
+	"go.mongodb.org/mongo-driver/mongo"
+	mongoOpt "go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"time"
+)
+
+const (
+	// TransientTransactionError is an error label of transaction which could be retried as a whole
+	TransientTransactionError = "TransientTransactionError"
+	// UnknownTransactionCommitResult is an error label of commitTransaction which could be retried
+	UnknownTransactionCommitResult = "UnknownTransactionCommitResult"
+)
+
+var noopTracerProvider = trace.NewNoopTracerProvider()
+
+// WithTransaction runs fn in a transaction of database.
+//
+// Read concern, write concern and read preference of transaction are the same as database by default,
+// which could be overridden by opts.
+// Transaction would be retried if TransientTransactionError returned, commit would be retried
+// if UnknownTransactionCommitResult returned, both of them would be retried for at most
+// transaction.maxRetries times with exponential backoff.
+//
+// A span would be created for each attempt if tracer exists in context.
+func (entry *MongoEntry) WithTransaction(ctx context.Context, dbName string,
+	fn func(sessCtx mongo.SessionContext, db *mongo.Database) error, opts ...*mongoOpt.TransactionOptions) error {
+	if fn == nil {
+		return errors.New("nil transaction function")
+	}
+
+	if entry.Client == nil {
+		return fmt.Errorf("mongo client of entry [%s] is not initialized, please call Bootstrap first", entry.entryName)
+	}
+
+	db := entry.GetMongoDB(dbName)
+	if db == nil {
+		return fmt.Errorf("database [%s] not found in entry [%s]", dbName, entry.entryName)
+	}
+
+	txOpts := mongoOpt.MergeTransactionOptions(
+		append([]*mongoOpt.TransactionOptions{entry.defaultTransactionOptions(dbName)}, opts...)...)
+
+	sess, err := entry.Client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer sess.EndSession(context.Background())
+
+	return entry.retryTransaction(ctx, dbName, "transaction", TransientTransactionError, func(ctx context.Context) error {
+		return mongo.WithSession(ctx, sess, func(sessCtx mongo.SessionContext) error {
+			if err := sess.StartTransaction(txOpts); err != nil {
+				return err
+			}
+
+			if err := fn(sessCtx, db); err != nil {
+				_ = sess.AbortTransaction(context.Background())
+				return err
+			}
+
+			return entry.retryTransaction(sessCtx, dbName, "commitTransaction", UnknownTransactionCommitResult,
+				func(ctx context.Context) error {
+					return sess.CommitTransaction(ctx)
+				})
+		})
+	})
+}
+
+// defaultTransactionOptions returns transaction options inherited from options of database
+func (entry *MongoEntry) defaultTransactionOptions(dbName string) *mongoOpt.TransactionOptions {
+	res := mongoOpt.Transaction()
+
+	dbOpts := mongoOpt.MergeDatabaseOptions(entry.mongoDbOpts[dbName]...)
+	if dbOpts.ReadConcern != nil {
+		res.SetReadConcern(dbOpts.ReadConcern)
+	}
+	if dbOpts.WriteConcern != nil {
+		res.SetWriteConcern(dbOpts.WriteConcern)
+	}
+	if dbOpts.ReadPreference != nil {
+		res.SetReadPreference(dbOpts.ReadPreference)
+	}
+
+	return res
+}
+
+// retryTransaction calls fn until succeeded, error without label returned or maximum retries reached
+func (entry *MongoEntry) retryTransaction(ctx context.Context, dbName, op, label string, fn func(ctx context.Context) error) error {
+	tracer := getTracer(ctx)
+
+	for attempt := 1; ; attempt++ {
+		spanCtx, span := tracer.Start(ctx, fmt.Sprintf("mongo.%s", op))
+		span.SetAttributes(
+			attribute.String("db.system", "mongodb"),
+			attribute.String("db.name", dbName),
+			attribute.String("db.operation", op),
+			attribute.Int("db.mongodb.attempt", attempt),
+		)
+
+		err := fn(spanCtx)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+
+		if err == nil || !hasErrorLabel(err, label) || attempt > entry.txMaxRetries {
+			return err
+		}
+
+		backoff := entry.transactionBackoff(attempt)
+		entry.loggerEntry.Warn("Retrying mongo transaction",
+			zap.String("entryName", entry.entryName),
+			zap.String("database", dbName),
+			zap.String("operation", op),
+			zap.Int("attempt", attempt),
+			zap.Duration("backoff", backoff),
+			zap.Error(err))
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+	}
+}
+
+// transactionBackoff returns exponential backoff of attempt bounded by txMinRetryBackoff and txMaxRetryBackoff
+func (entry *MongoEntry) transactionBackoff(attempt int) time.Duration {
+	return expBackoff(entry.txMinRetryBackoff, entry.txMaxRetryBackoff, attempt)
+}
+
+// expBackoff returns min * 2^(attempt-1) bounded by max
+func expBackoff(min, max time.Duration, attempt int) time.Duration {
+	res := min
+	for i := 1; i < attempt && res < max; i++ {
+		res *= 2
+	}
+
+	if res > max {
+		res = max
+	}
+
+	return res
+}
+
+func hasErrorLabel(err error, label string) bool {
+	var serverErr mongo.ServerError
+	if errors.As(err, &serverErr) {
+		return serverErr.HasErrorLabel(label)
+	}
+
+	return false
+}
+
+func getTracer(ctx context.Context) trace.Tracer {
+	if v := ctx.Value(rkmid.TracerKey); v != nil {
+		if res, ok := v.(trace.Tracer); ok {
+			return res
+		}
+	}
+
+	return noopTracerProvider.Tracer("trace-noop")
+}
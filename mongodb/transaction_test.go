@@ -0,0 +1,118 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkmongo
+
+import (
+	"context"
+	"errors"
+	"github.com/rookie-ninja/rk-entry/v2/entry"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/mongo"
+	mongoOpt "go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+	"testing"
+	"time"
+)
+
+func TestMongoEntry_WithTransaction(t *testing.T) {
+	entry := RegisterMongoEntry(WithDatabase("database"))
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	fn := func(sessCtx mongo.SessionContext, db *mongo.Database) error {
+		return nil
+	}
+
+	// nil function
+	assert.NotNil(t, entry.WithTransaction(context.TODO(), "database", nil))
+
+	// without bootstrap
+	assert.NotNil(t, entry.WithTransaction(context.TODO(), "database", fn))
+}
+
+func TestMongoEntry_defaultTransactionOptions(t *testing.T) {
+	entry := RegisterMongoEntry(
+		WithDatabase("database", mongoOpt.Database().
+			SetReadConcern(readconcern.Majority()).
+			SetWriteConcern(writeconcern.New(writeconcern.WMajority())).
+			SetReadPreference(readpref.Primary())))
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	// inherited from database
+	opts := entry.defaultTransactionOptions("database")
+	assert.Equal(t, readconcern.Majority(), opts.ReadConcern)
+	assert.Equal(t, writeconcern.New(writeconcern.WMajority()), opts.WriteConcern)
+	assert.Equal(t, readpref.Primary(), opts.ReadPreference)
+
+	// database without options
+	opts = entry.defaultTransactionOptions("not-exist")
+	assert.Nil(t, opts.ReadConcern)
+	assert.Nil(t, opts.WriteConcern)
+	assert.Nil(t, opts.ReadPreference)
+}
+
+func TestMongoEntry_retryTransaction(t *testing.T) {
+	entry := RegisterMongoEntry(WithTransactionRetry(2, 1, 2))
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	transientErr := mongo.CommandError{Labels: []string{TransientTransactionError}}
+
+	// succeeded after retry
+	attempts := 0
+	assert.Nil(t, entry.retryTransaction(context.TODO(), "database", "transaction", TransientTransactionError,
+		func(ctx context.Context) error {
+			attempts++
+			if attempts < 2 {
+				return transientErr
+			}
+			return nil
+		}))
+	assert.Equal(t, 2, attempts)
+
+	// maximum retries reached
+	attempts = 0
+	assert.Equal(t, transientErr, entry.retryTransaction(context.TODO(), "database", "transaction", TransientTransactionError,
+		func(ctx context.Context) error {
+			attempts++
+			return transientErr
+		}))
+	assert.Equal(t, 3, attempts)
+
+	// error without label
+	attempts = 0
+	assert.NotNil(t, entry.retryTransaction(context.TODO(), "database", "transaction", TransientTransactionError,
+		func(ctx context.Context) error {
+			attempts++
+			return errors.New("ut-error")
+		}))
+	assert.Equal(t, 1, attempts)
+
+	// canceled context
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+	assert.Equal(t, context.Canceled, entry.retryTransaction(ctx, "database", "transaction", TransientTransactionError,
+		func(ctx context.Context) error {
+			return transientErr
+		}))
+}
+
+func TestMongoEntry_transactionBackoff(t *testing.T) {
+	entry := RegisterMongoEntry(WithTransactionRetry(5, 10, 50))
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	assert.Equal(t, 10*time.Millisecond, entry.transactionBackoff(1))
+	assert.Equal(t, 20*time.Millisecond, entry.transactionBackoff(2))
+	assert.Equal(t, 40*time.Millisecond, entry.transactionBackoff(3))
+	assert.Equal(t, 50*time.Millisecond, entry.transactionBackoff(4))
+}
+
+func TestHasErrorLabel(t *testing.T) {
+	err := mongo.CommandError{Labels: []string{UnknownTransactionCommitResult}}
+	assert.True(t, hasErrorLabel(err, UnknownTransactionCommitResult))
+	assert.False(t, hasErrorLabel(err, TransientTransactionError))
+	assert.False(t, hasErrorLabel(errors.New("ut-error"), TransientTransactionError))
+}
@@ -54,6 +54,7 @@ type BootMySQLE struct {
 		AutoCreate bool     `yaml:"autoCreate" json:"autoCreate"`
 		Plugins    struct {
 			Prom  plugins.PromConfig  `yaml:"prom"`
+			Cache plugins.CacheConfig `yaml:"cache"`
 			Trace plugins.TraceConfig `yaml:"trace"`
 		} `yaml:"plugins" json:"plugins"`
 	} `yaml:"database" json:"database"`
@@ -310,6 +311,16 @@ func RegisterMySqlEntryYAML(raw []byte) map[string]rkentry.Entry {
 				prom := plugins.NewProm(&db.Plugins.Prom)
 				opts = append(opts, WithPlugin(db.Name, prom))
 			}
+			if db.Plugins.Cache.Enabled {
+				if len(db.Plugins.Cache.RedisEntry) < 1 {
+					rkentry.ShutdownWithError(fmt.Errorf("redisEntry of cache plugin is required, database:%s", db.Name))
+				}
+				db.Plugins.Cache.DbAddr = element.Addr
+				db.Plugins.Cache.DbName = db.Name
+				db.Plugins.Cache.DbType = "mysql"
+				cache := plugins.NewCache(&db.Plugins.Cache)
+				opts = append(opts, WithPlugin(db.Name, cache))
+			}
 		}
 
 		entry := RegisterMySqlEntry(opts...)
@@ -55,6 +55,7 @@ type BootPostgresE struct {
 		PreferSimpleProtocol bool     `yaml:"preferSimpleProtocol" json:"preferSimpleProtocol"`
 		Plugins              struct {
 			Prom  plugins.PromConfig  `yaml:"prom"`
+			Cache plugins.CacheConfig `yaml:"cache"`
 			Trace plugins.TraceConfig `yaml:"trace"`
 		} `yaml:"plugins" json:"plugins"`
 	} `yaml:"database" json:"database"`
@@ -302,6 +303,16 @@ func RegisterPostgresEntryYAML(raw []byte) map[string]rkentry.Entry {
 				prom := plugins.NewProm(&db.Plugins.Prom)
 				opts = append(opts, WithPlugin(db.Name, prom))
 			}
+			if db.Plugins.Cache.Enabled {
+				if len(db.Plugins.Cache.RedisEntry) < 1 {
+					rkentry.ShutdownWithError(fmt.Errorf("redisEntry of cache plugin is required, database:%s", db.Name))
+				}
+				db.Plugins.Cache.DbAddr = element.Addr
+				db.Plugins.Cache.DbName = db.Name
+				db.Plugins.Cache.DbType = "postgresql"
+				cache := plugins.NewCache(&db.Plugins.Cache)
+				opts = append(opts, WithPlugin(db.Name, cache))
+			}
 		}
 
 		entry := RegisterPostgresEntry(opts...)
@@ -9,12 +9,19 @@ package rkredis
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
+	"github.com/alicebob/miniredis/v2"
 	"github.com/redis/go-redis/v9"
 	"github.com/rookie-ninja/rk-entry/v2/entry"
 	"go.uber.org/zap"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -28,10 +35,16 @@ const (
 	ha      = "HA"
 	cluster = "Cluster"
 	single  = "Single"
+	ring    = "Ring"
+
+	// memory mode starts an embedded redis server at Bootstrap
+	memory = "memory"
 
 	RedisEntryType = "RedisEntry"
 )
 
+var setLoggerOnce sync.Once
+
 // GetRedisEntry returns RedisEntry
 func GetRedisEntry(entryName string) *RedisEntry {
 	if v := rkentry.GlobalAppCtx.GetEntry(RedisEntryType, entryName); v != nil {
@@ -51,75 +64,114 @@ type BootRedis struct {
 
 // BootRedisE sub struct for BootRedis
 type BootRedisE struct {
-	Name                  string   `yaml:"name" json:"name"` // Required
-	Description           string   `yaml:"description" json:"description"`
-	Enabled               bool     `yaml:"enabled" json:"enabled"` // Required
-	Domain                string   `yaml:"domain" json:"domain"`
-	Addrs                 []string `yaml:"addrs" json:"addrs"` // Required
-	MasterName            string   `yaml:"masterName" json:"masterName"`
-	SentinelPass          string   `yaml:"sentinelPass" json:"sentinelPass"`
-	DB                    int      `yaml:"db" json:"db"`     // Required
-	User                  string   `yaml:"user" json:"user"` // Required
-	Pass                  string   `yaml:"pass" json:"pass"` // Required
-	MaxRetries            int      `yaml:"maxRetries" json:"maxRetries"`
-	MinRetryBackoffMs     int      `yaml:"minRetryBackoffMs" json:"minRetryBackoffMs"`
-	MaxRetryBackoffMs     int      `yaml:"maxRetryBackoffMs" json:"maxRetryBackoffMs"`
-	DialTimeoutMs         int      `yaml:"dialTimeoutMs" json:"dialTimeoutMs"`
-	ReadTimeoutMs         int      `yaml:"readTimeoutMs" json:"readTimeoutMs"`
-	WriteTimeoutMs        int      `yaml:"writeTimeoutMs" json:"writeTimeoutMs"`
-	ContextTimeoutEnabled bool     `yaml:"contextTimeoutEnabled" json:"contextTimeoutEnabled"`
-	PoolFIFO              bool     `yaml:"poolFIFO" json:"poolFIFO"`
-	PoolSize              int      `yaml:"poolSize" json:"poolSize"`
-	MinIdleConn           int      `yaml:"minIdleConn" json:"minIdleConn"`
-	MaxIdleConn           int      `yaml:"maxIdleConn" json:"maxIdleConn"`
-	ConnMaxIdleTimeMs     int      `yaml:"connMaxIdleTimeMs" json:"connMaxIdleTimeMs"`
-	ConnMaxLifetimeMs     int      `yaml:"connMaxLifetimeMs" json:"connMaxLifetimeMs"`
-	PoolTimeoutMs         int      `yaml:"poolTimeoutMs" json:"poolTimeoutMs"`
-	IdleTimeoutMs         int      `yaml:"idleTimeoutMs" json:"idleTimeoutMs"`
-	IdleCheckFrequencyMs  int      `yaml:"idleCheckFrequencyMs" json:"idleCheckFrequencyMs"`
-	MaxRedirects          int      `yaml:"maxRedirects" json:"maxRedirects"`
-	ReadOnly              bool     `yaml:"readOnly" json:"readOnly"`
-	RouteByLatency        bool     `yaml:"routeByLatency" json:"routeByLatency"`
-	RouteRandomly         bool     `yaml:"routeRandomly" json:"routeRandomly"`
-	LoggerEntry           string   `yaml:"loggerEntry" json:"loggerEntry"`
-	CertEntry             string   `yaml:"certEntry" json:"certEntry"`
+	Name                    string   `yaml:"name" json:"name"` // Required
+	Description             string   `yaml:"description" json:"description"`
+	Enabled                 bool     `yaml:"enabled" json:"enabled"` // Required
+	Domain                  string   `yaml:"domain" json:"domain"`
+	Mode                    string   `yaml:"mode" json:"mode"`
+	ClientType              string   `yaml:"clientType" json:"clientType"`
+	Addrs                   []string `yaml:"addrs" json:"addrs"` // Required
+	ClientName              string   `yaml:"clientName" json:"clientName"`
+	Protocol                int      `yaml:"protocol" json:"protocol"`
+	MasterName              string   `yaml:"masterName" json:"masterName"`
+	SentinelUser            string   `yaml:"sentinelUser" json:"sentinelUser"`
+	SentinelPass            string   `yaml:"sentinelPass" json:"sentinelPass"`
+	ReplicaOnly             bool     `yaml:"replicaOnly" json:"replicaOnly"`
+	UseDisconnectedReplicas bool     `yaml:"useDisconnectedReplicas" json:"useDisconnectedReplicas"`
+	DB                      int      `yaml:"db" json:"db"`     // Required
+	User                    string   `yaml:"user" json:"user"` // Required
+	Pass                    string   `yaml:"pass" json:"pass"` // Required
+	MaxRetries              int      `yaml:"maxRetries" json:"maxRetries"`
+	MinRetryBackoffMs       int      `yaml:"minRetryBackoffMs" json:"minRetryBackoffMs"`
+	MaxRetryBackoffMs       int      `yaml:"maxRetryBackoffMs" json:"maxRetryBackoffMs"`
+	DialTimeoutMs           int      `yaml:"dialTimeoutMs" json:"dialTimeoutMs"`
+	ReadTimeoutMs           int      `yaml:"readTimeoutMs" json:"readTimeoutMs"`
+	WriteTimeoutMs          int      `yaml:"writeTimeoutMs" json:"writeTimeoutMs"`
+	ContextTimeoutEnabled   bool     `yaml:"contextTimeoutEnabled" json:"contextTimeoutEnabled"`
+	PoolFIFO                bool     `yaml:"poolFIFO" json:"poolFIFO"`
+	PoolSize                int      `yaml:"poolSize" json:"poolSize"`
+	MinIdleConn             int      `yaml:"minIdleConn" json:"minIdleConn"`
+	MaxIdleConn             int      `yaml:"maxIdleConn" json:"maxIdleConn"`
+	MaxActiveConn           int      `yaml:"maxActiveConn" json:"maxActiveConn"`
+	ConnMaxIdleTimeMs       int      `yaml:"connMaxIdleTimeMs" json:"connMaxIdleTimeMs"`
+	ConnMaxLifetimeMs       int      `yaml:"connMaxLifetimeMs" json:"connMaxLifetimeMs"`
+	PoolTimeoutMs           int      `yaml:"poolTimeoutMs" json:"poolTimeoutMs"`
+	IdleTimeoutMs           int      `yaml:"idleTimeoutMs" json:"idleTimeoutMs"`
+	IdleCheckFrequencyMs    int      `yaml:"idleCheckFrequencyMs" json:"idleCheckFrequencyMs"`
+	MaxRedirects            int      `yaml:"maxRedirects" json:"maxRedirects"`
+	ReadOnly                bool     `yaml:"readOnly" json:"readOnly"`
+	RouteByLatency          bool     `yaml:"routeByLatency" json:"routeByLatency"`
+	RouteRandomly           bool     `yaml:"routeRandomly" json:"routeRandomly"`
+	DisableIdentity         bool     `yaml:"disableIdentity" json:"disableIdentity"`
+	IdentitySuffix          string   `yaml:"identitySuffix" json:"identitySuffix"`
+	NotifyKeyspaceEvents    string   `yaml:"notifyKeyspaceEvents" json:"notifyKeyspaceEvents"`
+	Ring                    struct {
+		Shards               map[string]string `yaml:"shards" json:"shards"`
+		HeartbeatFrequencyMs int               `yaml:"heartbeatFrequencyMs" json:"heartbeatFrequencyMs"`
+	} `yaml:"ring" json:"ring"`
+	Databases []struct {
+		Name string `yaml:"name" json:"name"`
+		DB   int    `yaml:"db" json:"db"`
+	} `yaml:"databases" json:"databases"`
+	LoggerEntry        string `yaml:"loggerEntry" json:"loggerEntry"`
+	CertEntry          string `yaml:"certEntry" json:"certEntry"`
+	InsecureSkipVerify bool   `yaml:"insecureSkipVerify" json:"insecureSkipVerify"`
+	ServerName         string `yaml:"serverName" json:"serverName"`
+	TLSMinVersion      string `yaml:"tlsMinVersion" json:"tlsMinVersion"`
+	Scripts            string `yaml:"scripts" json:"scripts"`
+	KeyPrefix          string `yaml:"keyPrefix" json:"keyPrefix"`
+	RateLimit          struct {
+		Prefix string                `yaml:"prefix" json:"prefix"`
+		Limits []*BootRedisRateLimit `yaml:"limits" json:"limits"`
+	} `yaml:"rateLimit" json:"rateLimit"`
+	Guard BootRedisGuard `yaml:"guard" json:"guard"`
 }
 
 // ToRedisUniversalOptions convert BootConfigRedis to redis.UniversalOptions
+//
+// Failover only options (replicaOnly, useDisconnectedReplicas) are not part of redis.UniversalOptions,
+// they are passed to RedisEntry with WithFailoverOption.
 func ToRedisUniversalOptions(config *BootRedisE) *redis.UniversalOptions {
-	if config.Enabled {
-		return &redis.UniversalOptions{
-			Addrs:                 config.Addrs,
-			DB:                    config.DB,
-			Username:              config.User,
-			Password:              config.Pass,
-			SentinelPassword:      config.SentinelPass,
-			MaxRetries:            config.MaxRetries,
-			MinRetryBackoff:       time.Duration(config.MinRetryBackoffMs) * time.Millisecond,
-			MaxRetryBackoff:       time.Duration(config.MaxRetryBackoffMs) * time.Millisecond,
-			DialTimeout:           time.Duration(config.DialTimeoutMs) * time.Millisecond,
-			ReadTimeout:           time.Duration(config.ReadTimeoutMs) * time.Millisecond,
-			WriteTimeout:          time.Duration(config.WriteTimeoutMs) * time.Millisecond,
-			ContextTimeoutEnabled: config.ContextTimeoutEnabled,
-
-			PoolFIFO:     config.PoolFIFO,
-			PoolSize:     config.PoolSize,
-			PoolTimeout:  time.Duration(config.PoolTimeoutMs) * time.Millisecond,
-			MinIdleConns: config.MinIdleConn,
-			MaxIdleConns: config.MaxIdleConn,
-
-			ConnMaxIdleTime: time.Duration(config.ConnMaxIdleTimeMs) * time.Millisecond,
-			ConnMaxLifetime: time.Duration(config.ConnMaxLifetimeMs) * time.Millisecond,
-
-			MaxRedirects:   config.MaxRedirects,
-			ReadOnly:       config.ReadOnly,
-			RouteByLatency: config.RouteByLatency,
-			RouteRandomly:  config.RouteRandomly,
-			MasterName:     config.MasterName,
-		}
-	} else {
+	if config == nil || !config.Enabled {
 		return nil
 	}
+
+	return &redis.UniversalOptions{
+		Addrs:                 config.Addrs,
+		ClientName:            config.ClientName,
+		DB:                    config.DB,
+		Protocol:              config.Protocol,
+		Username:              config.User,
+		Password:              config.Pass,
+		SentinelUsername:      config.SentinelUser,
+		SentinelPassword:      config.SentinelPass,
+		MaxRetries:            config.MaxRetries,
+		MinRetryBackoff:       time.Duration(config.MinRetryBackoffMs) * time.Millisecond,
+		MaxRetryBackoff:       time.Duration(config.MaxRetryBackoffMs) * time.Millisecond,
+		DialTimeout:           time.Duration(config.DialTimeoutMs) * time.Millisecond,
+		ReadTimeout:           time.Duration(config.ReadTimeoutMs) * time.Millisecond,
+		WriteTimeout:          time.Duration(config.WriteTimeoutMs) * time.Millisecond,
+		ContextTimeoutEnabled: config.ContextTimeoutEnabled,
+
+		PoolFIFO:       config.PoolFIFO,
+		PoolSize:       config.PoolSize,
+		PoolTimeout:    time.Duration(config.PoolTimeoutMs) * time.Millisecond,
+		MinIdleConns:   config.MinIdleConn,
+		MaxIdleConns:   config.MaxIdleConn,
+		MaxActiveConns: config.MaxActiveConn,
+
+		ConnMaxIdleTime: time.Duration(config.ConnMaxIdleTimeMs) * time.Millisecond,
+		ConnMaxLifetime: time.Duration(config.ConnMaxLifetimeMs) * time.Millisecond,
+
+		MaxRedirects:   config.MaxRedirects,
+		ReadOnly:       config.ReadOnly,
+		RouteByLatency: config.RouteByLatency,
+		RouteRandomly:  config.RouteRandomly,
+		MasterName:     config.MasterName,
+
+		DisableIndentity: config.DisableIdentity,
+		IdentitySuffix:   config.IdentitySuffix,
+	}
 }
 
 // RegisterRedisEntryYAML register RedisEntry based on config file into rkentry.GlobalAppCtx
@@ -158,44 +210,54 @@ func RegisterRedisEntryYAML(raw []byte) map[string]rkentry.Entry {
 	}
 
 	for _, element := range configMap {
-		universalOpt := &redis.UniversalOptions{
-			Addrs:                 element.Addrs,
-			DB:                    element.DB,
-			Username:              element.User,
-			Password:              element.Pass,
-			SentinelPassword:      element.SentinelPass,
-			MaxRetries:            element.MaxRetries,
-			MinRetryBackoff:       time.Duration(element.MinRetryBackoffMs) * time.Millisecond,
-			MaxRetryBackoff:       time.Duration(element.MaxRetryBackoffMs) * time.Millisecond,
-			DialTimeout:           time.Duration(element.DialTimeoutMs) * time.Millisecond,
-			ReadTimeout:           time.Duration(element.ReadTimeoutMs) * time.Millisecond,
-			WriteTimeout:          time.Duration(element.WriteTimeoutMs) * time.Millisecond,
-			ContextTimeoutEnabled: element.ContextTimeoutEnabled,
-
-			PoolFIFO:     element.PoolFIFO,
-			PoolSize:     element.PoolSize,
-			PoolTimeout:  time.Duration(element.PoolTimeoutMs) * time.Millisecond,
-			MinIdleConns: element.MinIdleConn,
-			MaxIdleConns: element.MaxIdleConn,
-
-			ConnMaxIdleTime: time.Duration(element.ConnMaxIdleTimeMs) * time.Millisecond,
-			ConnMaxLifetime: time.Duration(element.ConnMaxLifetimeMs) * time.Millisecond,
-
-			MaxRedirects:   element.MaxRedirects,
-			ReadOnly:       element.ReadOnly,
-			RouteByLatency: element.RouteByLatency,
-			RouteRandomly:  element.RouteRandomly,
-			MasterName:     element.MasterName,
-		}
+		universalOpt := ToRedisUniversalOptions(element)
 
 		certEntry := rkentry.GlobalAppCtx.GetCertEntry(element.CertEntry)
 
-		entry := RegisterRedisEntry(
+		opts := []Option{
 			WithName(element.Name),
 			WithDescription(element.Description),
 			WithUniversalOption(universalOpt),
+			WithMode(element.Mode),
+			WithClientType(element.ClientType),
+			WithFailoverOption(element.ReplicaOnly, element.UseDisconnectedReplicas),
+			WithRing(element.Ring.Shards, time.Duration(element.Ring.HeartbeatFrequencyMs)*time.Millisecond),
 			WithCertEntry(certEntry),
-			WithLoggerEntry(rkentry.GlobalAppCtx.GetLoggerEntry(element.LoggerEntry)))
+			WithInsecureSkipVerify(element.InsecureSkipVerify),
+			WithServerName(element.ServerName),
+			WithTLSMinVersion(toTLSVersion(element.TLSMinVersion)),
+			WithKeyPrefix(element.KeyPrefix),
+			WithGuard(ToGuard(&element.Guard)),
+			WithNotifyKeyspaceEvents(element.NotifyKeyspaceEvents),
+			WithLoggerEntry(rkentry.GlobalAppCtx.GetLoggerEntry(element.LoggerEntry)),
+		}
+
+		// iterate databases
+		for i := range element.Databases {
+			opts = append(opts, WithDatabase(element.Databases[i].Name, element.Databases[i].DB))
+		}
+
+		// scripts in directory, or in embed.FS registered with name of entry
+		if len(element.Scripts) > 0 {
+			if embedFS := rkentry.GlobalAppCtx.GetEmbedFS(RedisEntryType, element.Name); embedFS != nil {
+				opts = append(opts, WithScriptFS(embedFS, element.Scripts))
+			} else {
+				opts = append(opts, WithScriptFS(os.DirFS(toAbsPath(element.Scripts)), "."))
+			}
+		}
+
+		// iterate rate limits
+		opts = append(opts, WithRateLimitPrefix(element.RateLimit.Prefix))
+		for i := range element.RateLimit.Limits {
+			limit := ToRateLimit(element.RateLimit.Limits[i])
+			if err := limit.Validate(); err != nil {
+				rkentry.ShutdownWithError(fmt.Errorf("invalid rate limit [%s] of entry [%s], %v",
+					element.RateLimit.Limits[i].Name, element.Name, err))
+			}
+			opts = append(opts, WithRateLimit(element.RateLimit.Limits[i].Name, limit))
+		}
+
+		entry := RegisterRedisEntry(opts...)
 
 		res[entry.GetName()] = entry
 	}
@@ -203,6 +265,32 @@ func RegisterRedisEntryYAML(raw []byte) map[string]rkentry.Entry {
 	return res
 }
 
+// toAbsPath returns absolute path based on working directory
+func toAbsPath(p string) string {
+	if filepath.IsAbs(p) {
+		return p
+	}
+
+	wd, _ := os.Getwd()
+	return filepath.Join(wd, p)
+}
+
+// toTLSVersion converts version string like 1.2 to tls.VersionTLS12, 0 would be returned if unknown
+func toTLSVersion(version string) uint16 {
+	switch strings.TrimPrefix(strings.ToLower(version), "tls") {
+	case "1.0", "10":
+		return tls.VersionTLS10
+	case "1.1", "11":
+		return tls.VersionTLS11
+	case "1.2", "12":
+		return tls.VersionTLS12
+	case "1.3", "13":
+		return tls.VersionTLS13
+	}
+
+	return 0
+}
+
 // RegisterRedisEntry will register Entry into GlobalAppCtx
 func RegisterRedisEntry(opts ...Option) *RedisEntry {
 	entry := &RedisEntry{
@@ -210,6 +298,11 @@ func RegisterRedisEntry(opts ...Option) *RedisEntry {
 		entryType:        RedisEntryType,
 		entryDescription: "Redis entry for go-redis client",
 		loggerEntry:      rkentry.GlobalAppCtx.GetLoggerEntryDefault(),
+		databases:        make(map[string]int),
+		clientMap:        make(map[string]redis.UniversalClient),
+		scripts:          make(map[string]*redis.Script),
+		rateLimitPrefix:  defaultRateLimitPrefix,
+		rateLimits:       make(map[string]*RateLimit),
 		Opts: &redis.UniversalOptions{
 			Addrs: []string{"localhost:6379"},
 		},
@@ -233,7 +326,11 @@ func RegisterRedisEntry(opts ...Option) *RedisEntry {
 			entry.entryName)
 	}
 
-	redis.SetLogger(NewLogger(entry.loggerEntry.Logger))
+	// logs of go-redis are written with logger of entry injected into context by hooks,
+	// default logger is used for logs without context of entry
+	setLoggerOnce.Do(func() {
+		redis.SetLogger(NewLogger(rkentry.GlobalAppCtx.GetLoggerEntryDefault().Logger))
+	})
 
 	rkentry.GlobalAppCtx.AddEntry(entry)
 
@@ -242,26 +339,51 @@ func RegisterRedisEntry(opts ...Option) *RedisEntry {
 
 // RedisEntry will init redis.Client with provided arguments
 type RedisEntry struct {
-	entryName        string                  `yaml:"entryName" yaml:"entryName"`
-	entryType        string                  `yaml:"entryType" yaml:"entryType"`
-	entryDescription string                  `yaml:"-" json:"-"`
-	ClientType       string                  `yaml:"clientType" json:"clientType"`
-	Opts             *redis.UniversalOptions `yaml:"-" json:"-"`
-	certEntry        *rkentry.CertEntry      `yaml:"-" json:"-"`
-	loggerEntry      *rkentry.LoggerEntry    `yaml:"-" json:"-"`
-	Client           redis.UniversalClient   `yaml:"-" json:"-"`
+	entryName               string                           `yaml:"entryName" yaml:"entryName"`
+	entryType               string                           `yaml:"entryType" yaml:"entryType"`
+	entryDescription        string                           `yaml:"-" json:"-"`
+	ClientType              string                           `yaml:"clientType" json:"clientType"`
+	Opts                    *redis.UniversalOptions          `yaml:"-" json:"-"`
+	clientTypeOverride      string                           `yaml:"-" json:"-"`
+	mode                    string                           `yaml:"-" json:"-"`
+	memoryServer            *miniredis.Miniredis             `yaml:"-" json:"-"`
+	ringShards              map[string]string                `yaml:"-" json:"-"`
+	ringHeartbeatFrequency  time.Duration                    `yaml:"-" json:"-"`
+	replicaOnly             bool                             `yaml:"-" json:"-"`
+	useDisconnectedReplicas bool                             `yaml:"-" json:"-"`
+	certEntry               *rkentry.CertEntry               `yaml:"-" json:"-"`
+	insecureSkipVerify      bool                             `yaml:"-" json:"-"`
+	serverName              string                           `yaml:"-" json:"-"`
+	tlsMinVersion           uint16                           `yaml:"-" json:"-"`
+	keyPrefix               string                           `yaml:"-" json:"-"`
+	guard                   *Guard                           `yaml:"-" json:"-"`
+	notifyKeyspaceEvents    string                           `yaml:"-" json:"-"`
+	loggerEntry             *rkentry.LoggerEntry             `yaml:"-" json:"-"`
+	Client                  redis.UniversalClient            `yaml:"-" json:"-"`
+	databases               map[string]int                   `yaml:"-" json:"-"`
+	clientMap               map[string]redis.UniversalClient `yaml:"-" json:"-"`
+	scripts                 map[string]*redis.Script         `yaml:"-" json:"-"`
+	rateLimitPrefix         string                           `yaml:"-" json:"-"`
+	rateLimits              map[string]*RateLimit            `yaml:"-" json:"-"`
+	streamCancels           []context.CancelFunc             `yaml:"-" json:"-"`
+	streamStopped           bool                             `yaml:"-" json:"-"`
+	streamWg                sync.WaitGroup                   `yaml:"-" json:"-"`
+	streamMutex             sync.Mutex                       `yaml:"-" json:"-"`
+	subs                    []*Subscription                  `yaml:"-" json:"-"`
+	listeners               []*KeyspaceListener              `yaml:"-" json:"-"`
+	subStopped              bool                             `yaml:"-" json:"-"`
+	subMutex                sync.Mutex                       `yaml:"-" json:"-"`
 }
 
 // Bootstrap RedisEntry
 func (entry *RedisEntry) Bootstrap(ctx context.Context) {
-	if entry.Opts.MasterName != "" {
-		entry.ClientType = ha
-	} else if len(entry.Opts.Addrs) > 1 {
-		entry.ClientType = cluster
-	} else {
-		entry.ClientType = single
+	// start embedded server and point client to it in memory mode
+	if entry.IsMemoryMode() {
+		entry.startMemoryServer()
 	}
 
+	entry.ClientType = entry.resolveClientType()
+
 	// extract eventId if exists
 	fields := make([]zap.Field, 0)
 
@@ -278,22 +400,61 @@ func (entry *RedisEntry) Bootstrap(ctx context.Context) {
 
 	entry.loggerEntry.Info("Bootstrap RedisEntry", fields...)
 
+	// TLSConfig would be shared by single, sentinel, cluster and ring clients
 	if entry.IsTlsEnabled() {
-		entry.Opts.TLSConfig = &tls.Config{Certificates: []tls.Certificate{*entry.certEntry.Certificate}}
+		entry.Opts.TLSConfig = entry.newTLSConfig()
 	}
 
-	entry.Client = redis.NewUniversalClient(entry.Opts)
+	entry.Client = entry.newClient(entry.Opts)
 
-	entry.loggerEntry.Info(fmt.Sprintf("Ping redis at %s", entry.Opts.Addrs))
-	cmd := entry.Client.Ping(context.Background())
-	if cmd.Err() != nil {
-		entry.loggerEntry.Info(fmt.Sprintf("Ping redis at %s failed", entry.Opts.Addrs))
-		rkentry.ShutdownWithError(cmd.Err())
+	addrs := entry.addrs()
+	entry.loggerEntry.Info(fmt.Sprintf("Ping redis at %s", addrs))
+	if err := entry.ping(context.Background(), entry.Client); err != nil {
+		entry.loggerEntry.Info(fmt.Sprintf("Ping redis at %s failed", addrs))
+		rkentry.ShutdownWithError(err)
 	}
-	entry.loggerEntry.Info(fmt.Sprintf("Ping redis at %s success", entry.Opts.Addrs))
+	entry.loggerEntry.Info(fmt.Sprintf("Ping redis at %s success", addrs))
 
 	if entry.Client != nil {
-		entry.Client.AddHook(NewRedisTracer())
+		entry.addHooks(entry.Client)
+	}
+
+	// load scripts into every node
+	if err := entry.loadScripts(context.Background()); err != nil {
+		entry.loggerEntry.Info("Loading redis scripts failed", zap.Error(err))
+		rkentry.ShutdownWithError(err)
+	}
+	if len(entry.scripts) > 0 {
+		entry.loggerEntry.Info(fmt.Sprintf("Loading redis scripts %v success", entry.ListScripts()))
+	}
+
+	// CONFIG may be disabled by managed services, keyspace notifications should be enabled by other means then
+	if len(entry.notifyKeyspaceEvents) > 0 {
+		if err := entry.configNotifyKeyspaceEvents(context.Background()); err != nil {
+			entry.loggerEntry.Warn("Setting notify-keyspace-events failed", zap.Error(err))
+		} else {
+			entry.loggerEntry.Info(fmt.Sprintf("Setting notify-keyspace-events to %s success", entry.notifyKeyspaceEvents))
+		}
+	}
+
+	// create clients for logical databases, cluster supports database 0 only
+	if len(entry.databases) > 0 && entry.ClientType == cluster {
+		rkentry.ShutdownWithError(fmt.Errorf("logical databases are not supported by redis cluster, entry:%s", entry.entryName))
+	}
+
+	for name, db := range entry.databases {
+		opts := *entry.Opts
+		opts.DB = db
+
+		client := entry.newClient(&opts)
+		if err := entry.ping(context.Background(), client); err != nil {
+			entry.loggerEntry.Info(fmt.Sprintf("Ping redis database [%s] with db:%d failed", name, db))
+			rkentry.ShutdownWithError(err)
+		}
+		entry.addHooks(client)
+
+		entry.clientMap[name] = client
+		entry.loggerEntry.Info(fmt.Sprintf("Creating redis database [%s] with db:%d success", name, db))
 	}
 }
 
@@ -314,6 +475,207 @@ func (entry *RedisEntry) Interrupt(ctx context.Context) {
 		zap.String("clientType", entry.ClientType))
 
 	entry.loggerEntry.Info("Interrupt RedisEntry", fields...)
+
+	entry.stopStreamConsumers()
+	entry.stopSubscriptions()
+
+	// close clients of logical databases and the main client, before embedded redis is stopped
+	for name, client := range entry.clientMap {
+		if err := client.Close(); err != nil {
+			entry.loggerEntry.Warn(fmt.Sprintf("Closing redis database [%s] failed", name), zap.Error(err))
+		}
+	}
+	if entry.Client != nil {
+		if err := entry.Client.Close(); err != nil {
+			entry.loggerEntry.Warn("Closing redis client failed", zap.Error(err))
+		}
+	}
+
+	if entry.memoryServer != nil {
+		addr := entry.memoryServer.Addr()
+		entry.memoryServer.Close()
+		entry.memoryServer = nil
+		entry.loggerEntry.Info(fmt.Sprintf("Stopping embedded redis at %s success", addr))
+	}
+}
+
+// GetKeyPrefix returns prefix of keys added by KeyPrefixHook, empty if not enabled
+func (entry *RedisEntry) GetKeyPrefix() string {
+	return entry.keyPrefix
+}
+
+// addHooks adds hooks of entry into client, hooks added earlier are called earlier.
+// KeyPrefixHook is the last one, so that keys in spans and logs are the ones passed by caller.
+func (entry *RedisEntry) addHooks(client redis.UniversalClient) {
+	client.AddHook(newLoggerHook(entry.entryName, entry.loggerEntry.Logger))
+	client.AddHook(NewRedisTracer())
+
+	if entry.guard != nil {
+		client.AddHook(NewGuardHook(entry.entryName, entry.loggerEntry.Logger, entry.guard))
+	}
+
+	if len(entry.keyPrefix) > 0 {
+		client.AddHook(NewKeyPrefixHook(entry.keyPrefix))
+	}
+}
+
+// IsMemoryMode checks whether embedded redis server is used
+func (entry *RedisEntry) IsMemoryMode() bool {
+	return strings.ToLower(entry.mode) == memory
+}
+
+// GetMemoryServer returns embedded redis server started in memory mode, nil if not in memory mode or not bootstrapped.
+// It is mainly used for tests to manipulate server, like FastForward() keys with TTL.
+func (entry *RedisEntry) GetMemoryServer() *miniredis.Miniredis {
+	return entry.memoryServer
+}
+
+// startMemoryServer starts embedded redis server with credentials of entry,
+// client type would be single and TLS would be disabled.
+func (entry *RedisEntry) startMemoryServer() {
+	server := miniredis.NewMiniRedis()
+	if err := server.Start(); err != nil {
+		entry.loggerEntry.Error("Starting embedded redis failed", zap.Error(err))
+		rkentry.ShutdownWithError(err)
+	}
+
+	switch {
+	case len(entry.Opts.Username) > 0:
+		server.RequireUserAuth(entry.Opts.Username, entry.Opts.Password)
+	case len(entry.Opts.Password) > 0:
+		server.RequireAuth(entry.Opts.Password)
+	}
+
+	entry.memoryServer = server
+	entry.clientTypeOverride = single
+	entry.Opts.Addrs = []string{server.Addr()}
+	entry.Opts.MasterName = ""
+	entry.ringShards = nil
+	entry.certEntry = nil
+	entry.serverName = ""
+	entry.insecureSkipVerify = false
+
+	entry.loggerEntry.Info(fmt.Sprintf("Starting embedded redis at %s success", server.Addr()))
+}
+
+// resolveClientType returns client type configured by user,
+// otherwise guess it from MasterName and number of Addrs as redis.NewUniversalClient does.
+func (entry *RedisEntry) resolveClientType() string {
+	switch strings.ToLower(entry.clientTypeOverride) {
+	case "single":
+		return single
+	case "ha", "failover", "sentinel":
+		return ha
+	case "cluster":
+		return cluster
+	case "ring":
+		return ring
+	case "":
+	default:
+		rkentry.ShutdownWithError(fmt.Errorf("invalid clientType %s of entry %s, should be one of single, ha, failover, sentinel, cluster and ring",
+			entry.clientTypeOverride, entry.entryName))
+	}
+
+	if len(entry.ringShards) > 0 {
+		return ring
+	} else if entry.Opts.MasterName != "" {
+		return ha
+	} else if len(entry.Opts.Addrs) > 1 {
+		return cluster
+	}
+
+	return single
+}
+
+// newClient creates redis.UniversalClient based on ClientType
+func (entry *RedisEntry) newClient(opts *redis.UniversalOptions) redis.UniversalClient {
+	switch entry.ClientType {
+	case ha:
+		opt := opts.Failover()
+		opt.ReplicaOnly = entry.replicaOnly
+		opt.UseDisconnectedReplicas = entry.useDisconnectedReplicas
+		opt.RouteByLatency = opts.RouteByLatency
+		opt.RouteRandomly = opts.RouteRandomly
+
+		// routing read-only commands to replicas is only supported by failover cluster client
+		if opt.RouteByLatency || opt.RouteRandomly {
+			return redis.NewFailoverClusterClient(opt)
+		}
+
+		return redis.NewFailoverClient(opt)
+	case cluster:
+		return redis.NewClusterClient(opts.Cluster())
+	case ring:
+		return redis.NewRing(entry.ringOptions(opts))
+	default:
+		return redis.NewClient(opts.Simple())
+	}
+}
+
+// ringOptions converts redis.UniversalOptions to redis.RingOptions with ring shards
+func (entry *RedisEntry) ringOptions(o *redis.UniversalOptions) *redis.RingOptions {
+	return &redis.RingOptions{
+		Addrs:              entry.ringShards,
+		ClientName:         o.ClientName,
+		HeartbeatFrequency: entry.ringHeartbeatFrequency,
+
+		Dialer:    o.Dialer,
+		OnConnect: o.OnConnect,
+
+		Protocol: o.Protocol,
+		Username: o.Username,
+		Password: o.Password,
+		DB:       o.DB,
+
+		MaxRetries:      o.MaxRetries,
+		MinRetryBackoff: o.MinRetryBackoff,
+		MaxRetryBackoff: o.MaxRetryBackoff,
+
+		DialTimeout:           o.DialTimeout,
+		ReadTimeout:           o.ReadTimeout,
+		WriteTimeout:          o.WriteTimeout,
+		ContextTimeoutEnabled: o.ContextTimeoutEnabled,
+
+		PoolFIFO:        o.PoolFIFO,
+		PoolSize:        o.PoolSize,
+		PoolTimeout:     o.PoolTimeout,
+		MinIdleConns:    o.MinIdleConns,
+		MaxIdleConns:    o.MaxIdleConns,
+		MaxActiveConns:  o.MaxActiveConns,
+		ConnMaxIdleTime: o.ConnMaxIdleTime,
+		ConnMaxLifetime: o.ConnMaxLifetime,
+
+		TLSConfig: o.TLSConfig,
+
+		DisableIndentity: o.DisableIndentity,
+		IdentitySuffix:   o.IdentitySuffix,
+	}
+}
+
+// addrs returns addresses of redis servers, shard addresses would be returned for ring
+func (entry *RedisEntry) addrs() []string {
+	if entry.ClientType != ring {
+		return entry.Opts.Addrs
+	}
+
+	res := make([]string, 0, len(entry.ringShards))
+	for _, v := range entry.ringShards {
+		res = append(res, v)
+	}
+	sort.Strings(res)
+
+	return res
+}
+
+// ping redis server, every shard would be pinged for ring
+func (entry *RedisEntry) ping(ctx context.Context, client redis.UniversalClient) error {
+	if v, ok := client.(*redis.Ring); ok {
+		return v.ForEachShard(ctx, func(ctx context.Context, shard *redis.Client) error {
+			return shard.Ping(ctx).Err()
+		})
+	}
+
+	return client.Ping(ctx).Err()
 }
 
 // GetName returns entry name
@@ -341,9 +703,35 @@ func (entry *RedisEntry) String() string {
 	return string(bytes)
 }
 
-// IsTlsEnabled checks TLS
+// IsTlsEnabled checks TLS, TLS is enabled if certEntry, serverName or insecureSkipVerify is provided
 func (entry *RedisEntry) IsTlsEnabled() bool {
-	return entry.certEntry != nil && entry.certEntry.Certificate != nil
+	if entry.certEntry != nil && (entry.certEntry.Certificate != nil || entry.certEntry.RootCA != nil) {
+		return true
+	}
+
+	return entry.serverName != "" || entry.insecureSkipVerify
+}
+
+// newTLSConfig creates tls.Config with client certificate and root CA from certEntry
+func (entry *RedisEntry) newTLSConfig() *tls.Config {
+	conf := &tls.Config{
+		ServerName:         entry.serverName,
+		InsecureSkipVerify: entry.insecureSkipVerify,
+		MinVersion:         entry.tlsMinVersion,
+	}
+
+	if entry.certEntry != nil {
+		if entry.certEntry.Certificate != nil {
+			conf.Certificates = []tls.Certificate{*entry.certEntry.Certificate}
+		}
+
+		if entry.certEntry.RootCA != nil {
+			conf.RootCAs = x509.NewCertPool()
+			conf.RootCAs.AddCert(entry.certEntry.RootCA)
+		}
+	}
+
+	return conf
 }
 
 // GetClient convert redis.UniversalClient to proper redis.Client
@@ -357,9 +745,11 @@ func (entry *RedisEntry) GetClient() (*redis.Client, bool) {
 	return nil, false
 }
 
-// GetClient convert redis.UniversalClient to proper redis.ClusterClient
+// GetClientCluster convert redis.UniversalClient to proper redis.ClusterClient
+//
+// Failover client with routeByLatency or routeRandomly enabled is also a redis.ClusterClient.
 func (entry *RedisEntry) GetClientCluster() (*redis.ClusterClient, bool) {
-	if entry.Client != nil && entry.ClientType == cluster {
+	if entry.Client != nil && (entry.ClientType == cluster || entry.ClientType == ha) {
 		if v, ok := entry.Client.(*redis.ClusterClient); ok {
 			return v, true
 		}
@@ -368,6 +758,28 @@ func (entry *RedisEntry) GetClientCluster() (*redis.ClusterClient, bool) {
 	return nil, false
 }
 
+// GetRing convert redis.UniversalClient to proper redis.Ring
+func (entry *RedisEntry) GetRing() (*redis.Ring, bool) {
+	if entry.Client != nil && entry.ClientType == ring {
+		if v, ok := entry.Client.(*redis.Ring); ok {
+			return v, true
+		}
+	}
+
+	return nil, false
+}
+
+// GetClientByName returns redis.UniversalClient of logical database configured with WithDatabase
+func (entry *RedisEntry) GetClientByName(name string) redis.UniversalClient {
+	return entry.clientMap[name]
+}
+
+// GetUniversalClient returns client of entry regardless of client type, nil if not bootstrapped.
+// It is used by plugins of other entries which access RedisEntry as rkentry.Entry.
+func (entry *RedisEntry) GetUniversalClient() redis.UniversalClient {
+	return entry.Client
+}
+
 // ************* Option *************
 
 // Option for RedisEntry
@@ -394,6 +806,27 @@ func WithCertEntry(in *rkentry.CertEntry) Option {
 	}
 }
 
+// WithInsecureSkipVerify provide InsecureSkipVerify of tls.Config
+func WithInsecureSkipVerify(skip bool) Option {
+	return func(entry *RedisEntry) {
+		entry.insecureSkipVerify = skip
+	}
+}
+
+// WithServerName provide ServerName of tls.Config used to verify certificate of server
+func WithServerName(serverName string) Option {
+	return func(entry *RedisEntry) {
+		entry.serverName = serverName
+	}
+}
+
+// WithTLSMinVersion provide MinVersion of tls.Config, like tls.VersionTLS12
+func WithTLSMinVersion(version uint16) Option {
+	return func(entry *RedisEntry) {
+		entry.tlsMinVersion = version
+	}
+}
+
 // WithUniversalOption provide redis.UniversalOptions
 func WithUniversalOption(opt *redis.UniversalOptions) Option {
 	return func(e *RedisEntry) {
@@ -403,6 +836,119 @@ func WithUniversalOption(opt *redis.UniversalOptions) Option {
 	}
 }
 
+// WithMode provide mode of entry, embedded redis server would be started at Bootstrap if mode is memory
+func WithMode(mode string) Option {
+	return func(e *RedisEntry) {
+		e.mode = mode
+	}
+}
+
+// WithClientType provide client type, one of single, failover(ha, sentinel) and cluster.
+// Client type would be guessed from MasterName and Addrs if empty.
+func WithClientType(clientType string) Option {
+	return func(e *RedisEntry) {
+		e.clientTypeOverride = clientType
+	}
+}
+
+// WithFailoverOption provide failover only options which is missing in redis.UniversalOptions
+func WithFailoverOption(replicaOnly, useDisconnectedReplicas bool) Option {
+	return func(e *RedisEntry) {
+		e.replicaOnly = replicaOnly
+		e.useDisconnectedReplicas = useDisconnectedReplicas
+	}
+}
+
+// WithRing provide ring shards with name => host:port and heartbeat frequency.
+// Common options like credentials and pool would be copied from redis.UniversalOptions.
+func WithRing(shards map[string]string, heartbeatFrequency time.Duration) Option {
+	return func(e *RedisEntry) {
+		if len(shards) > 0 {
+			e.ringShards = shards
+		}
+
+		if heartbeatFrequency > 0 {
+			e.ringHeartbeatFrequency = heartbeatFrequency
+		}
+	}
+}
+
+// WithDatabase provide named logical database index which shares addresses, credentials and TLS with entry
+func WithDatabase(name string, db int) Option {
+	return func(e *RedisEntry) {
+		if len(name) > 0 {
+			e.databases[name] = db
+		}
+	}
+}
+
+// WithScript provide Lua script with name which would be loaded at Bootstrap and run with RunScript
+func WithScript(name, src string) Option {
+	return func(e *RedisEntry) {
+		if len(name) > 0 && len(src) > 0 {
+			e.scripts[name] = redis.NewScript(src)
+		}
+	}
+}
+
+// WithScriptFS provide Lua scripts of *.lua files in dir of fsys, like embed.FS,
+// name of script is relative path to dir without extension.
+func WithScriptFS(fsys fs.FS, dir string) Option {
+	return func(e *RedisEntry) {
+		if fsys == nil {
+			return
+		}
+
+		scripts, err := readScripts(fsys, dir)
+		if err != nil {
+			rkentry.ShutdownWithError(fmt.Errorf("read redis scripts in [%s] failed, %v", dir, err))
+		}
+
+		for name, src := range scripts {
+			e.scripts[name] = redis.NewScript(src)
+		}
+	}
+}
+
+// WithRateLimitPrefix provide prefix of keys used by RateLimiter, default: rk:rate:
+func WithRateLimitPrefix(prefix string) Option {
+	return func(e *RedisEntry) {
+		if len(prefix) > 0 {
+			e.rateLimitPrefix = prefix
+		}
+	}
+}
+
+// WithRateLimit provide named rate limit which could be used with RateLimiter.AllowByName
+func WithRateLimit(name string, limit *RateLimit) Option {
+	return func(e *RedisEntry) {
+		if len(name) > 0 && limit != nil {
+			e.rateLimits[name] = limit
+		}
+	}
+}
+
+// WithKeyPrefix provide prefix of keys, like myapp:, keys of commands would be rewritten by KeyPrefixHook
+func WithKeyPrefix(prefix string) Option {
+	return func(e *RedisEntry) {
+		e.keyPrefix = prefix
+	}
+}
+
+// WithGuard provide Guard of commands applied by GuardHook
+func WithGuard(guard *Guard) Option {
+	return func(e *RedisEntry) {
+		e.guard = guard
+	}
+}
+
+// WithNotifyKeyspaceEvents provide flags of notify-keyspace-events set in every node at Bootstrap, like Kx
+func WithNotifyKeyspaceEvents(flags string) Option {
+	return func(e *RedisEntry) {
+		e.notifyKeyspaceEvents = flags
+	}
+}
+
 // WithLoggerEntry provide rkentry.LoggerEntry entry name
 func WithLoggerEntry(entry *rkentry.LoggerEntry) Option {
 	return func(m *RedisEntry) {
@@ -4,9 +4,12 @@ import (
 	"context"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
+	"errors"
+	"github.com/redis/go-redis/v9"
 	"github.com/rookie-ninja/rk-entry/v2/entry"
 	"github.com/stretchr/testify/assert"
 	"math/big"
@@ -45,6 +48,93 @@ redis:
 	rkentry.GlobalAppCtx.RemoveEntry(entry)
 }
 
+func TestToRedisUniversalOptions(t *testing.T) {
+	// with nil
+	assert.Nil(t, ToRedisUniversalOptions(nil))
+
+	// with disabled
+	assert.Nil(t, ToRedisUniversalOptions(&BootRedisE{}))
+
+	// happy case
+	opts := ToRedisUniversalOptions(&BootRedisE{
+		Enabled:         true,
+		Addrs:           []string{"localhost:26379"},
+		ClientName:      "ut-client",
+		Protocol:        2,
+		MasterName:      "ut-master",
+		SentinelUser:    "ut-sentinel-user",
+		SentinelPass:    "ut-sentinel-pass",
+		RouteByLatency:  true,
+		MaxActiveConn:   1,
+		DisableIdentity: true,
+		IdentitySuffix:  "ut-suffix",
+	})
+
+	assert.Equal(t, []string{"localhost:26379"}, opts.Addrs)
+	assert.Equal(t, "ut-client", opts.ClientName)
+	assert.Equal(t, 2, opts.Protocol)
+	assert.Equal(t, "ut-master", opts.MasterName)
+	assert.Equal(t, "ut-sentinel-user", opts.SentinelUsername)
+	assert.Equal(t, "ut-sentinel-pass", opts.SentinelPassword)
+	assert.True(t, opts.RouteByLatency)
+	assert.Equal(t, 1, opts.MaxActiveConns)
+	assert.True(t, opts.DisableIndentity)
+	assert.Equal(t, "ut-suffix", opts.IdentitySuffix)
+}
+
+func TestRedisEntry_resolveClientType(t *testing.T) {
+	defer assertNotPanic(t)
+
+	// guess single
+	entry := RegisterRedisEntry()
+	assert.Equal(t, single, entry.resolveClientType())
+
+	// guess failover
+	entry.Opts.MasterName = "ut-master"
+	assert.Equal(t, ha, entry.resolveClientType())
+
+	// guess cluster
+	entry.Opts.MasterName = ""
+	entry.Opts.Addrs = append(entry.Opts.Addrs, "localhost:6380")
+	assert.Equal(t, cluster, entry.resolveClientType())
+
+	// override
+	WithClientType("single")(entry)
+	assert.Equal(t, single, entry.resolveClientType())
+	WithClientType("Failover")(entry)
+	assert.Equal(t, ha, entry.resolveClientType())
+	WithClientType("cluster")(entry)
+	assert.Equal(t, cluster, entry.resolveClientType())
+
+	// guess ring
+	WithClientType("")(entry)
+	WithRing(map[string]string{"shard-1": "localhost:7000", "shard-2": "localhost:7001"}, time.Second)(entry)
+	assert.Equal(t, ring, entry.resolveClientType())
+	entry.ClientType = entry.resolveClientType()
+	assert.Equal(t, []string{"localhost:7000", "localhost:7001"}, entry.addrs())
+	assert.Equal(t, time.Second, entry.ringOptions(entry.Opts).HeartbeatFrequency)
+	WithClientType("cluster")(entry)
+	assert.Equal(t, cluster, entry.resolveClientType())
+
+	// failover with route by latency
+	WithClientType("sentinel")(entry)
+	WithFailoverOption(true, false)(entry)
+	entry.Opts.RouteByLatency = true
+	entry.ClientType = entry.resolveClientType()
+	_, ok := entry.newClient(entry.Opts).(*redis.ClusterClient)
+	assert.True(t, ok)
+
+	rkentry.GlobalAppCtx.RemoveEntry(entry)
+}
+
+func TestRedisEntry_resolveClientType_WithInvalidType(t *testing.T) {
+	defer assertPanic(t)
+
+	entry := RegisterRedisEntry(WithClientType("clustr"))
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+	entry.resolveClientType()
+}
+
 func TestRedisEntry_Bootstrap(t *testing.T) {
 	defer assertPanic(t)
 
@@ -93,6 +183,207 @@ func TestRedisEntry_Bootstrap(t *testing.T) {
 	entry.Interrupt(context.TODO())
 }
 
+func TestRedisEntry_GetRing(t *testing.T) {
+	defer assertNotPanic(t)
+
+	entry := RegisterRedisEntry(
+		WithRing(map[string]string{"shard-1": "localhost:7000"}, 0))
+	entry.ClientType = entry.resolveClientType()
+	entry.Client = entry.newClient(entry.Opts)
+	entry.Client.AddHook(NewRedisTracer())
+
+	ring, ok := entry.GetRing()
+	assert.NotNil(t, ring)
+	assert.True(t, ok)
+
+	client, ok := entry.GetClient()
+	assert.Nil(t, client)
+	assert.False(t, ok)
+
+	cluster, ok := entry.GetClientCluster()
+	assert.Nil(t, cluster)
+	assert.False(t, ok)
+
+	rkentry.GlobalAppCtx.RemoveEntry(entry)
+}
+
+func TestRegisterRedisEntryYAML_WithRing(t *testing.T) {
+	bootConfigStr := `
+redis:
+  - name: ut-redis-ring
+    enabled: true
+    ring:
+      shards:
+        shard-1: "localhost:7000"
+        shard-2: "localhost:7001"
+      heartbeatFrequencyMs: 100
+`
+
+	entries := RegisterRedisEntryYAML([]byte(bootConfigStr))
+
+	entry := entries["ut-redis-ring"].(*RedisEntry)
+	assert.Len(t, entry.ringShards, 2)
+	assert.Equal(t, 100*time.Millisecond, entry.ringHeartbeatFrequency)
+	assert.Equal(t, ring, entry.resolveClientType())
+
+	rkentry.GlobalAppCtx.RemoveEntry(entry)
+}
+
+func TestRegisterRedisEntryYAML_WithDatabases(t *testing.T) {
+	bootConfigStr := `
+redis:
+  - name: ut-redis-databases
+    enabled: true
+    addrs: ["localhost:6379"]
+    databases:
+      - name: sessions
+        db: 1
+      - name: cache
+        db: 2
+`
+
+	entries := RegisterRedisEntryYAML([]byte(bootConfigStr))
+
+	entry := entries["ut-redis-databases"].(*RedisEntry)
+	assert.Equal(t, map[string]int{"sessions": 1, "cache": 2}, entry.databases)
+	assert.Nil(t, entry.GetClientByName("sessions"))
+
+	rkentry.GlobalAppCtx.RemoveEntry(entry)
+}
+
+func TestRedisEntry_Interrupt(t *testing.T) {
+	entry := RegisterRedisEntry(
+		WithName("ut-redis-interrupt"),
+		WithMode("memory"),
+		WithDatabase("sessions", 1))
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	entry.Bootstrap(context.TODO())
+	sessions := entry.GetClientByName("sessions")
+	assert.NotNil(t, sessions)
+	assert.Nil(t, sessions.Ping(context.TODO()).Err())
+
+	// clients are closed rather than failing to connect to stopped embedded redis
+	entry.Interrupt(context.TODO())
+	assert.Equal(t, redis.ErrClosed, sessions.Ping(context.TODO()).Err())
+	assert.Equal(t, redis.ErrClosed, entry.Client.Ping(context.TODO()).Err())
+}
+
+func TestRedisEntry_MemoryMode(t *testing.T) {
+	// not memory mode
+	entry := RegisterRedisEntry()
+	assert.False(t, entry.IsMemoryMode())
+	assert.Nil(t, entry.GetMemoryServer())
+	assert.Nil(t, entry.GetUniversalClient())
+	rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	// with password
+	entry = RegisterRedisEntry(
+		WithMode("memory"),
+		WithUniversalOption(&redis.UniversalOptions{
+			Addrs:    []string{"localhost:6379", "localhost:6380"},
+			Password: "pass",
+		}))
+	entry.Bootstrap(context.TODO())
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	assert.True(t, entry.IsMemoryMode())
+	assert.Equal(t, single, entry.ClientType)
+	assert.Equal(t, []string{entry.GetMemoryServer().Addr()}, entry.Opts.Addrs)
+
+	client, ok := entry.GetClient()
+	assert.True(t, ok)
+	assert.Equal(t, entry.Client, entry.GetUniversalClient())
+	assert.Nil(t, client.Set(context.TODO(), "key", "value", 0).Err())
+	assert.Equal(t, "value", client.Get(context.TODO(), "key").Val())
+
+	// wrong password
+	assert.NotNil(t, redis.NewClient(&redis.Options{
+		Addr:     entry.GetMemoryServer().Addr(),
+		Password: "wrong",
+	}).Ping(context.TODO()).Err())
+
+	entry.Interrupt(context.TODO())
+	assert.NotNil(t, client.Ping(context.TODO()).Err())
+}
+
+func TestRegisterRedisEntryYAML_WithMemoryMode(t *testing.T) {
+	bootConfigStr := `
+redis:
+  - name: ut-redis-memory
+    enabled: true
+    mode: memory
+    addrs: ["localhost:6379"]
+    keyPrefix: "ut:"
+    notifyKeyspaceEvents: "Kx"
+    guard:
+      enabled: true
+      rules:
+        - deny: ["FLUSHALL"]
+`
+
+	entries := RegisterRedisEntryYAML([]byte(bootConfigStr))
+
+	entry := entries["ut-redis-memory"].(*RedisEntry)
+	assert.True(t, entry.IsMemoryMode())
+	assert.Equal(t, "ut:", entry.GetKeyPrefix())
+	assert.Equal(t, "Kx", entry.notifyKeyspaceEvents)
+
+	entry.Bootstrap(context.TODO())
+	assert.NotNil(t, entry.GetMemoryServer())
+	assert.Nil(t, entry.Client.Ping(context.TODO()).Err())
+	assert.Nil(t, entry.Client.Set(context.TODO(), "key", "value", 0).Err())
+	assert.True(t, entry.GetMemoryServer().Exists("ut:key"))
+	assert.True(t, errors.Is(entry.Client.FlushAll(context.TODO()).Err(), ErrCommandDenied))
+
+	entry.Interrupt(context.TODO())
+	rkentry.GlobalAppCtx.RemoveEntry(entry)
+}
+
+func TestRedisEntry_newTLSConfig(t *testing.T) {
+	defer assertNotPanic(t)
+
+	// without TLS
+	entry := RegisterRedisEntry()
+	assert.False(t, entry.IsTlsEnabled())
+
+	// with skip verify only
+	WithInsecureSkipVerify(true)(entry)
+	assert.True(t, entry.IsTlsEnabled())
+	assert.True(t, entry.newTLSConfig().InsecureSkipVerify)
+
+	// with cert entry
+	certPem, keyPem := generateCerts()
+	cert, err := tls.X509KeyPair(certPem, keyPem)
+	assert.Nil(t, err)
+	block, _ := pem.Decode(certPem)
+	rootCA, err := x509.ParseCertificate(block.Bytes)
+	assert.Nil(t, err)
+
+	WithInsecureSkipVerify(false)(entry)
+	WithCertEntry(&rkentry.CertEntry{RootCA: rootCA, Certificate: &cert})(entry)
+	WithServerName("ut-server")(entry)
+	WithTLSMinVersion(toTLSVersion("1.2"))(entry)
+	assert.True(t, entry.IsTlsEnabled())
+
+	conf := entry.newTLSConfig()
+	assert.Len(t, conf.Certificates, 1)
+	assert.NotNil(t, conf.RootCAs)
+	assert.Equal(t, "ut-server", conf.ServerName)
+	assert.Equal(t, uint16(tls.VersionTLS12), conf.MinVersion)
+	assert.False(t, conf.InsecureSkipVerify)
+
+	rkentry.GlobalAppCtx.RemoveEntry(entry)
+}
+
+func TestToTLSVersion(t *testing.T) {
+	assert.Equal(t, uint16(0), toTLSVersion(""))
+	assert.Equal(t, uint16(tls.VersionTLS10), toTLSVersion("1.0"))
+	assert.Equal(t, uint16(tls.VersionTLS11), toTLSVersion("TLS1.1"))
+	assert.Equal(t, uint16(tls.VersionTLS12), toTLSVersion("tls12"))
+	assert.Equal(t, uint16(tls.VersionTLS13), toTLSVersion("1.3"))
+}
+
 func generateCerts() ([]byte, []byte) {
 	// Create certs and return as []byte
 	ca := &x509.Certificate{
@@ -0,0 +1,334 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkredis
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/sync/singleflight"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	tierLocal = "local"
+	tierRedis = "redis"
+
+	// cachePrefixSeparator separates prefix of key used as label of metrics, like user in user:1
+	cachePrefixSeparator = ":"
+)
+
+// ErrCacheMiss is returned by Cache.Get if key not found
+var ErrCacheMiss = errors.New("cache miss")
+
+// CacheLoader loads value if missing in cache
+type CacheLoader func(ctx context.Context) (interface{}, error)
+
+// CacheOption option of Cache
+type CacheOption func(*Cache)
+
+// WithCacheCodec provide codec of values, default: JSONCodec
+func WithCacheCodec(codec Codec) CacheOption {
+	return func(c *Cache) {
+		if codec != nil {
+			c.codec = codec
+		}
+	}
+}
+
+// WithCacheTTLJitter provide jitter of TTL, TTL would be reduced randomly by at most ttl*jitter
+// to prevent keys expired at the same time, should be in [0, 1), default: 0.1
+func WithCacheTTLJitter(jitter float64) CacheOption {
+	return func(c *Cache) {
+		if jitter >= 0 && jitter < 1 {
+			c.jitter = jitter
+		}
+	}
+}
+
+// WithCacheLocal provide in-process LRU tier in front of redis with max size and TTL of values.
+// Values in local tier are not invalidated by other processes, so TTL should be short.
+func WithCacheLocal(size int, ttl time.Duration) CacheOption {
+	return func(c *Cache) {
+		if size > 0 && ttl > 0 {
+			c.local = newLRU(size)
+			c.localTTL = ttl
+		}
+	}
+}
+
+// Cache is a cache-aside layer on client of RedisEntry
+type Cache struct {
+	entry    *RedisEntry
+	codec    Codec
+	jitter   float64
+	local    *lru
+	localTTL time.Duration
+	group    singleflight.Group
+}
+
+// NewCache creates Cache on client of RedisEntry
+func (entry *RedisEntry) NewCache(opts ...CacheOption) *Cache {
+	c := &Cache{
+		entry:  entry,
+		codec:  JSONCodec,
+		jitter: 0.1,
+	}
+
+	for i := range opts {
+		opts[i](c)
+	}
+
+	return c
+}
+
+// Get decodes value of key into v, ErrCacheMiss would be returned if key not found
+func (c *Cache) Get(ctx context.Context, key string, v interface{}) error {
+	data, err := c.get(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	return c.codec.Unmarshal(data, v)
+}
+
+// Set encodes v and sets it with TTL with jitter, zero TTL means no expiration
+func (c *Cache) Set(ctx context.Context, key string, v interface{}, ttl time.Duration) error {
+	data, err := c.codec.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return c.set(ctx, key, data, ttl)
+}
+
+// Delete removes keys from local tier and redis
+func (c *Cache) Delete(ctx context.Context, keys ...string) error {
+	if c.local != nil {
+		for i := range keys {
+			c.local.remove(keys[i])
+		}
+	}
+
+	if c.entry.Client == nil {
+		return c.notInitialized()
+	}
+
+	// delete keys one by one, since keys may belong to different slots in cluster
+	for i := range keys {
+		if err := c.entry.Client.Del(ctx, keys[i]).Err(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Once decodes value of key into v, value would be loaded by loader and set with TTL if missing.
+// Concurrent misses of the same key in process share one loader call, which runs with values of ctx but
+// is not canceled by any caller, every caller stops waiting when its own ctx is done.
+// Errors of redis other than miss are returned as they are, undecodable value is loaded again.
+func (c *Cache) Once(ctx context.Context, key string, v interface{}, ttl time.Duration, loader CacheLoader) error {
+	data, err := c.get(ctx, key)
+	switch {
+	case err == nil:
+		if c.codec.Unmarshal(data, v) == nil {
+			return nil
+		}
+	case !errors.Is(err, ErrCacheMiss):
+		return err
+	}
+
+	resCh := c.group.DoChan(key, func() (interface{}, error) {
+		// shared by callers, so it is not canceled with ctx of the first caller
+		loadCtx := withoutCancel(ctx)
+
+		value, err := loader(loadCtx)
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := c.codec.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := c.set(loadCtx, key, data, ttl); err != nil {
+			c.entry.loggerEntry.Warn(fmt.Sprintf("Setting cache [%s] failed", key))
+		}
+
+		return data, nil
+	})
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case res := <-resCh:
+		if res.Err != nil {
+			return res.Err
+		}
+		return c.codec.Unmarshal(res.Val.([]byte), v)
+	}
+}
+
+func (c *Cache) get(ctx context.Context, key string) ([]byte, error) {
+	if c.local != nil {
+		if data, ok := c.local.get(key); ok {
+			c.hit(key, tierLocal)
+			return data, nil
+		}
+	}
+
+	if c.entry.Client == nil {
+		return nil, c.notInitialized()
+	}
+
+	data, err := c.entry.Client.Get(ctx, key).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			c.miss(key)
+			return nil, ErrCacheMiss
+		}
+		return nil, err
+	}
+	c.hit(key, tierRedis)
+
+	if c.local != nil {
+		c.local.set(key, data, c.localTTL)
+	}
+
+	return data, nil
+}
+
+func (c *Cache) set(ctx context.Context, key string, data []byte, ttl time.Duration) error {
+	if c.entry.Client == nil {
+		return c.notInitialized()
+	}
+
+	if err := c.entry.Client.Set(ctx, key, data, c.withJitter(ttl)).Err(); err != nil {
+		return err
+	}
+
+	if c.local != nil {
+		localTTL := c.localTTL
+		if ttl > 0 && ttl < localTTL {
+			localTTL = ttl
+		}
+		c.local.set(key, data, localTTL)
+	}
+
+	return nil
+}
+
+// withJitter reduces ttl randomly by at most ttl*jitter
+func (c *Cache) withJitter(ttl time.Duration) time.Duration {
+	if ttl <= 0 || c.jitter <= 0 {
+		return ttl
+	}
+
+	return ttl - time.Duration(rand.Float64()*c.jitter*float64(ttl))
+}
+
+func (c *Cache) hit(key, tier string) {
+	incCounter("cacheHit", c.entry.GetName(), cachePrefix(key), tier)
+}
+
+func (c *Cache) miss(key string) {
+	incCounter("cacheMiss", c.entry.GetName(), cachePrefix(key))
+}
+
+func (c *Cache) notInitialized() error {
+	return fmt.Errorf("redis client of entry [%s] is not initialized, please call Bootstrap first", c.entry.GetName())
+}
+
+// cachePrefix returns prefix of key before the first separator, used as label of metrics
+func cachePrefix(key string) string {
+	if i := strings.Index(key, cachePrefixSeparator); i > 0 {
+		return key[:i]
+	}
+
+	return "none"
+}
+
+// ************* LRU *************
+
+type lruItem struct {
+	key      string
+	data     []byte
+	expireAt time.Time
+}
+
+// lru is a thread safe LRU with TTL of items
+type lru struct {
+	size  int
+	items map[string]*list.Element
+	order *list.List
+	mutex sync.Mutex
+}
+
+func newLRU(size int) *lru {
+	return &lru{
+		size:  size,
+		items: make(map[string]*list.Element),
+		order: list.New(),
+	}
+}
+
+func (l *lru) get(key string) ([]byte, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	elem, ok := l.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	item := elem.Value.(*lruItem)
+	if time.Now().After(item.expireAt) {
+		l.order.Remove(elem)
+		delete(l.items, key)
+		return nil, false
+	}
+
+	l.order.MoveToFront(elem)
+	return item.data, true
+}
+
+func (l *lru) set(key string, data []byte, ttl time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	item := &lruItem{key: key, data: data, expireAt: time.Now().Add(ttl)}
+
+	if elem, ok := l.items[key]; ok {
+		elem.Value = item
+		l.order.MoveToFront(elem)
+		return
+	}
+
+	l.items[key] = l.order.PushFront(item)
+
+	for l.order.Len() > l.size {
+		oldest := l.order.Back()
+		l.order.Remove(oldest)
+		delete(l.items, oldest.Value.(*lruItem).key)
+	}
+}
+
+func (l *lru) remove(key string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if elem, ok := l.items[key]; ok {
+		l.order.Remove(elem)
+		delete(l.items, key)
+	}
+}
@@ -0,0 +1,289 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkredis
+
+import (
+	"context"
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rookie-ninja/rk-entry/v2/entry"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type cacheUser struct {
+	Name string `json:"name" msgpack:"name"`
+	Age  int    `json:"age" msgpack:"age"`
+}
+
+func TestCodecs(t *testing.T) {
+	user := &cacheUser{Name: "ut", Age: 1}
+
+	for _, codec := range []Codec{JSONCodec, MsgpackCodec, WithCompression(JSONCodec)} {
+		data, err := codec.Marshal(user)
+		assert.Nil(t, err, codec.Name())
+
+		res := &cacheUser{}
+		assert.Nil(t, codec.Unmarshal(data, res), codec.Name())
+		assert.Equal(t, user, res, codec.Name())
+	}
+
+	// protobuf
+	data, err := ProtobufCodec.Marshal(wrapperspb.String("ut"))
+	assert.Nil(t, err)
+	res := &wrapperspb.StringValue{}
+	assert.Nil(t, ProtobufCodec.Unmarshal(data, res))
+	assert.Equal(t, "ut", res.GetValue())
+
+	_, err = ProtobufCodec.Marshal(user)
+	assert.NotNil(t, err)
+	assert.NotNil(t, ProtobufCodec.Unmarshal(data, user))
+}
+
+func TestCompressedCodec(t *testing.T) {
+	codec := WithCompression(JSONCodec)
+	assert.Equal(t, "json+gzip", codec.Name())
+
+	// small value is not compressed
+	data, err := codec.Marshal("ut")
+	assert.Nil(t, err)
+	assert.Equal(t, uncompressed, data[0])
+
+	// large value is compressed
+	large := strings.Repeat("a", 2*defaultCompressThreshold)
+	data, err = codec.Marshal(large)
+	assert.Nil(t, err)
+	assert.Equal(t, gzipped, data[0])
+	assert.Less(t, len(data), len(large))
+
+	var res string
+	assert.Nil(t, codec.Unmarshal(data, &res))
+	assert.Equal(t, large, res)
+
+	// invalid
+	assert.NotNil(t, codec.Unmarshal(nil, &res))
+	assert.NotNil(t, codec.Unmarshal([]byte{9}, &res))
+}
+
+func TestCache_GetSetDelete(t *testing.T) {
+	// not bootstrapped
+	entry := RegisterRedisEntry()
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+	cache := entry.NewCache()
+	assert.NotNil(t, cache.Set(context.TODO(), "user:1", &cacheUser{}, time.Minute))
+	assert.NotNil(t, cache.Get(context.TODO(), "user:1", &cacheUser{}))
+
+	entry = newMemoryEntry(t)
+	cache = entry.NewCache(WithCacheCodec(MsgpackCodec))
+
+	res := &cacheUser{}
+	assert.True(t, errors.Is(cache.Get(context.TODO(), "user:1", res), ErrCacheMiss))
+
+	user := &cacheUser{Name: "ut", Age: 1}
+	assert.Nil(t, cache.Set(context.TODO(), "user:1", user, time.Minute))
+	assert.Nil(t, cache.Get(context.TODO(), "user:1", res))
+	assert.Equal(t, user, res)
+	assert.True(t, entry.memoryServer.TTL("user:1") <= time.Minute)
+
+	assert.Nil(t, cache.Delete(context.TODO(), "user:1"))
+	assert.True(t, errors.Is(cache.Get(context.TODO(), "user:1", res), ErrCacheMiss))
+
+	// without expiration
+	assert.Nil(t, cache.Set(context.TODO(), "user:2", user, 0))
+	assert.Equal(t, time.Duration(0), entry.memoryServer.TTL("user:2"))
+}
+
+func TestCache_WithJitter(t *testing.T) {
+	cache := &Cache{jitter: 0.1}
+	for i := 0; i < 100; i++ {
+		ttl := cache.withJitter(time.Minute)
+		assert.True(t, ttl > 54*time.Second && ttl <= time.Minute)
+	}
+	assert.Equal(t, time.Duration(0), cache.withJitter(0))
+
+	// invalid jitter is ignored
+	cache = RegisterRedisEntry().NewCache(WithCacheTTLJitter(1))
+	defer rkentry.GlobalAppCtx.RemoveEntry(cache.entry)
+	assert.Equal(t, 0.1, cache.jitter)
+	cache = cache.entry.NewCache(WithCacheTTLJitter(0))
+	assert.Equal(t, time.Minute, cache.withJitter(time.Minute))
+}
+
+func TestCache_Once(t *testing.T) {
+	entry := newMemoryEntry(t)
+	cache := entry.NewCache()
+
+	var calls int32
+	release := make(chan struct{})
+	loader := func(ctx context.Context) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return &cacheUser{Name: "ut", Age: 1}, nil
+	}
+
+	// concurrent misses share one loader call
+	wg := sync.WaitGroup{}
+	results := make([]*cacheUser, 10)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = &cacheUser{}
+			assert.Nil(t, cache.Once(context.TODO(), "user:1", results[i], time.Minute, loader))
+		}(i)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	for i := range results {
+		assert.Equal(t, "ut", results[i].Name)
+	}
+
+	// cached
+	res := &cacheUser{}
+	assert.Nil(t, cache.Once(context.TODO(), "user:1", res, time.Minute, loader))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	// error of loader is not cached
+	err := cache.Once(context.TODO(), "user:2", res, time.Minute, func(ctx context.Context) (interface{}, error) {
+		return nil, errors.New("ut error")
+	})
+	assert.NotNil(t, err)
+	assert.False(t, entry.memoryServer.Exists("user:2"))
+}
+
+func TestCache_OnceWithError(t *testing.T) {
+	entry := newMemoryEntry(t)
+	cache := entry.NewCache()
+
+	var calls int32
+	loader := func(ctx context.Context) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		return &cacheUser{Name: "ut"}, nil
+	}
+
+	// error of redis is returned without loading
+	entry.memoryServer.SetError("ERR ut")
+	res := &cacheUser{}
+	err := cache.Once(context.TODO(), "user:1", res, time.Minute, loader)
+	assert.NotNil(t, err)
+	assert.False(t, errors.Is(err, ErrCacheMiss))
+	assert.Zero(t, atomic.LoadInt32(&calls))
+	entry.memoryServer.SetError("")
+
+	// undecodable value is loaded again
+	assert.Nil(t, entry.memoryServer.Set("user:1", "{"))
+	assert.Nil(t, cache.Once(context.TODO(), "user:1", res, time.Minute, loader))
+	assert.Equal(t, "ut", res.Name)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestCache_OnceCanceled(t *testing.T) {
+	entry := newMemoryEntry(t)
+	cache := entry.NewCache()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	loaderErr := make(chan error, 1)
+	loader := func(ctx context.Context) (interface{}, error) {
+		close(started)
+		<-release
+		loaderErr <- ctx.Err()
+		return &cacheUser{Name: "ut"}, nil
+	}
+
+	// the first caller is canceled while loading
+	ctx, cancel := context.WithCancel(context.TODO())
+	first := make(chan error, 1)
+	go func() {
+		first <- cache.Once(ctx, "user:1", &cacheUser{}, time.Minute, loader)
+	}()
+	<-started
+
+	second := make(chan error, 1)
+	res := &cacheUser{}
+	go func() {
+		second <- cache.Once(context.TODO(), "user:1", res, time.Minute, loader)
+	}()
+
+	cancel()
+	assert.Equal(t, context.Canceled, <-first)
+
+	// waiters are not failed by the canceled caller
+	close(release)
+	assert.Nil(t, <-second)
+	assert.Nil(t, <-loaderErr)
+	assert.Equal(t, "ut", res.Name)
+	assert.True(t, entry.memoryServer.Exists("user:1"))
+}
+
+func TestCache_Local(t *testing.T) {
+	entry := newMemoryEntry(t)
+	cache := entry.NewCache(WithCacheLocal(1, time.Minute))
+
+	assert.Nil(t, cache.Set(context.TODO(), "user:1", "ut", time.Minute))
+
+	// served by local tier even if removed from redis
+	entry.memoryServer.Del("user:1")
+	var res string
+	assert.Nil(t, cache.Get(context.TODO(), "user:1", &res))
+	assert.Equal(t, "ut", res)
+
+	// evicted by size
+	assert.Nil(t, cache.Set(context.TODO(), "user:2", "ut", time.Minute))
+	assert.True(t, errors.Is(cache.Get(context.TODO(), "user:1", &res), ErrCacheMiss))
+
+	// filled by redis hit
+	entry.memoryServer.Set("user:3", `"redis"`)
+	assert.Nil(t, cache.Get(context.TODO(), "user:3", &res))
+	entry.memoryServer.Del("user:3")
+	assert.Nil(t, cache.Get(context.TODO(), "user:3", &res))
+	assert.Equal(t, "redis", res)
+
+	// removed by Delete
+	assert.Nil(t, cache.Delete(context.TODO(), "user:3"))
+	assert.True(t, errors.Is(cache.Get(context.TODO(), "user:3", &res), ErrCacheMiss))
+}
+
+func TestLRU_Expired(t *testing.T) {
+	l := newLRU(2)
+	l.set("k", []byte("v"), time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	_, ok := l.get("k")
+	assert.False(t, ok)
+	assert.Equal(t, 0, l.order.Len())
+}
+
+func TestCache_Metrics(t *testing.T) {
+	entry := newMemoryEntry(t)
+	cache := entry.NewCache(WithCacheLocal(10, time.Minute))
+
+	metrics := getMetrics()
+	hitLocal := testutil.ToFloat64(metrics.GetCounterWithValues("cacheHit", entry.GetName(), "order", tierLocal))
+	hitRedis := testutil.ToFloat64(metrics.GetCounterWithValues("cacheHit", entry.GetName(), "order", tierRedis))
+	miss := testutil.ToFloat64(metrics.GetCounterWithValues("cacheMiss", entry.GetName(), "order"))
+
+	var res string
+	cache.Get(context.TODO(), "order:1", &res)
+	entry.memoryServer.Set("order:1", `"ut"`)
+	cache.Get(context.TODO(), "order:1", &res)
+	cache.Get(context.TODO(), "order:1", &res)
+
+	assert.Equal(t, miss+1, testutil.ToFloat64(metrics.GetCounterWithValues("cacheMiss", entry.GetName(), "order")))
+	assert.Equal(t, hitRedis+1, testutil.ToFloat64(metrics.GetCounterWithValues("cacheHit", entry.GetName(), "order", tierRedis)))
+	assert.Equal(t, hitLocal+1, testutil.ToFloat64(metrics.GetCounterWithValues("cacheHit", entry.GetName(), "order", tierLocal)))
+
+	assert.Equal(t, "none", cachePrefix("order"))
+	assert.Nil(t, entry.RegisterPromMetrics(prometheus.NewRegistry()))
+}
@@ -0,0 +1,157 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkredis
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+	"io"
+)
+
+const (
+	// flags of compressed data, the first byte of value
+	uncompressed byte = 0
+	gzipped      byte = 1
+
+	// defaultCompressThreshold values smaller than it would not be compressed
+	defaultCompressThreshold = 1024
+)
+
+var (
+	// JSONCodec encodes values with encoding/json
+	JSONCodec Codec = jsonCodec{}
+	// MsgpackCodec encodes values with msgpack
+	MsgpackCodec Codec = msgpackCodec{}
+	// ProtobufCodec encodes values which implement proto.Message
+	ProtobufCodec Codec = protobufCodec{}
+)
+
+// Codec encodes values of Cache
+type Codec interface {
+	Name() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string {
+	return "json"
+}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string {
+	return "msgpack"
+}
+
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	return msgpack.Unmarshal(data, v)
+}
+
+type protobufCodec struct{}
+
+func (protobufCodec) Name() string {
+	return "protobuf"
+}
+
+func (protobufCodec) Marshal(v interface{}) ([]byte, error) {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("%T is not proto.Message", v)
+	}
+
+	return proto.Marshal(msg)
+}
+
+func (protobufCodec) Unmarshal(data []byte, v interface{}) error {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("%T is not proto.Message", v)
+	}
+
+	return proto.Unmarshal(data, msg)
+}
+
+// CompressedCodec compresses encoded values with gzip if larger than threshold,
+// values are prefixed with one byte flag, so threshold could be changed without breaking cached values.
+type CompressedCodec struct {
+	Codec     Codec
+	Threshold int
+}
+
+// WithCompression wraps codec with gzip compression of values larger than 1KB
+func WithCompression(codec Codec) Codec {
+	return &CompressedCodec{Codec: codec, Threshold: defaultCompressThreshold}
+}
+
+func (c *CompressedCodec) Name() string {
+	return c.Codec.Name() + "+gzip"
+}
+
+func (c *CompressedCodec) Marshal(v interface{}) ([]byte, error) {
+	data, err := c.Codec.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < c.Threshold {
+		return append([]byte{uncompressed}, data...), nil
+	}
+
+	buf := bytes.NewBuffer([]byte{gzipped})
+	writer := gzip.NewWriter(buf)
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (c *CompressedCodec) Unmarshal(data []byte, v interface{}) error {
+	if len(data) < 1 {
+		return fmt.Errorf("invalid compressed value")
+	}
+
+	switch data[0] {
+	case uncompressed:
+		return c.Codec.Unmarshal(data[1:], v)
+	case gzipped:
+		reader, err := gzip.NewReader(bytes.NewReader(data[1:]))
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+
+		raw, err := io.ReadAll(reader)
+		if err != nil {
+			return err
+		}
+
+		return c.Codec.Unmarshal(raw, v)
+	}
+
+	return fmt.Errorf("unknown compression flag %d", data[0])
+}
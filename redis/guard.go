@@ -0,0 +1,300 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkredis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"github.com/rookie-ninja/rk-entry/v2/entry"
+	"go.uber.org/zap"
+	"net"
+	"strings"
+	"time"
+)
+
+// ErrCommandDenied is returned if command is denied by GuardHook
+var ErrCommandDenied = errors.New("redis command denied")
+
+// BootRedisGuard guard config of commands which reflects to YAML config
+type BootRedisGuard struct {
+	Enabled         bool                  `yaml:"enabled" json:"enabled"`
+	SlowThresholdMs int                   `yaml:"slowThresholdMs" json:"slowThresholdMs"`
+	MaxReplyBytes   int                   `yaml:"maxReplyBytes" json:"maxReplyBytes"`
+	Rules           []*BootRedisGuardRule `yaml:"rules" json:"rules"`
+}
+
+// BootRedisGuardRule commands denied or warned in domain, * or empty matches all domains
+type BootRedisGuardRule struct {
+	Domain string   `yaml:"domain" json:"domain"`
+	Deny   []string `yaml:"deny" json:"deny"`
+	Warn   []string `yaml:"warn" json:"warn"`
+}
+
+// Guard denies or warns on commands, logs slow commands and flags big replies.
+//
+// Commands are matched by name like KEYS, or full name with sub command like CONFIG SET, case insensitive.
+type Guard struct {
+	// Deny commands are rejected with ErrCommandDenied without sending to server
+	Deny []string
+	// Warn commands are logged with warning
+	Warn []string
+	// SlowThreshold commands slower than it are logged, zero disables it
+	SlowThreshold time.Duration
+	// MaxReplyBytes replies larger than it are logged, zero disables it
+	MaxReplyBytes int
+}
+
+// ToGuard converts BootRedisGuard to Guard with rules matching domain of environment, nil if not enabled
+func ToGuard(config *BootRedisGuard) *Guard {
+	if config == nil || !config.Enabled {
+		return nil
+	}
+
+	res := &Guard{
+		SlowThreshold: time.Duration(config.SlowThresholdMs) * time.Millisecond,
+		MaxReplyBytes: config.MaxReplyBytes,
+	}
+
+	for _, rule := range config.Rules {
+		if rule == nil || !rkentry.IsValidDomain(rule.Domain) {
+			continue
+		}
+
+		res.Deny = append(res.Deny, rule.Deny...)
+		res.Warn = append(res.Warn, rule.Warn...)
+	}
+
+	return res
+}
+
+// GuardHook is a redis.Hook which applies Guard to commands of entry,
+// denied, warned, slow commands and big replies are counted in metrics labelled by entry and command.
+type GuardHook struct {
+	entryName string
+	logger    *zap.Logger
+	guard     *Guard
+	deny      map[string]bool
+	warn      map[string]bool
+}
+
+// NewGuardHook creates GuardHook, logs would be written with logger and name of entry
+func NewGuardHook(entryName string, logger *zap.Logger, guard *Guard) *GuardHook {
+	if logger == nil {
+		logger = rkentry.LoggerEntryStdout.Logger
+	}
+
+	if guard == nil {
+		guard = &Guard{}
+	}
+
+	return &GuardHook{
+		entryName: entryName,
+		logger:    logger.With(zap.String("entryName", entryName)),
+		guard:     guard,
+		deny:      toCommandSet(guard.Deny),
+		warn:      toCommandSet(guard.Warn),
+	}
+}
+
+func (h *GuardHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return next(ctx, network, addr)
+	}
+}
+
+func (h *GuardHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if err := h.check(cmd); err != nil {
+			return err
+		}
+
+		start := time.Now()
+		err := next(ctx, cmd)
+		elapsed := time.Since(start)
+
+		if h.isSlow(elapsed) {
+			incCounter("slowCommand", h.entryName, commandFullName(cmd))
+			h.logger.Warn("Slow redis command",
+				zap.String("command", commandFullName(cmd)),
+				zap.Int("args", len(cmd.Args())),
+				zap.Duration("elapsed", elapsed))
+		}
+
+		h.checkReply(cmd)
+
+		return err
+	}
+}
+
+func (h *GuardHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		// reject the whole pipeline, partially executed transaction is worse than nothing
+		var denied error
+		for i := range cmds {
+			if err := h.check(cmds[i]); err != nil && denied == nil {
+				denied = err
+			}
+		}
+		if denied != nil {
+			return denied
+		}
+
+		start := time.Now()
+		err := next(ctx, cmds)
+		elapsed := time.Since(start)
+
+		if h.isSlow(elapsed) {
+			incCounter("slowCommand", h.entryName, "pipeline")
+			h.logger.Warn("Slow redis pipeline",
+				zap.Int("commands", len(cmds)),
+				zap.Duration("elapsed", elapsed))
+		}
+
+		for i := range cmds {
+			h.checkReply(cmds[i])
+		}
+
+		return err
+	}
+}
+
+// check returns error if command is denied, and logs command if warned
+func (h *GuardHook) check(cmd redis.Cmder) error {
+	name, fullName := strings.ToLower(cmd.Name()), commandFullName(cmd)
+
+	if h.deny[name] || h.deny[fullName] {
+		incCounter("guardDenied", h.entryName, fullName)
+		h.logger.Warn("Redis command denied", zap.String("command", fullName))
+
+		err := fmt.Errorf("%w: %s", ErrCommandDenied, fullName)
+		cmd.SetErr(err)
+		return err
+	}
+
+	if h.warn[name] || h.warn[fullName] {
+		incCounter("guardWarned", h.entryName, fullName)
+		h.logger.Warn("Redis command is not recommended", zap.String("command", fullName))
+	}
+
+	return nil
+}
+
+// checkReply logs reply of command if larger than MaxReplyBytes
+func (h *GuardHook) checkReply(cmd redis.Cmder) {
+	if h.guard.MaxReplyBytes <= 0 || cmd.Err() != nil {
+		return
+	}
+
+	if size := replySize(cmd); size > h.guard.MaxReplyBytes {
+		incCounter("bigReply", h.entryName, commandFullName(cmd))
+		h.logger.Warn("Big redis reply",
+			zap.String("command", commandFullName(cmd)),
+			zap.Int("bytes", size),
+			zap.Int("maxReplyBytes", h.guard.MaxReplyBytes))
+	}
+}
+
+func (h *GuardHook) isSlow(elapsed time.Duration) bool {
+	return h.guard.SlowThreshold > 0 && elapsed > h.guard.SlowThreshold
+}
+
+// replySize returns approximate size of reply in bytes, which is the sum of length of strings in reply
+func replySize(cmd redis.Cmder) int {
+	switch c := cmd.(type) {
+	case *redis.StringCmd:
+		return len(c.Val())
+	case *redis.StringSliceCmd:
+		return stringsSize(c.Val())
+	case *redis.MapStringStringCmd:
+		size := 0
+		for k, v := range c.Val() {
+			size += len(k) + len(v)
+		}
+		return size
+	case *redis.ScanCmd:
+		keys, _ := c.Val()
+		return stringsSize(keys)
+	case *redis.ZSliceCmd:
+		size := 0
+		for _, z := range c.Val() {
+			size += valueSize(z.Member) + 8
+		}
+		return size
+	case *redis.SliceCmd:
+		return valueSize(c.Val())
+	case *redis.Cmd:
+		return valueSize(c.Val())
+	}
+
+	return 0
+}
+
+func stringsSize(values []string) int {
+	size := 0
+	for i := range values {
+		size += len(values[i])
+	}
+
+	return size
+}
+
+func valueSize(v interface{}) int {
+	switch value := v.(type) {
+	case string:
+		return len(value)
+	case []byte:
+		return len(value)
+	case []interface{}:
+		size := 0
+		for i := range value {
+			size += valueSize(value[i])
+		}
+		return size
+	case map[interface{}]interface{}:
+		size := 0
+		for k, v := range value {
+			size += valueSize(k) + valueSize(v)
+		}
+		return size
+	case nil:
+		return 0
+	}
+
+	// numbers and booleans
+	return 8
+}
+
+// containerCommands are commands with sub command, like CONFIG SET
+var containerCommands = map[string]bool{
+	"acl": true, "client": true, "cluster": true, "command": true, "config": true, "debug": true,
+	"function": true, "latency": true, "memory": true, "module": true, "object": true, "script": true,
+	"slowlog": true, "xgroup": true, "xinfo": true,
+}
+
+// commandFullName returns lower case name of command with sub command if exists, like config set
+func commandFullName(cmd redis.Cmder) string {
+	name := strings.ToLower(cmd.Name())
+	if args := cmd.Args(); containerCommands[name] && len(args) > 1 {
+		if sub, ok := args[1].(string); ok {
+			return name + " " + strings.ToLower(sub)
+		}
+	}
+
+	return name
+}
+
+func toCommandSet(commands []string) map[string]bool {
+	res := make(map[string]bool)
+	for i := range commands {
+		if name := strings.ToLower(strings.Join(strings.Fields(commands[i]), " ")); len(name) > 0 {
+			res[name] = true
+		}
+	}
+
+	return res
+}
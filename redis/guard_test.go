@@ -0,0 +1,116 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkredis
+
+import (
+	"context"
+	"errors"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/redis/go-redis/v9"
+	"github.com/rookie-ninja/rk-entry/v2/entry"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestToGuard(t *testing.T) {
+	// disabled
+	assert.Nil(t, ToGuard(nil))
+	assert.Nil(t, ToGuard(&BootRedisGuard{}))
+
+	// rules of current domain
+	os.Setenv("DOMAIN", "prod")
+	defer os.Unsetenv("DOMAIN")
+
+	guard := ToGuard(&BootRedisGuard{
+		Enabled:         true,
+		SlowThresholdMs: 100,
+		MaxReplyBytes:   1024,
+		Rules: []*BootRedisGuardRule{
+			{Domain: "*", Warn: []string{"HGETALL"}},
+			{Domain: "prod", Deny: []string{"KEYS", "FLUSHALL"}},
+			{Domain: "dev", Deny: []string{"DEBUG"}},
+		},
+	})
+	assert.Equal(t, []string{"KEYS", "FLUSHALL"}, guard.Deny)
+	assert.Equal(t, []string{"HGETALL"}, guard.Warn)
+	assert.Equal(t, 100*time.Millisecond, guard.SlowThreshold)
+	assert.Equal(t, 1024, guard.MaxReplyBytes)
+}
+
+func TestGuardHook(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	entry := newMemoryEntry(t,
+		WithLoggerEntry(&rkentry.LoggerEntry{Logger: zap.New(core)}),
+		WithGuard(&Guard{
+			Deny:          []string{"keys", "FLUSHALL", "config  set"},
+			Warn:          []string{"HGETALL"},
+			SlowThreshold: time.Nanosecond,
+			MaxReplyBytes: 5,
+		}))
+	ctx := context.TODO()
+
+	denied := testutil.ToFloat64(getMetrics().GetCounterWithValues("guardDenied", entry.GetName(), "keys"))
+
+	// denied
+	err := entry.Client.Keys(ctx, "*").Err()
+	assert.True(t, errors.Is(err, ErrCommandDenied))
+	assert.True(t, errors.Is(entry.Client.ConfigSet(ctx, "maxmemory", "1").Err(), ErrCommandDenied))
+	assert.Equal(t, denied+1, testutil.ToFloat64(getMetrics().GetCounterWithValues("guardDenied", entry.GetName(), "keys")))
+
+	// whole pipeline is denied
+	pipe := entry.Client.Pipeline()
+	pipe.Set(ctx, "key", "value", 0)
+	pipe.FlushAll(ctx)
+	_, err = pipe.Exec(ctx)
+	assert.True(t, errors.Is(err, ErrCommandDenied))
+	assert.False(t, entry.GetMemoryServer().Exists("key"))
+
+	// warned, slow and big reply
+	assert.Nil(t, entry.Client.HSet(ctx, "hash", "field", "value").Err())
+	assert.Equal(t, map[string]string{"field": "value"}, entry.Client.HGetAll(ctx, "hash").Val())
+
+	messages := make([]string, 0)
+	for _, log := range logs.All() {
+		messages = append(messages, log.Message)
+		if strings.HasPrefix(log.Message, "Redis command") || log.Message == "Big redis reply" {
+			assert.Equal(t, entry.GetName(), log.ContextMap()["entryName"])
+		}
+	}
+	assert.Contains(t, messages, "Redis command denied")
+	assert.Contains(t, messages, "Redis command is not recommended")
+	assert.Contains(t, messages, "Slow redis command")
+	assert.Contains(t, messages, "Big redis reply")
+}
+
+func TestCommandFullName(t *testing.T) {
+	ctx := context.TODO()
+	assert.Equal(t, "get", commandFullName(redis.NewStringCmd(ctx, "GET", "key")))
+	assert.Equal(t, "config set", commandFullName(redis.NewStatusCmd(ctx, "config", "SET", "k", "v")))
+	assert.Equal(t, "config", commandFullName(redis.NewStatusCmd(ctx, "config")))
+}
+
+func TestReplySize(t *testing.T) {
+	ctx := context.TODO()
+
+	stringCmd := redis.NewStringCmd(ctx, "get")
+	stringCmd.SetVal("value")
+	assert.Equal(t, 5, replySize(stringCmd))
+
+	sliceCmd := redis.NewStringSliceCmd(ctx, "lrange")
+	sliceCmd.SetVal([]string{"a", "bc"})
+	assert.Equal(t, 3, replySize(sliceCmd))
+
+	cmd := redis.NewCmd(ctx, "eval")
+	cmd.SetVal([]interface{}{"a", int64(1), []interface{}{"bc"}})
+	assert.Equal(t, 11, replySize(cmd))
+
+	assert.Equal(t, 0, replySize(redis.NewIntCmd(ctx, "incr")))
+}
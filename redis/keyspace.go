@@ -0,0 +1,324 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkredis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const keyspaceChannelPrefix = "__keyspace@"
+
+// KeyspaceEventType type of keyspace notification, like expired or del
+type KeyspaceEventType string
+
+// Types of keyspace events commonly used, events of other types are dispatched as they are
+const (
+	KeyspaceEventSet        KeyspaceEventType = "set"
+	KeyspaceEventDel        KeyspaceEventType = "del"
+	KeyspaceEventExpire     KeyspaceEventType = "expire"
+	KeyspaceEventExpired    KeyspaceEventType = "expired"
+	KeyspaceEventEvicted    KeyspaceEventType = "evicted"
+	KeyspaceEventRenameFrom KeyspaceEventType = "rename_from"
+	KeyspaceEventRenameTo   KeyspaceEventType = "rename_to"
+)
+
+// KeyspaceEvent is a keyspace notification of key
+type KeyspaceEvent struct {
+	// DB logical database of key
+	DB int
+	// Key without prefix of entry
+	Key string
+	// Type of event
+	Type KeyspaceEventType
+}
+
+// KeyspaceEventHandler handles keyspace event, error would be logged
+type KeyspaceEventHandler func(ctx context.Context, event *KeyspaceEvent) error
+
+// KeyspaceListener listens keyspace events of keys matching pattern, created by RedisEntry.OnKeyspaceEvent
+type KeyspaceListener struct {
+	entry   *RedisEntry
+	pattern string
+	channel string
+	handler SubscriptionHandler
+	opts    SubscribeOptions
+	subs    map[redis.UniversalClient]*Subscription
+	dropped uint64
+	mutex   sync.Mutex
+	resolve chan struct{}
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+// OnKeyspaceEvent subscribes keyspace events of keys matching glob pattern, events of all types would be
+// dispatched to handler if events is empty.
+//
+// Keyspace notifications are disabled in redis by default, they could be enabled with notifyKeyspaceEvents
+// in YAML or CONFIG SET notify-keyspace-events, flags should contain K since keyspace channels are subscribed.
+//
+// Notifications are local to nodes, so every master in cluster or every shard in ring is subscribed.
+// Masters are resolved again every HealthCheckInterval and whenever a node is resubscribed, so that
+// subscriptions follow failover and resharding.
+// Pattern and keys of events are prefixed and stripped with keyPrefix of entry.
+// Options are the same as RedisEntry.Subscribe and listener is closed at Interrupt.
+func (entry *RedisEntry) OnKeyspaceEvent(ctx context.Context, pattern string, events []KeyspaceEventType, handler KeyspaceEventHandler, opts *SubscribeOptions) (*KeyspaceListener, error) {
+	if len(pattern) < 1 {
+		return nil, errors.New("pattern of keyspace events is required")
+	}
+
+	if handler == nil {
+		return nil, fmt.Errorf("handler of keyspace events %s is required", pattern)
+	}
+
+	if entry.Client == nil {
+		return nil, fmt.Errorf("redis client of entry [%s] is not initialized, please call Bootstrap first", entry.entryName)
+	}
+
+	subOpts := withSubscribeDefaults(opts)
+	subOpts.Pattern = true
+
+	db := 0
+	if entry.Opts != nil {
+		db = entry.Opts.DB
+	}
+	channel := fmt.Sprintf("%s%d__:%s%s", keyspaceChannelPrefix, db, escapeGlob(entry.keyPrefix), pattern)
+
+	types := make(map[KeyspaceEventType]bool)
+	for i := range events {
+		types[events[i]] = true
+	}
+
+	subHandler := func(ctx context.Context, msg *redis.Message) error {
+		event, ok := parseKeyspaceEvent(msg)
+		if !ok || (len(types) > 0 && !types[event.Type]) {
+			return nil
+		}
+		event.Key = strings.TrimPrefix(event.Key, entry.keyPrefix)
+
+		return handler(ctx, event)
+	}
+
+	listener := &KeyspaceListener{
+		entry:   entry,
+		pattern: pattern,
+		channel: channel,
+		handler: subHandler,
+		opts:    subOpts,
+		subs:    make(map[redis.UniversalClient]*Subscription),
+		resolve: make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+
+	if err := listener.reconcile(ctx); err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	entry.subMutex.Lock()
+	if entry.subStopped {
+		entry.subMutex.Unlock()
+		listener.Close()
+		return nil, fmt.Errorf("entry [%s] is interrupted", entry.entryName)
+	}
+
+	ctx, listener.cancel = context.WithCancel(ctx)
+	entry.listeners = append(entry.listeners, listener)
+	entry.subMutex.Unlock()
+
+	go listener.run(ctx)
+
+	return listener, nil
+}
+
+// Pattern returns pattern of keys listened
+func (l *KeyspaceListener) Pattern() string {
+	return l.pattern
+}
+
+// Dropped returns number of events dropped by overflow policy in all nodes
+func (l *KeyspaceListener) Dropped() uint64 {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	res := l.dropped
+	for _, sub := range l.subs {
+		res += sub.Dropped()
+	}
+
+	return res
+}
+
+// Close unsubscribes in all nodes and waits for events in buffer handled
+func (l *KeyspaceListener) Close() {
+	if l.cancel != nil {
+		l.cancel()
+		<-l.done
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for client, sub := range l.subs {
+		sub.Close()
+		l.dropped += sub.Dropped()
+		delete(l.subs, client)
+	}
+
+	l.entry.subMutex.Lock()
+	defer l.entry.subMutex.Unlock()
+	for i := range l.entry.listeners {
+		if l.entry.listeners[i] == l {
+			l.entry.listeners = append(l.entry.listeners[:i], l.entry.listeners[i+1:]...)
+			break
+		}
+	}
+}
+
+// run resolves masters every HealthCheckInterval or when a node is resubscribed until ctx done
+func (l *KeyspaceListener) run(ctx context.Context) {
+	defer close(l.done)
+
+	ticker := time.NewTicker(l.opts.HealthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-l.resolve:
+		}
+
+		if err := l.reconcile(ctx); err != nil && ctx.Err() == nil {
+			l.entry.loggerEntry.Warn("Resolving masters of keyspace listener failed",
+				zap.String("entryName", l.entry.entryName), zap.String("pattern", l.pattern), zap.Error(err))
+		}
+	}
+}
+
+// triggerResolve asks run to resolve masters, called before a node is resubscribed
+func (l *KeyspaceListener) triggerResolve() {
+	select {
+	case l.resolve <- struct{}{}:
+	default:
+	}
+}
+
+// reconcile subscribes new masters and closes subscriptions of nodes which are not masters anymore
+func (l *KeyspaceListener) reconcile(ctx context.Context) error {
+	clients, err := l.entry.masterClients(ctx)
+	if err != nil {
+		return err
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	masters := make(map[redis.UniversalClient]bool)
+	for i := range clients {
+		masters[clients[i]] = true
+	}
+
+	for client, sub := range l.subs {
+		if !masters[client] {
+			sub.Close()
+			l.dropped += sub.Dropped()
+			delete(l.subs, client)
+		}
+	}
+
+	for i := range clients {
+		if _, ok := l.subs[clients[i]]; ok {
+			continue
+		}
+
+		sub, subErr := l.entry.newSubscription(ctx, clients[i], []string{l.channel}, l.handler, &l.opts, l.triggerResolve)
+		if subErr != nil {
+			err = subErr
+			continue
+		}
+		l.subs[clients[i]] = sub
+	}
+
+	return err
+}
+
+// parseKeyspaceEvent parses message of keyspace channel like __keyspace@0__:user:1 with payload expired
+func parseKeyspaceEvent(msg *redis.Message) (*KeyspaceEvent, bool) {
+	if !strings.HasPrefix(msg.Channel, keyspaceChannelPrefix) {
+		return nil, false
+	}
+
+	rest := strings.TrimPrefix(msg.Channel, keyspaceChannelPrefix)
+	i := strings.Index(rest, "__:")
+	if i < 0 {
+		return nil, false
+	}
+
+	db, err := strconv.Atoi(rest[:i])
+	if err != nil {
+		return nil, false
+	}
+
+	return &KeyspaceEvent{
+		DB:   db,
+		Key:  rest[i+len("__:"):],
+		Type: KeyspaceEventType(msg.Payload),
+	}, true
+}
+
+// masterClients returns clients of masters in cluster or shards in ring, entry.Client for others
+func (entry *RedisEntry) masterClients(ctx context.Context) ([]redis.UniversalClient, error) {
+	res := make([]redis.UniversalClient, 0)
+	mutex := sync.Mutex{}
+	collect := func(ctx context.Context, client *redis.Client) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		res = append(res, client)
+		return nil
+	}
+
+	var err error
+	switch client := entry.Client.(type) {
+	case *redis.ClusterClient:
+		err = client.ForEachMaster(ctx, collect)
+	case *redis.Ring:
+		err = client.ForEachShard(ctx, collect)
+	default:
+		res = append(res, entry.Client)
+	}
+
+	return res, err
+}
+
+// configNotifyKeyspaceEvents sets notify-keyspace-events in every node
+func (entry *RedisEntry) configNotifyKeyspaceEvents(ctx context.Context) error {
+	config := func(ctx context.Context, client *redis.Client) error {
+		if err := client.ConfigSet(ctx, "notify-keyspace-events", entry.notifyKeyspaceEvents).Err(); err != nil {
+			return fmt.Errorf("set notify-keyspace-events of %s failed, %v", client.Options().Addr, err)
+		}
+		return nil
+	}
+
+	switch client := entry.Client.(type) {
+	case *redis.ClusterClient:
+		return client.ForEachShard(ctx, config)
+	case *redis.Ring:
+		return client.ForEachShard(ctx, config)
+	case *redis.Client:
+		return config(ctx, client)
+	}
+
+	return nil
+}
@@ -0,0 +1,131 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkredis
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/rookie-ninja/rk-entry/v2/entry"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestParseKeyspaceEvent(t *testing.T) {
+	event, ok := parseKeyspaceEvent(&redis.Message{Channel: "__keyspace@1__:user:1", Payload: "expired"})
+	assert.True(t, ok)
+	assert.Equal(t, &KeyspaceEvent{DB: 1, Key: "user:1", Type: KeyspaceEventExpired}, event)
+
+	// invalid
+	_, ok = parseKeyspaceEvent(&redis.Message{Channel: "__keyevent@0__:expired", Payload: "user:1"})
+	assert.False(t, ok)
+	_, ok = parseKeyspaceEvent(&redis.Message{Channel: "__keyspace@0:user:1", Payload: "expired"})
+	assert.False(t, ok)
+	_, ok = parseKeyspaceEvent(&redis.Message{Channel: "__keyspace@x__:user:1", Payload: "expired"})
+	assert.False(t, ok)
+}
+
+func TestRedisEntry_OnKeyspaceEvent(t *testing.T) {
+	handler := func(ctx context.Context, event *KeyspaceEvent) error { return nil }
+
+	// not bootstrapped
+	entry := RegisterRedisEntry()
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+	_, err := entry.OnKeyspaceEvent(context.TODO(), "session:*", nil, handler, nil)
+	assert.NotNil(t, err)
+
+	// CONFIG is not supported by embedded server, bootstrap continues with warning
+	entry = newMemoryEntry(t, WithKeyPrefix("app:"), WithNotifyKeyspaceEvents("Kx"))
+	assert.Equal(t, "Kx", entry.notifyKeyspaceEvents)
+
+	// invalid
+	_, err = entry.OnKeyspaceEvent(context.TODO(), "", nil, handler, nil)
+	assert.NotNil(t, err)
+	_, err = entry.OnKeyspaceEvent(context.TODO(), "session:*", nil, nil, nil)
+	assert.NotNil(t, err)
+
+	received := make(chan *KeyspaceEvent, 10)
+	listener, err := entry.OnKeyspaceEvent(context.TODO(), "session:*", []KeyspaceEventType{KeyspaceEventExpired},
+		func(ctx context.Context, event *KeyspaceEvent) error {
+			received <- event
+			return nil
+		}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "session:*", listener.Pattern())
+	assert.Len(t, listener.subs, 1)
+	assert.Equal(t, []string{"__keyspace@0__:app:session:*"}, listener.subs[entry.Client].Channels())
+
+	// filtered by type and pattern, prefix of key is stripped
+	entry.Client.Publish(context.TODO(), "__keyspace@0__:app:session:1", "set")
+	entry.Client.Publish(context.TODO(), "__keyspace@0__:app:user:1", "expired")
+	entry.Client.Publish(context.TODO(), "__keyspace@0__:app:session:1", "expired")
+
+	select {
+	case event := <-received:
+		assert.Equal(t, &KeyspaceEvent{DB: 0, Key: "session:1", Type: KeyspaceEventExpired}, event)
+	case <-time.After(time.Second):
+		assert.Fail(t, "event not received")
+	}
+
+	select {
+	case event := <-received:
+		assert.Fail(t, "unexpected event", event)
+	case <-time.After(50 * time.Millisecond):
+	}
+	assert.Zero(t, listener.Dropped())
+
+	// closed at Interrupt
+	entry.Interrupt(context.TODO())
+	_, err = entry.OnKeyspaceEvent(context.TODO(), "session:*", nil, handler, nil)
+	assert.NotNil(t, err)
+}
+
+func TestKeyspaceListener_ResolveMasters(t *testing.T) {
+	entry := newMemoryEntry(t)
+	shard1, shard2 := miniredis.RunT(t), miniredis.RunT(t)
+	ring := redis.NewRing(&redis.RingOptions{Addrs: map[string]string{"shard-1": shard1.Addr()}})
+	defer ring.Close()
+	entry.Client = ring
+
+	received := make(chan *KeyspaceEvent, 10)
+	listener, err := entry.OnKeyspaceEvent(context.TODO(), "session:*", nil,
+		func(ctx context.Context, event *KeyspaceEvent) error {
+			received <- event
+			return nil
+		}, &SubscribeOptions{HealthCheckInterval: 50 * time.Millisecond})
+	assert.Nil(t, err)
+	assert.Len(t, listener.subs, 1)
+
+	// shard is replaced, old one is closed by ring and new one is subscribed
+	ring.SetAddrs(map[string]string{"shard-2": shard2.Addr()})
+	var addr string
+	assert.Eventually(t, func() bool {
+		listener.mutex.Lock()
+		defer listener.mutex.Unlock()
+		for client := range listener.subs {
+			addr = client.(*redis.Client).Options().Addr
+		}
+		return len(listener.subs) == 1 && addr == shard2.Addr()
+	}, time.Second, 10*time.Millisecond)
+
+	other := redis.NewClient(&redis.Options{Addr: shard2.Addr()})
+	defer other.Close()
+	assert.Nil(t, other.Publish(context.TODO(), "__keyspace@0__:session:1", "del").Err())
+
+	select {
+	case event := <-received:
+		assert.Equal(t, &KeyspaceEvent{DB: 0, Key: "session:1", Type: KeyspaceEventDel}, event)
+	case <-time.After(time.Second):
+		assert.Fail(t, "event not received")
+	}
+
+	// closed listener is removed from entry
+	listener.Close()
+	assert.Empty(t, listener.subs)
+	assert.Empty(t, entry.listeners)
+	assert.Empty(t, entry.subs)
+}
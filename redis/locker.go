@@ -0,0 +1,564 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkredis
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNotObtained is returned if lock could not be obtained within retries
+	ErrNotObtained = errors.New("redis lock not obtained")
+	// ErrLockNotHeld is returned if lock is expired or held by others while refreshing or releasing
+	ErrLockNotHeld = errors.New("redis lock not held")
+
+	// refresh TTL of key only if token matches
+	refreshScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("pexpire", KEYS[1], ARGV[2])
+end
+return 0`)
+
+	// delete key only if token matches
+	releaseScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+end
+return 0`)
+
+	// returns remaining TTL of key in milliseconds if token matches, -3 otherwise
+	pttlScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("pttl", KEYS[1])
+end
+return -3`)
+)
+
+const (
+	// clockDriftFactor is used to compute validity of lock as Redlock suggested
+	clockDriftFactor = 0.01
+)
+
+// ************* Retry strategy *************
+
+// RetryStrategy decides backoff between attempts of obtaining lock, zero or negative means stop retrying.
+type RetryStrategy interface {
+	NextBackoff() time.Duration
+}
+
+type noRetry struct{}
+
+func (noRetry) NextBackoff() time.Duration {
+	return 0
+}
+
+// NoRetry obtains lock only once
+func NoRetry() RetryStrategy {
+	return noRetry{}
+}
+
+type linearBackoff time.Duration
+
+func (b linearBackoff) NextBackoff() time.Duration {
+	return time.Duration(b)
+}
+
+// LinearBackoff retries with the same backoff until context is done, wrap it with LimitRetry to limit attempts.
+func LinearBackoff(backoff time.Duration) RetryStrategy {
+	return linearBackoff(backoff)
+}
+
+type exponentialBackoff struct {
+	min, max time.Duration
+	attempt  int
+}
+
+func (b *exponentialBackoff) NextBackoff() time.Duration {
+	b.attempt++
+	return expBackoff(b.min, b.max, b.attempt)
+}
+
+// ExponentialBackoff retries with backoff doubled from min to max until context is done,
+// wrap it with LimitRetry to limit attempts.
+func ExponentialBackoff(min, max time.Duration) RetryStrategy {
+	return &exponentialBackoff{min: min, max: max}
+}
+
+type limitRetry struct {
+	strategy RetryStrategy
+	max      int
+	attempt  int
+}
+
+func (r *limitRetry) NextBackoff() time.Duration {
+	if r.attempt >= r.max {
+		return 0
+	}
+	r.attempt++
+	return r.strategy.NextBackoff()
+}
+
+// LimitRetry limits retries of strategy to max times
+func LimitRetry(strategy RetryStrategy, max int) RetryStrategy {
+	return &limitRetry{strategy: strategy, max: max}
+}
+
+// expBackoff returns min*2^(attempt-1) capped by max
+func expBackoff(min, max time.Duration, attempt int) time.Duration {
+	if min <= 0 {
+		return max
+	}
+
+	backoff := min
+	for i := 1; i < attempt && backoff < max; i++ {
+		backoff *= 2
+	}
+
+	if max > 0 && backoff > max {
+		backoff = max
+	}
+
+	return backoff
+}
+
+// ************* Locker *************
+
+// LockOptions options of Locker.Obtain
+type LockOptions struct {
+	// RetryStrategy between attempts, default: NoRetry(), stateful strategy should not be shared between calls
+	RetryStrategy RetryStrategy
+	// Token of lock, random token would be generated if empty
+	Token string
+	// AutoExtend refreshes TTL of lock in background until released
+	AutoExtend bool
+	// ExtendInterval interval of auto extension, default: half of TTL
+	ExtendInterval time.Duration
+}
+
+// Locker obtains distributed locks from one RedisEntry, or from a list of single node RedisEntry
+// with Redlock algorithm which requires majority of nodes.
+type Locker struct {
+	entries []*RedisEntry
+	quorum  int
+}
+
+// NewLocker creates Locker on client of RedisEntry
+func (entry *RedisEntry) NewLocker() *Locker {
+	return NewRedlock(entry)
+}
+
+// NewRedlock creates Locker with Redlock algorithm among independent single node RedisEntry,
+// lock is obtained if majority of nodes accepted it.
+func NewRedlock(entries ...*RedisEntry) *Locker {
+	return &Locker{
+		entries: entries,
+		quorum:  len(entries)/2 + 1,
+	}
+}
+
+// Obtain tries to obtain lock of key with TTL, ErrNotObtained would be returned if lock is held by others
+// after all retries. A span would be created if tracer exists in context, commands of each node are traced
+// by RedisTracer as children.
+func (l *Locker) Obtain(ctx context.Context, key string, ttl time.Duration, opts *LockOptions) (*Lock, error) {
+	if err := validateTTL(key, ttl); err != nil {
+		return nil, err
+	}
+
+	if opts == nil {
+		opts = &LockOptions{}
+	}
+
+	ctx, span := getTracer(ctx).Start(ctx, "redis.lock.obtain")
+	span.SetAttributes(
+		attribute.String("db.system", "redis"),
+		attribute.String("db.redis.lock.key", key),
+		attribute.Int("db.redis.lock.nodes", len(l.entries)),
+		attribute.Int64("db.redis.lock.ttl_ms", ttl.Milliseconds()),
+	)
+	defer span.End()
+
+	clients, err := l.clients()
+	if err != nil {
+		recordError(ctx, span, err)
+		return nil, err
+	}
+
+	token := opts.Token
+	if len(token) < 1 {
+		if token, err = randomToken(); err != nil {
+			recordError(ctx, span, err)
+			return nil, err
+		}
+	}
+
+	retry := opts.RetryStrategy
+	if retry == nil {
+		retry = NoRetry()
+	}
+
+	var timer *time.Timer
+	for attempt := 1; ; attempt++ {
+		span.SetAttributes(attribute.Int("db.redis.lock.attempt", attempt))
+
+		start := time.Now()
+		ok, err := l.obtain(ctx, clients, key, token, ttl)
+		if ok {
+			lock := &Lock{
+				locker:   l,
+				key:      key,
+				token:    token,
+				ttl:      ttl,
+				validity: start.Add(ttl - drift(ttl)),
+				lost:     make(chan struct{}),
+			}
+
+			if opts.AutoExtend {
+				lock.startAutoExtend(opts.ExtendInterval)
+			}
+
+			return lock, nil
+		}
+
+		backoff := retry.NextBackoff()
+		if backoff <= 0 {
+			if err == nil {
+				err = ErrNotObtained
+			}
+			recordError(ctx, span, err)
+			return nil, err
+		}
+
+		if timer == nil {
+			timer = time.NewTimer(backoff)
+			defer timer.Stop()
+		} else {
+			timer.Reset(backoff)
+		}
+
+		select {
+		case <-ctx.Done():
+			recordError(ctx, span, ctx.Err())
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// obtain sets key on every node and checks quorum and validity, acquired nodes would be released if failed.
+func (l *Locker) obtain(ctx context.Context, clients []redis.UniversalClient, key, token string, ttl time.Duration) (bool, error) {
+	start := time.Now()
+
+	acquired, err := l.forEachNode(ctx, clients, func(ctx context.Context, client redis.UniversalClient) (bool, error) {
+		return client.SetNX(ctx, key, token, ttl).Result()
+	})
+
+	if acquired >= l.quorum && time.Since(start) < ttl-drift(ttl) {
+		return true, nil
+	}
+
+	// release partially acquired nodes
+	if acquired > 0 {
+		l.release(context.Background(), clients, key, token)
+	}
+
+	return false, err
+}
+
+// release deletes key on every node which is still held by token
+func (l *Locker) release(ctx context.Context, clients []redis.UniversalClient, key, token string) (int, error) {
+	return l.forEachNode(ctx, clients, func(ctx context.Context, client redis.UniversalClient) (bool, error) {
+		res, err := releaseScript.Run(ctx, client, []string{key}, token).Int64()
+		return res == 1, err
+	})
+}
+
+// refresh extends TTL of key on every node which is still held by token
+func (l *Locker) refresh(ctx context.Context, clients []redis.UniversalClient, key, token string, ttl time.Duration) (int, error) {
+	return l.forEachNode(ctx, clients, func(ctx context.Context, client redis.UniversalClient) (bool, error) {
+		res, err := refreshScript.Run(ctx, client, []string{key}, token, ttl.Milliseconds()).Int64()
+		return res == 1, err
+	})
+}
+
+// forEachNode runs fn on nodes concurrently, returns number of succeeded nodes and the first error
+func (l *Locker) forEachNode(ctx context.Context, clients []redis.UniversalClient,
+	fn func(context.Context, redis.UniversalClient) (bool, error)) (int, error) {
+	if len(clients) == 1 {
+		ok, err := fn(ctx, clients[0])
+		if ok {
+			return 1, err
+		}
+		return 0, err
+	}
+
+	var (
+		mutex    sync.Mutex
+		wg       sync.WaitGroup
+		count    int
+		firstErr error
+	)
+
+	for i := range clients {
+		wg.Add(1)
+		go func(client redis.UniversalClient) {
+			defer wg.Done()
+			ok, err := fn(ctx, client)
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			if ok {
+				count++
+			}
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}(clients[i])
+	}
+	wg.Wait()
+
+	return count, firstErr
+}
+
+func (l *Locker) clients() ([]redis.UniversalClient, error) {
+	if len(l.entries) < 1 {
+		return nil, errors.New("no redis entry provided to locker")
+	}
+
+	res := make([]redis.UniversalClient, 0, len(l.entries))
+	for _, entry := range l.entries {
+		if entry == nil || entry.Client == nil {
+			return nil, errors.New("redis client is not initialized, please call Bootstrap of RedisEntry first")
+		}
+		res = append(res, entry.Client)
+	}
+
+	return res, nil
+}
+
+// ************* Lock *************
+
+// Lock obtained by Locker
+type Lock struct {
+	locker   *Locker
+	key      string
+	token    string
+	ttl      time.Duration
+	mutex    sync.Mutex
+	validity time.Time
+	lost     chan struct{}
+	lostOnce sync.Once
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+// Key returns key of lock
+func (lock *Lock) Key() string {
+	return lock.key
+}
+
+// Token returns token of lock
+func (lock *Lock) Token() string {
+	return lock.token
+}
+
+// Lost returns a channel which would be closed once auto extension failed and lock is not held anymore
+func (lock *Lock) Lost() <-chan struct{} {
+	return lock.lost
+}
+
+// TTL returns remaining TTL of lock, zero if lock is not held by token anymore.
+// For Redlock, TTL of the first node holding lock is returned.
+func (lock *Lock) TTL(ctx context.Context) (time.Duration, error) {
+	clients, err := lock.locker.clients()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, client := range clients {
+		res, err := pttlScript.Run(ctx, client, []string{lock.key}, lock.token).Int64()
+		if err != nil {
+			return 0, err
+		}
+		if res > 0 {
+			return time.Duration(res) * time.Millisecond, nil
+		}
+	}
+
+	return 0, nil
+}
+
+// Refresh extends TTL of lock, ErrLockNotHeld would be returned if lock is not held by majority of nodes anymore
+func (lock *Lock) Refresh(ctx context.Context, ttl time.Duration) error {
+	if err := validateTTL(lock.key, ttl); err != nil {
+		return err
+	}
+
+	ctx, span := getTracer(ctx).Start(ctx, "redis.lock.refresh")
+	span.SetAttributes(
+		attribute.String("db.system", "redis"),
+		attribute.String("db.redis.lock.key", lock.key),
+		attribute.Int64("db.redis.lock.ttl_ms", ttl.Milliseconds()),
+	)
+	defer span.End()
+
+	clients, err := lock.locker.clients()
+	if err != nil {
+		recordError(ctx, span, err)
+		return err
+	}
+
+	start := time.Now()
+	refreshed, err := lock.locker.refresh(ctx, clients, lock.key, lock.token, ttl)
+	if refreshed < lock.locker.quorum {
+		if err == nil {
+			err = ErrLockNotHeld
+		}
+		recordError(ctx, span, err)
+		return err
+	}
+
+	lock.mutex.Lock()
+	lock.ttl = ttl
+	lock.validity = start.Add(ttl - drift(ttl))
+	lock.mutex.Unlock()
+
+	return nil
+}
+
+// Release stops auto extension and deletes lock, ErrLockNotHeld would be returned if lock is not held by any node
+func (lock *Lock) Release(ctx context.Context) error {
+	lock.stopAutoExtend()
+
+	ctx, span := getTracer(ctx).Start(ctx, "redis.lock.release")
+	span.SetAttributes(
+		attribute.String("db.system", "redis"),
+		attribute.String("db.redis.lock.key", lock.key),
+	)
+	defer span.End()
+
+	clients, err := lock.locker.clients()
+	if err != nil {
+		recordError(ctx, span, err)
+		return err
+	}
+
+	released, err := lock.locker.release(ctx, clients, lock.key, lock.token)
+	if released < 1 {
+		if err == nil {
+			err = ErrLockNotHeld
+		}
+		recordError(ctx, span, err)
+		return err
+	}
+
+	return nil
+}
+
+// startAutoExtend refreshes lock in background every interval until released or lost
+func (lock *Lock) startAutoExtend(interval time.Duration) {
+	if interval <= 0 {
+		interval = lock.ttl / 2
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	lock.cancel = cancel
+	lock.done = make(chan struct{})
+
+	go func() {
+		defer close(lock.done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			lock.mutex.Lock()
+			ttl, validity := lock.ttl, lock.validity
+			lock.mutex.Unlock()
+
+			refreshCtx, refreshCancel := context.WithDeadline(ctx, validity)
+			err := lock.Refresh(refreshCtx, ttl)
+			refreshCancel()
+
+			switch {
+			case err == nil:
+			case ctx.Err() != nil:
+				return
+			case errors.Is(err, ErrLockNotHeld) || !time.Now().Before(validity):
+				lock.locker.logger().Warn(fmt.Sprintf("Lost redis lock [%s]", lock.key), zap.Error(err))
+				lock.markLost()
+				return
+			default:
+				lock.locker.logger().Warn(fmt.Sprintf("Extending redis lock [%s] failed, retry later", lock.key), zap.Error(err))
+			}
+		}
+	}()
+}
+
+func (lock *Lock) stopAutoExtend() {
+	if lock.cancel != nil {
+		lock.cancel()
+		<-lock.done
+	}
+}
+
+func (lock *Lock) markLost() {
+	lock.lostOnce.Do(func() {
+		close(lock.lost)
+	})
+}
+
+func (l *Locker) logger() *zap.Logger {
+	for _, entry := range l.entries {
+		if entry != nil && entry.loggerEntry != nil {
+			return entry.loggerEntry.Logger
+		}
+	}
+
+	return zap.NewNop()
+}
+
+// validateTTL returns error if lock with ttl could never be valid after drift deducted,
+// which also prevents sub-millisecond ttl from being sent as 0 that deletes the key while refreshing
+func validateTTL(key string, ttl time.Duration) error {
+	if ttl-drift(ttl) <= 0 {
+		return fmt.Errorf("ttl of lock [%s] should be longer than clock drift, got %s", key, ttl)
+	}
+	return nil
+}
+
+// drift returns clock drift of ttl as Redlock suggested
+func drift(ttl time.Duration) time.Duration {
+	return time.Duration(float64(ttl)*clockDriftFactor) + 2*time.Millisecond
+}
+
+func randomToken() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func getTracer(ctx context.Context) trace.Tracer {
+	return NewRedisTracer().getTracer(ctx)
+}
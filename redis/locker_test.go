@@ -0,0 +1,185 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkredis
+
+import (
+	"context"
+	"github.com/rookie-ninja/rk-entry/v2/entry"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func newMemoryEntry(t *testing.T, opts ...Option) *RedisEntry {
+	opts = append([]Option{WithName(t.Name() + time.Now().String()), WithMode("memory")}, opts...)
+	entry := RegisterRedisEntry(opts...)
+	entry.Bootstrap(context.TODO())
+
+	t.Cleanup(func() {
+		entry.Interrupt(context.TODO())
+		rkentry.GlobalAppCtx.RemoveEntry(entry)
+	})
+
+	return entry
+}
+
+func TestRetryStrategy(t *testing.T) {
+	assert.Zero(t, NoRetry().NextBackoff())
+	assert.Equal(t, time.Second, LinearBackoff(time.Second).NextBackoff())
+
+	exp := ExponentialBackoff(10*time.Millisecond, 30*time.Millisecond)
+	assert.Equal(t, 10*time.Millisecond, exp.NextBackoff())
+	assert.Equal(t, 20*time.Millisecond, exp.NextBackoff())
+	assert.Equal(t, 30*time.Millisecond, exp.NextBackoff())
+
+	limit := LimitRetry(LinearBackoff(time.Second), 2)
+	assert.Equal(t, time.Second, limit.NextBackoff())
+	assert.Equal(t, time.Second, limit.NextBackoff())
+	assert.Zero(t, limit.NextBackoff())
+}
+
+func TestLocker_Obtain(t *testing.T) {
+	entry := newMemoryEntry(t)
+	locker := entry.NewLocker()
+
+	// not bootstrapped
+	_, err := RegisterRedisEntry().NewLocker().Obtain(context.TODO(), "key", time.Second, nil)
+	assert.NotNil(t, err)
+
+	// ttl not longer than clock drift
+	for _, ttl := range []time.Duration{0, 500 * time.Microsecond, 2 * time.Millisecond} {
+		_, err = locker.Obtain(context.TODO(), "key", ttl, &LockOptions{RetryStrategy: LinearBackoff(time.Millisecond)})
+		assert.NotNil(t, err)
+		assert.False(t, entry.GetMemoryServer().Exists("key"))
+	}
+
+	// happy case
+	lock, err := locker.Obtain(context.TODO(), "key", time.Second, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "key", lock.Key())
+	assert.NotEmpty(t, lock.Token())
+	value, _ := entry.GetMemoryServer().Get("key")
+	assert.Equal(t, lock.Token(), value)
+
+	ttl, err := lock.TTL(context.TODO())
+	assert.Nil(t, err)
+	assert.Equal(t, time.Second, ttl)
+
+	// held by others
+	_, err = locker.Obtain(context.TODO(), "key", time.Second, nil)
+	assert.Equal(t, ErrNotObtained, err)
+
+	// retry until released
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		lock.Release(context.TODO())
+	}()
+	other, err := locker.Obtain(context.TODO(), "key", time.Second, &LockOptions{
+		RetryStrategy: LimitRetry(LinearBackoff(20*time.Millisecond), 20),
+		Token:         "other",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "other", other.Token())
+
+	// context done while retrying
+	ctx, cancel := context.WithTimeout(context.TODO(), 30*time.Millisecond)
+	defer cancel()
+	_, err = locker.Obtain(ctx, "key", time.Second, &LockOptions{
+		RetryStrategy: LinearBackoff(10 * time.Millisecond),
+	})
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestLock_RefreshAndRelease(t *testing.T) {
+	entry := newMemoryEntry(t)
+	server := entry.GetMemoryServer()
+
+	lock, err := entry.NewLocker().Obtain(context.TODO(), "key", time.Second, nil)
+	assert.Nil(t, err)
+
+	// ttl not longer than clock drift
+	assert.NotNil(t, lock.Refresh(context.TODO(), -time.Second))
+	assert.NotNil(t, lock.Refresh(context.TODO(), 500*time.Microsecond))
+	assert.True(t, server.Exists("key"))
+
+	// refresh
+	assert.Nil(t, lock.Refresh(context.TODO(), time.Minute))
+	assert.Equal(t, time.Minute, server.TTL("key"))
+
+	// expired
+	server.FastForward(time.Minute)
+	assert.Equal(t, ErrLockNotHeld, lock.Refresh(context.TODO(), time.Minute))
+	ttl, err := lock.TTL(context.TODO())
+	assert.Nil(t, err)
+	assert.Zero(t, ttl)
+
+	// release would not delete lock held by others
+	server.Set("key", "other")
+	assert.Equal(t, ErrLockNotHeld, lock.Release(context.TODO()))
+	assert.True(t, server.Exists("key"))
+}
+
+func TestLock_AutoExtend(t *testing.T) {
+	entry := newMemoryEntry(t)
+	server := entry.GetMemoryServer()
+
+	lock, err := entry.NewLocker().Obtain(context.TODO(), "key", time.Second, &LockOptions{
+		AutoExtend:     true,
+		ExtendInterval: 10 * time.Millisecond,
+	})
+	assert.Nil(t, err)
+
+	// TTL of key would be refreshed
+	server.SetTTL("key", 10*time.Millisecond)
+	assert.Eventually(t, func() bool {
+		return server.TTL("key") == time.Second
+	}, time.Second, 5*time.Millisecond)
+
+	// lost
+	server.Del("key")
+	select {
+	case <-lock.Lost():
+	case <-time.After(time.Second):
+		assert.Fail(t, "lock is not marked as lost")
+	}
+
+	// release after lost
+	assert.Equal(t, ErrLockNotHeld, lock.Release(context.TODO()))
+
+	// auto extension stopped by release
+	lock, err = entry.NewLocker().Obtain(context.TODO(), "key", time.Second, &LockOptions{AutoExtend: true})
+	assert.Nil(t, err)
+	assert.Nil(t, lock.Release(context.TODO()))
+	assert.False(t, server.Exists("key"))
+}
+
+func TestNewRedlock(t *testing.T) {
+	nodes := []*RedisEntry{newMemoryEntry(t), newMemoryEntry(t), newMemoryEntry(t)}
+	locker := NewRedlock(nodes...)
+	assert.Equal(t, 2, locker.quorum)
+
+	// happy case
+	lock, err := locker.Obtain(context.TODO(), "key", time.Second, nil)
+	assert.Nil(t, err)
+	for _, node := range nodes {
+		value, _ := node.GetMemoryServer().Get("key")
+		assert.Equal(t, lock.Token(), value)
+	}
+	assert.Nil(t, lock.Release(context.TODO()))
+
+	// minority of nodes held by others, lock is obtained by quorum
+	nodes[0].GetMemoryServer().Set("key", "other")
+	lock, err = locker.Obtain(context.TODO(), "key", time.Second, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, lock.Refresh(context.TODO(), time.Second))
+	assert.Nil(t, lock.Release(context.TODO()))
+
+	// majority of nodes held by others, acquired nodes are released
+	nodes[1].GetMemoryServer().Set("key", "other")
+	_, err = locker.Obtain(context.TODO(), "key", time.Second, nil)
+	assert.Equal(t, ErrNotObtained, err)
+	assert.False(t, nodes[2].GetMemoryServer().Exists("key"))
+}
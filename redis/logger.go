@@ -8,8 +8,10 @@ package rkredis
 import (
 	"context"
 	"fmt"
+	"github.com/redis/go-redis/v9"
 	"github.com/rookie-ninja/rk-entry/v2/entry"
 	"go.uber.org/zap"
+	"net"
 )
 
 func NewLogger(zapLogger *zap.Logger) *Logger {
@@ -26,6 +28,50 @@ type Logger struct {
 	delegate *zap.Logger
 }
 
+// Printf writes log with logger of entry in context, which is injected by hook of entry,
+// delegate would be used if missing, like logs of background goroutines in go-redis.
 func (l Logger) Printf(ctx context.Context, format string, v ...interface{}) {
-	l.delegate.Info(fmt.Sprintf(format, v...))
+	logger := l.delegate
+	if ctx != nil {
+		if res, ok := ctx.Value(loggerKey{}).(*zap.Logger); ok && res != nil {
+			logger = res
+		}
+	}
+
+	logger.Info(fmt.Sprintf(format, v...))
+}
+
+type loggerKey struct{}
+
+// loggerHook injects logger of entry into context, so that logs of go-redis carry name of entry
+type loggerHook struct {
+	logger *zap.Logger
+}
+
+func newLoggerHook(entryName string, logger *zap.Logger) *loggerHook {
+	if logger == nil {
+		logger = rkentry.LoggerEntryStdout.Logger
+	}
+
+	return &loggerHook{
+		logger: logger.With(zap.String("entryName", entryName)),
+	}
+}
+
+func (h *loggerHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return next(context.WithValue(ctx, loggerKey{}, h.logger), network, addr)
+	}
+}
+
+func (h *loggerHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		return next(context.WithValue(ctx, loggerKey{}, h.logger), cmd)
+	}
+}
+
+func (h *loggerHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		return next(context.WithValue(ctx, loggerKey{}, h.logger), cmds)
+	}
 }
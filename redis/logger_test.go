@@ -6,8 +6,11 @@ package rkredis
 
 import (
 	"context"
+	"github.com/redis/go-redis/v9"
 	"github.com/rookie-ninja/rk-entry/v2/entry"
 	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
 	"testing"
 )
 
@@ -20,3 +23,24 @@ func TestLogger_Printf(t *testing.T) {
 	assert.NotNil(t, logger)
 	logger.Printf(context.TODO(), "%s", "arg")
 }
+
+func TestLogger_PrintfWithEntry(t *testing.T) {
+	defaultCore, defaultLogs := observer.New(zap.InfoLevel)
+	entryCore, entryLogs := observer.New(zap.InfoLevel)
+	logger := NewLogger(zap.New(defaultCore))
+
+	// without logger of entry
+	logger.Printf(context.TODO(), "%s", "default")
+	assert.Equal(t, 1, defaultLogs.Len())
+
+	// logger of entry injected by hook
+	hook := newLoggerHook("ut-entry", zap.New(entryCore))
+	process := hook.ProcessHook(func(ctx context.Context, cmd redis.Cmder) error {
+		logger.Printf(ctx, "%s", "entry")
+		return nil
+	})
+	assert.Nil(t, process(context.TODO(), redis.NewStatusCmd(context.TODO(), "ping")))
+	assert.Equal(t, 1, defaultLogs.Len())
+	assert.Equal(t, 1, entryLogs.Len())
+	assert.Equal(t, "ut-entry", entryLogs.All()[0].ContextMap()["entryName"])
+}
@@ -0,0 +1,53 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkredis
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rookie-ninja/rk-entry/v2/middleware/prom"
+	"sync"
+)
+
+var (
+	metrics     *rkmidprom.MetricsSet
+	metricsOnce sync.Once
+)
+
+// getMetrics returns metrics shared by all entries, registered into prometheus.DefaultRegisterer
+func getMetrics() *rkmidprom.MetricsSet {
+	metricsOnce.Do(func() {
+		metrics = rkmidprom.NewMetricsSet("rk", "redis", nil)
+		// cache
+		metrics.RegisterCounter("cacheHit", "entry", "prefix", "tier")
+		metrics.RegisterCounter("cacheMiss", "entry", "prefix")
+		// guard
+		metrics.RegisterCounter("guardDenied", "entry", "command")
+		metrics.RegisterCounter("guardWarned", "entry", "command")
+		metrics.RegisterCounter("slowCommand", "entry", "command")
+		metrics.RegisterCounter("bigReply", "entry", "command")
+	})
+
+	return metrics
+}
+
+// incCounter increases counter of metrics if registered
+func incCounter(name string, values ...string) {
+	if counter := getMetrics().GetCounterWithValues(name, values...); counter != nil {
+		counter.Inc()
+	}
+}
+
+// RegisterPromMetrics registers metrics of caches and guard into registry
+func (entry *RedisEntry) RegisterPromMetrics(registry *prometheus.Registry) error {
+	counterList := getMetrics().ListCounters()
+	for i := range counterList {
+		if err := registry.Register(counterList[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
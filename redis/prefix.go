@@ -0,0 +1,362 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkredis
+
+import (
+	"context"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// keySpec describes positions of keys in arguments of command, like first, last and step in COMMAND INFO.
+// Negative last is counted from the end of arguments, -1 means the last argument.
+type keySpec struct {
+	first int
+	last  int
+	step  int
+}
+
+var (
+	singleKey     = keySpec{first: 1, last: 1, step: 1}
+	allKeys       = keySpec{first: 1, last: -1, step: 1}
+	twoKeys       = keySpec{first: 1, last: 2, step: 1}
+	keysBeforeEnd = keySpec{first: 1, last: -2, step: 1}
+	keyValuePairs = keySpec{first: 1, last: -1, step: 2}
+	keysAfterOp   = keySpec{first: 2, last: -1, step: 1}
+	subcommandKey = keySpec{first: 2, last: 2, step: 1}
+
+	// keySpecs of commands with fixed key positions
+	keySpecs = map[string]keySpec{
+		// generic
+		"del": allKeys, "unlink": allKeys, "exists": allKeys, "touch": allKeys, "watch": allKeys,
+		"type": singleKey, "dump": singleKey, "restore": singleKey,
+		"expire": singleKey, "expireat": singleKey, "pexpire": singleKey, "pexpireat": singleKey,
+		"persist": singleKey, "ttl": singleKey, "pttl": singleKey, "expiretime": singleKey, "pexpiretime": singleKey,
+		"rename": twoKeys, "renamenx": twoKeys, "copy": twoKeys,
+		"object": subcommandKey, "memory": subcommandKey,
+		// string
+		"get": singleKey, "set": singleKey, "setnx": singleKey, "setex": singleKey, "psetex": singleKey,
+		"getset": singleKey, "getdel": singleKey, "getex": singleKey, "getrange": singleKey, "setrange": singleKey,
+		"append": singleKey, "strlen": singleKey, "incr": singleKey, "incrby": singleKey, "incrbyfloat": singleKey,
+		"decr": singleKey, "decrby": singleKey, "mget": allKeys, "mset": keyValuePairs, "msetnx": keyValuePairs,
+		"lcs": twoKeys,
+		// bitmap
+		"getbit": singleKey, "setbit": singleKey, "bitcount": singleKey, "bitpos": singleKey,
+		"bitfield": singleKey, "bitfield_ro": singleKey, "bitop": keysAfterOp,
+		// hash
+		"hget": singleKey, "hset": singleKey, "hsetnx": singleKey, "hmget": singleKey, "hmset": singleKey,
+		"hdel": singleKey, "hexists": singleKey, "hgetall": singleKey, "hincrby": singleKey,
+		"hincrbyfloat": singleKey, "hkeys": singleKey, "hvals": singleKey, "hlen": singleKey,
+		"hstrlen": singleKey, "hscan": singleKey, "hrandfield": singleKey,
+		// list
+		"lpush": singleKey, "lpushx": singleKey, "rpush": singleKey, "rpushx": singleKey, "lpop": singleKey,
+		"rpop": singleKey, "llen": singleKey, "lindex": singleKey, "lset": singleKey, "lrange": singleKey,
+		"ltrim": singleKey, "lrem": singleKey, "linsert": singleKey, "lpos": singleKey,
+		"lmove": twoKeys, "blmove": twoKeys, "rpoplpush": twoKeys, "brpoplpush": twoKeys,
+		"blpop": keysBeforeEnd, "brpop": keysBeforeEnd,
+		// set
+		"sadd": singleKey, "srem": singleKey, "smembers": singleKey, "sismember": singleKey,
+		"smismember": singleKey, "scard": singleKey, "spop": singleKey, "srandmember": singleKey,
+		"sscan": singleKey, "smove": twoKeys, "sinter": allKeys, "sunion": allKeys, "sdiff": allKeys,
+		"sinterstore": allKeys, "sunionstore": allKeys, "sdiffstore": allKeys,
+		// sorted set
+		"zadd": singleKey, "zincrby": singleKey, "zrem": singleKey, "zcard": singleKey, "zcount": singleKey,
+		"zlexcount": singleKey, "zscore": singleKey, "zmscore": singleKey, "zrank": singleKey,
+		"zrevrank": singleKey, "zrange": singleKey, "zrangebyscore": singleKey, "zrangebylex": singleKey,
+		"zrevrange": singleKey, "zrevrangebyscore": singleKey, "zrevrangebylex": singleKey,
+		"zremrangebyrank": singleKey, "zremrangebyscore": singleKey, "zremrangebylex": singleKey,
+		"zpopmin": singleKey, "zpopmax": singleKey, "zrandmember": singleKey, "zscan": singleKey,
+		"zrangestore": twoKeys, "bzpopmin": keysBeforeEnd, "bzpopmax": keysBeforeEnd,
+		// hyperloglog
+		"pfadd": singleKey, "pfcount": allKeys, "pfmerge": allKeys,
+		// geo
+		"geoadd": singleKey, "geodist": singleKey, "geohash": singleKey, "geopos": singleKey,
+		"georadius_ro": singleKey, "georadiusbymember_ro": singleKey, "geosearch": singleKey,
+		"geosearchstore": twoKeys,
+		// stream
+		"xadd": singleKey, "xlen": singleKey, "xrange": singleKey, "xrevrange": singleKey, "xdel": singleKey,
+		"xtrim": singleKey, "xack": singleKey, "xpending": singleKey, "xclaim": singleKey,
+		"xautoclaim": singleKey, "xsetid": singleKey, "xgroup": subcommandKey, "xinfo": subcommandKey,
+	}
+
+	// numKeysIndex of commands whose keys follow the argument of number of keys
+	numKeysIndex = map[string]int{
+		"eval": 2, "evalsha": 2, "eval_ro": 2, "evalsha_ro": 2, "fcall": 2, "fcall_ro": 2,
+		"zunionstore": 2, "zinterstore": 2, "zdiffstore": 2,
+		"zunion": 1, "zinter": 1, "zdiff": 1, "zintercard": 1, "sintercard": 1, "lmpop": 1, "zmpop": 1,
+		"blmpop": 2, "bzmpop": 2,
+	}
+)
+
+// KeyPrefixHook is a redis.Hook which prefixes keys of commands, so that applications sharing one redis
+// could be isolated without changing call sites.
+//
+// Keys of known commands are rewritten, including multi-key commands, KEYS of Lua scripts, patterns of
+// SCAN and KEYS, and BY and GET patterns of SORT. SCAN without MATCH is sent with MATCH of prefix.
+// Prefix is stripped from keys returned by SCAN and KEYS. Keys of unknown commands are untouched.
+type KeyPrefixHook struct {
+	prefix        string
+	escapedPrefix string
+}
+
+// NewKeyPrefixHook creates KeyPrefixHook with prefix, like myapp:
+func NewKeyPrefixHook(prefix string) *KeyPrefixHook {
+	return &KeyPrefixHook{
+		prefix:        prefix,
+		escapedPrefix: escapeGlob(prefix),
+	}
+}
+
+// Prefix returns prefix of keys
+func (h *KeyPrefixHook) Prefix() string {
+	return h.prefix
+}
+
+func (h *KeyPrefixHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return next(ctx, network, addr)
+	}
+}
+
+func (h *KeyPrefixHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		sent, origin := h.prepare(ctx, cmd)
+		err := next(ctx, sent)
+		h.finish(cmd, sent, origin)
+		return err
+	}
+}
+
+func (h *KeyPrefixHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		sent := make([]redis.Cmder, len(cmds))
+		origins := make([][]interface{}, len(cmds))
+		for i := range cmds {
+			sent[i], origins[i] = h.prepare(ctx, cmds[i])
+		}
+		err := next(ctx, sent)
+		for i := range cmds {
+			h.finish(cmds[i], sent[i], origins[i])
+		}
+		return err
+	}
+}
+
+// prepare returns cmd sent to server and original arguments of cmd
+func (h *KeyPrefixHook) prepare(ctx context.Context, cmd redis.Cmder) (redis.Cmder, []interface{}) {
+	if scan := h.scanWithMatch(ctx, cmd); scan != nil {
+		return scan, nil
+	}
+
+	return cmd, h.rewrite(cmd)
+}
+
+// finish copies result of sent cmd if it is not cmd, restores arguments and strips prefix from result
+func (h *KeyPrefixHook) finish(cmd, sent redis.Cmder, origin []interface{}) {
+	if scan, ok := sent.(*redis.ScanCmd); ok && sent != cmd {
+		keys, cursor := scan.Val()
+		cmd.(*redis.ScanCmd).SetVal(keys, cursor)
+		cmd.SetErr(scan.Err())
+	} else {
+		restore(cmd, origin)
+	}
+
+	h.strip(cmd)
+}
+
+// scanWithMatch returns new SCAN with MATCH of prefix if cmd is SCAN without MATCH, nil otherwise.
+// Arguments of cmd could not be appended, so the new one is sent instead.
+func (h *KeyPrefixHook) scanWithMatch(ctx context.Context, cmd redis.Cmder) *redis.ScanCmd {
+	scan, ok := cmd.(*redis.ScanCmd)
+	if !ok || strings.ToLower(scan.Name()) != "scan" {
+		return nil
+	}
+
+	args := scan.Args()
+	for i := 2; i < len(args); i++ {
+		if strings.EqualFold(toString(args[i]), "match") {
+			return nil
+		}
+	}
+
+	args = append(append([]interface{}(nil), args...), "match", h.escapedPrefix+"*")
+	return redis.NewScanCmd(ctx, nil, args...)
+}
+
+// rewrite prefixes keys in arguments of cmd in place and returns copy of original arguments, which should be
+// restored after cmd processed, since cmd may be sent again like ScanIterator does for each page.
+func (h *KeyPrefixHook) rewrite(cmd redis.Cmder) []interface{} {
+	args := cmd.Args()
+	if len(args) < 2 {
+		return nil
+	}
+	origin := append([]interface{}(nil), args...)
+
+	name := strings.ToLower(cmd.Name())
+
+	switch name {
+	case "scan":
+		// MATCH pattern, SCAN without MATCH is replaced by scanWithMatch
+		for i := 2; i < len(args)-1; i++ {
+			if strings.EqualFold(toString(args[i]), "match") {
+				args[i+1] = h.escapedPrefix + toString(args[i+1])
+				break
+			}
+		}
+		return origin
+	case "keys":
+		args[1] = h.escapedPrefix + toString(args[1])
+		return origin
+	case "xread", "xreadgroup":
+		// keys are the first half of arguments after STREAMS
+		for i := 1; i < len(args); i++ {
+			if strings.EqualFold(toString(args[i]), "streams") {
+				h.prefixRange(args, i+1, i+(len(args)-i-1)/2, 1)
+				break
+			}
+		}
+		return origin
+	case "sort", "sort_ro":
+		h.prefixRange(args, 1, 1, 1)
+		for i := 2; i < len(args)-1; i++ {
+			switch strings.ToLower(toString(args[i])) {
+			case "store":
+				h.prefixRange(args, i+1, i+1, 1)
+			case "by":
+				// patterns are keys, nosort skips sorting
+				if !strings.EqualFold(toString(args[i+1]), "nosort") {
+					h.prefixRange(args, i+1, i+1, 1)
+				}
+			case "get":
+				// # gets element itself
+				if toString(args[i+1]) != "#" {
+					h.prefixRange(args, i+1, i+1, 1)
+				}
+			case "limit":
+				i += 2
+				continue
+			default:
+				continue
+			}
+			i++
+		}
+		return origin
+	case "georadius", "georadiusbymember":
+		h.prefixRange(args, 1, 1, 1)
+		// options follow radius and unit
+		first := 6
+		if name == "georadiusbymember" {
+			first = 5
+		}
+		for i := first; i < len(args)-1; i++ {
+			switch strings.ToLower(toString(args[i])) {
+			case "store", "storedist":
+				h.prefixRange(args, i+1, i+1, 1)
+				i++
+			case "count":
+				i++
+			}
+		}
+		return origin
+	case "zunionstore", "zinterstore", "zdiffstore":
+		h.prefixRange(args, 1, 1, 1)
+	}
+
+	if index, ok := numKeysIndex[name]; ok {
+		if index >= len(args) {
+			return origin
+		}
+		numKeys, err := strconv.Atoi(toString(args[index]))
+		if err != nil {
+			return origin
+		}
+		h.prefixRange(args, index+1, index+numKeys, 1)
+		return origin
+	}
+
+	if spec, ok := keySpecs[name]; ok {
+		last := spec.last
+		if last < 0 {
+			last = len(args) + last
+		}
+		h.prefixRange(args, spec.first, last, spec.step)
+	}
+
+	return origin
+}
+
+// prefixRange prefixes string arguments from first to last inclusively with step
+func (h *KeyPrefixHook) prefixRange(args []interface{}, first, last, step int) {
+	for i := first; i <= last && i < len(args); i += step {
+		if key, ok := args[i].(string); ok {
+			args[i] = h.prefix + key
+		}
+	}
+}
+
+// strip removes prefix from keys returned by SCAN and KEYS
+func (h *KeyPrefixHook) strip(cmd redis.Cmder) {
+	switch c := cmd.(type) {
+	case *redis.ScanCmd:
+		if strings.ToLower(c.Name()) != "scan" {
+			return
+		}
+		keys, cursor := c.Val()
+		c.SetVal(h.stripKeys(keys), cursor)
+	case *redis.StringSliceCmd:
+		if strings.ToLower(c.Name()) != "keys" {
+			return
+		}
+		c.SetVal(h.stripKeys(c.Val()))
+	}
+}
+
+// restore sets arguments of cmd back to origin
+func restore(cmd redis.Cmder, origin []interface{}) {
+	if origin != nil {
+		copy(cmd.Args(), origin)
+	}
+}
+
+// stripKeys removes prefix from keys, keys without prefix are dropped
+func (h *KeyPrefixHook) stripKeys(keys []string) []string {
+	res := make([]string, 0, len(keys))
+	for i := range keys {
+		if strings.HasPrefix(keys[i], h.prefix) {
+			res = append(res, strings.TrimPrefix(keys[i], h.prefix))
+		}
+	}
+
+	return res
+}
+
+// escapeGlob escapes special characters of glob-style pattern
+func escapeGlob(s string) string {
+	var builder strings.Builder
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			builder.WriteRune('\\')
+		}
+		builder.WriteRune(r)
+	}
+
+	return builder.String()
+}
+
+func toString(v interface{}) string {
+	switch s := v.(type) {
+	case string:
+		return s
+	case []byte:
+		return string(s)
+	}
+
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,154 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkredis
+
+import (
+	"context"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestKeyPrefixHook_Rewrite(t *testing.T) {
+	hook := NewKeyPrefixHook("app:")
+	assert.Equal(t, "app:", hook.Prefix())
+
+	ctx := context.TODO()
+	cases := []struct {
+		cmd      redis.Cmder
+		expected []interface{}
+	}{
+		{redis.NewStatusCmd(ctx, "set", "k", "v"), []interface{}{"set", "app:k", "v"}},
+		{redis.NewIntCmd(ctx, "del", "k1", "k2"), []interface{}{"del", "app:k1", "app:k2"}},
+		{redis.NewStatusCmd(ctx, "mset", "k1", "v1", "k2", "v2"), []interface{}{"mset", "app:k1", "v1", "app:k2", "v2"}},
+		{redis.NewStringCmd(ctx, "rename", "k1", "k2"), []interface{}{"rename", "app:k1", "app:k2"}},
+		{redis.NewStringSliceCmd(ctx, "blpop", "k1", "k2", 1), []interface{}{"blpop", "app:k1", "app:k2", 1}},
+		{redis.NewIntCmd(ctx, "bitop", "and", "d", "k"), []interface{}{"bitop", "and", "app:d", "app:k"}},
+		{redis.NewStringCmd(ctx, "object", "encoding", "k"), []interface{}{"object", "encoding", "app:k"}},
+		{redis.NewStatusCmd(ctx, "xgroup", "create", "s", "g", "0"), []interface{}{"xgroup", "create", "app:s", "g", "0"}},
+		{redis.NewCmd(ctx, "evalsha", "sha", 2, "k1", "k2", "arg"), []interface{}{"evalsha", "sha", 2, "app:k1", "app:k2", "arg"}},
+		{redis.NewIntCmd(ctx, "zunionstore", "d", 2, "k1", "k2", "weights", 1, 2), []interface{}{"zunionstore", "app:d", 2, "app:k1", "app:k2", "weights", 1, 2}},
+		{redis.NewZSliceCmd(ctx, "zunion", 2, "k1", "k2", "withscores"), []interface{}{"zunion", 2, "app:k1", "app:k2", "withscores"}},
+		{redis.NewXStreamSliceCmd(ctx, "xreadgroup", "group", "g", "c", "streams", "s1", "s2", ">", ">"), []interface{}{"xreadgroup", "group", "g", "c", "streams", "app:s1", "app:s2", ">", ">"}},
+		{redis.NewIntCmd(ctx, "sort", "k", "limit", 0, 1, "store", "d"), []interface{}{"sort", "app:k", "limit", 0, 1, "store", "app:d"}},
+		{redis.NewStringSliceCmd(ctx, "sort", "k", "by", "w_*", "get", "#", "get", "o_*->f", "alpha"), []interface{}{"sort", "app:k", "by", "app:w_*", "get", "#", "get", "app:o_*->f", "alpha"}},
+		{redis.NewStringSliceCmd(ctx, "sort_ro", "k", "by", "nosort", "get", "o_*"), []interface{}{"sort_ro", "app:k", "by", "nosort", "get", "app:o_*"}},
+		{redis.NewIntCmd(ctx, "georadius", "k", 1, 2, 3, "km", "count", 5, "store", "d", "storedist", "e"), []interface{}{"georadius", "app:k", 1, 2, 3, "km", "count", 5, "store", "app:d", "storedist", "app:e"}},
+		// member named store is not a key
+		{redis.NewIntCmd(ctx, "georadiusbymember", "k", "store", 3, "km", "store", "d"), []interface{}{"georadiusbymember", "app:k", "store", 3, "km", "store", "app:d"}},
+		{redis.NewScanCmd(ctx, nil, "scan", 0, "match", "user:*"), []interface{}{"scan", 0, "match", "app:user:*"}},
+		{redis.NewScanCmd(ctx, nil, "hscan", "k", 0, "match", "f*"), []interface{}{"hscan", "app:k", 0, "match", "f*"}},
+		{redis.NewStringSliceCmd(ctx, "keys", "*"), []interface{}{"keys", "app:*"}},
+		// unknown command
+		{redis.NewStatusCmd(ctx, "ping"), []interface{}{"ping"}},
+		{redis.NewCmd(ctx, "publish", "ch", "msg"), []interface{}{"publish", "ch", "msg"}},
+	}
+
+	for _, c := range cases {
+		args := append([]interface{}(nil), c.cmd.Args()...)
+		origin := hook.rewrite(c.cmd)
+		assert.Equal(t, c.expected, c.cmd.Args())
+
+		// arguments are restored after processed
+		restore(c.cmd, origin)
+		assert.Equal(t, args, c.cmd.Args())
+	}
+
+	// SCAN without MATCH is sent with MATCH of prefix
+	scan := hook.scanWithMatch(ctx, redis.NewScanCmd(ctx, nil, "scan", 0, "count", 10))
+	assert.Equal(t, []interface{}{"scan", 0, "count", 10, "match", "app:*"}, scan.Args())
+	assert.Nil(t, hook.scanWithMatch(ctx, redis.NewScanCmd(ctx, nil, "scan", 0, "match", "user:*")))
+	assert.Nil(t, hook.scanWithMatch(ctx, redis.NewScanCmd(ctx, nil, "hscan", "k", 0)))
+
+	// glob characters in prefix are escaped in patterns
+	hook = NewKeyPrefixHook("app[1]:")
+	cmd := redis.NewStringSliceCmd(ctx, "keys", "*")
+	hook.rewrite(cmd)
+	assert.Equal(t, []interface{}{"keys", `app\[1\]:*`}, cmd.Args())
+}
+
+func TestKeyPrefixHook_WithEntry(t *testing.T) {
+	entry := newMemoryEntry(t, WithKeyPrefix("app:"))
+	other := newMemoryEntry(t)
+	assert.Equal(t, "app:", entry.GetKeyPrefix())
+	ctx := context.TODO()
+
+	// keys are prefixed on server
+	assert.Nil(t, entry.Client.Set(ctx, "user:1", "v", time.Minute).Err())
+	assert.Nil(t, entry.Client.MSet(ctx, "user:2", "v", "user:3", "v").Err())
+	assert.Equal(t, "v", entry.Client.Get(ctx, "user:1").Val())
+	assert.True(t, entry.GetMemoryServer().Exists("app:user:1"))
+	assert.True(t, entry.GetMemoryServer().Exists("app:user:3"))
+	assert.False(t, entry.GetMemoryServer().Exists("user:1"))
+
+	// key of other application on the same server
+	assert.Nil(t, entry.GetMemoryServer().Set("user:4", "v"))
+
+	// prefix is stripped from KEYS and SCAN
+	keys := entry.Client.Keys(ctx, "user:*").Val()
+	sort.Strings(keys)
+	assert.Equal(t, []string{"user:1", "user:2", "user:3"}, keys)
+
+	keys, _ = entry.Client.Scan(ctx, 0, "user:*", 100).Val()
+	sort.Strings(keys)
+	assert.Equal(t, []string{"user:1", "user:2", "user:3"}, keys)
+
+	// keys of other application are not scanned
+	keys, cursor := entry.Client.Scan(ctx, 0, "", 2).Val()
+	for cursor != 0 {
+		var page []string
+		page, cursor = entry.Client.Scan(ctx, cursor, "", 2).Val()
+		keys = append(keys, page...)
+	}
+	sort.Strings(keys)
+	assert.Equal(t, []string{"user:1", "user:2", "user:3"}, keys)
+
+	// Lua KEYS
+	script := redis.NewScript(`return redis.call("GET", KEYS[1])`)
+	assert.Equal(t, "v", script.Run(ctx, entry.Client, []string{"user:1"}).Val())
+
+	// pipeline
+	pipe := entry.Client.Pipeline()
+	pipe.Del(ctx, "user:1", "user:2")
+	keysCmd := pipe.Keys(ctx, "user:*")
+	scanCmd := pipe.Scan(ctx, 0, "", 100)
+	_, err := pipe.Exec(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"user:3"}, keysCmd.Val())
+	keys, _ = scanCmd.Val()
+	assert.Contains(t, keys, "user:3")
+	assert.NotContains(t, keys, "user:4")
+
+	// iterators send the same cmd for each page, prefix is added once
+	for i := 0; i < 30; i++ {
+		assert.Nil(t, entry.Client.Set(ctx, fmt.Sprintf("k%d", i), "v", 0).Err())
+		assert.Nil(t, entry.Client.HSet(ctx, "hash", fmt.Sprintf("f%d", i), "v").Err())
+	}
+
+	count := 0
+	iter := entry.Client.Scan(ctx, 0, "k*", 5).Iterator()
+	for iter.Next(ctx) {
+		count++
+	}
+	assert.Nil(t, iter.Err())
+	assert.Equal(t, 30, count)
+
+	count = 0
+	iter = entry.Client.HScan(ctx, "hash", 0, "f*", 5).Iterator()
+	for iter.Next(ctx) {
+		count++
+	}
+	assert.Nil(t, iter.Err())
+	// fields and values
+	assert.Equal(t, 60, count)
+
+	// entry without prefix is untouched
+	assert.Nil(t, other.Client.Set(ctx, "user:1", "v", 0).Err())
+	assert.True(t, other.GetMemoryServer().Exists("user:1"))
+}
@@ -0,0 +1,398 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkredis
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"net"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// OverflowPolicy decides what to do with new message if buffer of subscription is full
+type OverflowPolicy int
+
+const (
+	// OverflowBlock stops receiving until buffer is available, messages are kept in output buffer of server
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropNewest drops the new message
+	OverflowDropNewest
+	// OverflowDropOldest drops the oldest message in buffer and puts the new one
+	OverflowDropOldest
+)
+
+// SubscriptionHandler handles message of subscription, error would be logged
+type SubscriptionHandler func(ctx context.Context, msg *redis.Message) error
+
+// SubscribeOptions options of RedisEntry.Subscribe
+type SubscribeOptions struct {
+	// Pattern subscribes patterns with PSUBSCRIBE instead of channels
+	Pattern bool
+	// Workers number of handlers, default: 1
+	Workers int
+	// BufferSize of messages waiting for handlers, default: 100
+	BufferSize int
+	// Overflow policy if buffer is full, default: OverflowBlock
+	Overflow OverflowPolicy
+	// HealthCheckInterval PING would be sent if no message received within it, default: 30 seconds
+	HealthCheckInterval time.Duration
+	// MinRetryBackoff backoff of resubscribe, default: 100 milliseconds
+	MinRetryBackoff time.Duration
+	// MaxRetryBackoff backoff of resubscribe, default: 10 seconds
+	MaxRetryBackoff time.Duration
+}
+
+// Subscription is a managed subscription created by RedisEntry.Subscribe
+type Subscription struct {
+	entry    *RedisEntry
+	client   redis.UniversalClient
+	channels []string
+	opts     SubscribeOptions
+	handler  SubscriptionHandler
+	buffer   chan *redis.Message
+	dropped  uint64
+	cancel   context.CancelFunc
+	done     chan struct{}
+	mutex    sync.Mutex
+	pubsub   *redis.PubSub
+	// onResubscribe is called before resubscribing, optional
+	onResubscribe func()
+	// workerIDs are ids of goroutines running handler, used to detect Close called by handler
+	workerIDs sync.Map
+}
+
+// Subscribe subscribes channels or patterns and dispatches messages to handler with bounded workers.
+//
+// Subscription would be recreated with backoff if connection is broken or no PONG received for health check,
+// so that it follows failover and topology changes of cluster. Subscription is closed at Interrupt.
+func (entry *RedisEntry) Subscribe(ctx context.Context, channels []string, handler SubscriptionHandler, opts *SubscribeOptions) (*Subscription, error) {
+	if len(channels) < 1 {
+		return nil, errors.New("channels of subscription are required")
+	}
+
+	if handler == nil {
+		return nil, fmt.Errorf("handler of subscription %v is required", channels)
+	}
+
+	if entry.Client == nil {
+		return nil, fmt.Errorf("redis client of entry [%s] is not initialized, please call Bootstrap first", entry.entryName)
+	}
+
+	return entry.newSubscription(ctx, entry.Client, channels, handler, opts, nil)
+}
+
+// newSubscription subscribes channels with client, which could be client of a node in cluster,
+// onResubscribe is called before resubscribing if not nil
+func (entry *RedisEntry) newSubscription(ctx context.Context, client redis.UniversalClient, channels []string, handler SubscriptionHandler, opts *SubscribeOptions, onResubscribe func()) (*Subscription, error) {
+	sub := &Subscription{
+		entry:         entry,
+		client:        client,
+		channels:      channels,
+		opts:          withSubscribeDefaults(opts),
+		handler:       handler,
+		done:          make(chan struct{}),
+		onResubscribe: onResubscribe,
+	}
+	sub.buffer = make(chan *redis.Message, sub.opts.BufferSize)
+
+	// make sure subscription works at the first time
+	pubsub, err := sub.subscribe(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	entry.subMutex.Lock()
+	defer entry.subMutex.Unlock()
+
+	if entry.subStopped {
+		pubsub.Close()
+		return nil, fmt.Errorf("entry [%s] is interrupted", entry.entryName)
+	}
+
+	ctx, sub.cancel = context.WithCancel(ctx)
+	entry.subs = append(entry.subs, sub)
+
+	go sub.run(ctx, pubsub)
+
+	return sub, nil
+}
+
+// withSubscribeDefaults returns copy of options with defaults
+func withSubscribeDefaults(opts *SubscribeOptions) SubscribeOptions {
+	res := SubscribeOptions{}
+	if opts != nil {
+		res = *opts
+	}
+
+	if res.Workers < 1 {
+		res.Workers = 1
+	}
+
+	if res.BufferSize < 1 {
+		res.BufferSize = 100
+	}
+
+	if res.HealthCheckInterval <= 0 {
+		res.HealthCheckInterval = 30 * time.Second
+	}
+
+	if res.MinRetryBackoff <= 0 {
+		res.MinRetryBackoff = 100 * time.Millisecond
+	}
+
+	if res.MaxRetryBackoff <= 0 {
+		res.MaxRetryBackoff = 10 * time.Second
+	}
+
+	return res
+}
+
+// Channels returns channels or patterns subscribed
+func (sub *Subscription) Channels() []string {
+	return sub.channels
+}
+
+// Dropped returns number of messages dropped by overflow policy
+func (sub *Subscription) Dropped() uint64 {
+	return atomic.LoadUint64(&sub.dropped)
+}
+
+// Close unsubscribes and waits for messages in buffer handled.
+// Close called by handler returns without waiting, messages in buffer are still handled after it returns.
+func (sub *Subscription) Close() {
+	sub.cancel()
+
+	// interrupt blocking receive
+	sub.mutex.Lock()
+	if sub.pubsub != nil {
+		sub.pubsub.Close()
+	}
+	sub.mutex.Unlock()
+
+	// handler waiting for itself would never return
+	if _, ok := sub.workerIDs.Load(goroutineID()); !ok {
+		<-sub.done
+	}
+
+	sub.entry.subMutex.Lock()
+	defer sub.entry.subMutex.Unlock()
+	for i := range sub.entry.subs {
+		if sub.entry.subs[i] == sub {
+			sub.entry.subs = append(sub.entry.subs[:i], sub.entry.subs[i+1:]...)
+			break
+		}
+	}
+}
+
+// stopSubscriptions closes all keyspace listeners and subscriptions, called at Interrupt
+func (entry *RedisEntry) stopSubscriptions() {
+	entry.subMutex.Lock()
+	entry.subStopped = true
+	listeners := entry.listeners
+	entry.listeners = nil
+	subs := entry.subs
+	entry.subs = nil
+	entry.subMutex.Unlock()
+
+	// listeners resubscribe nodes, so they are closed first
+	for i := range listeners {
+		listeners[i].Close()
+	}
+
+	for i := range subs {
+		subs[i].Close()
+	}
+}
+
+// subscribe creates PubSub and waits for confirmation of subscription
+func (sub *Subscription) subscribe(ctx context.Context) (*redis.PubSub, error) {
+	var pubsub *redis.PubSub
+	if sub.opts.Pattern {
+		pubsub = sub.client.PSubscribe(ctx, sub.channels...)
+	} else {
+		pubsub = sub.client.Subscribe(ctx, sub.channels...)
+	}
+
+	if _, err := pubsub.ReceiveTimeout(ctx, sub.opts.HealthCheckInterval); err != nil {
+		pubsub.Close()
+		return nil, err
+	}
+
+	return pubsub, nil
+}
+
+// run receives messages and resubscribes with backoff until ctx done
+func (sub *Subscription) run(ctx context.Context, pubsub *redis.PubSub) {
+	defer close(sub.done)
+
+	fields := []zap.Field{
+		zap.String("entryName", sub.entry.entryName),
+		zap.Strings("channels", sub.channels),
+		zap.Bool("pattern", sub.opts.Pattern),
+	}
+
+	sub.entry.loggerEntry.Info("Starting subscription", fields...)
+
+	// messages in buffer are handled after ctx canceled by Close
+	handlerCtx := withoutCancel(ctx)
+
+	workers := sync.WaitGroup{}
+	for i := 0; i < sub.opts.Workers; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			id := goroutineID()
+			sub.workerIDs.Store(id, true)
+			defer sub.workerIDs.Delete(id)
+
+			for msg := range sub.buffer {
+				if err := sub.handler(handlerCtx, msg); err != nil {
+					sub.entry.loggerEntry.Warn("Handling subscription message failed",
+						zap.String("channel", msg.Channel), zap.Error(err))
+				}
+			}
+		}()
+	}
+
+	attempt := 0
+	for {
+		var err error
+		if pubsub == nil {
+			pubsub, err = sub.subscribe(ctx)
+		}
+
+		if err == nil {
+			sub.setPubSub(pubsub)
+			if ctx.Err() == nil {
+				attempt = 0
+				err = sub.receive(ctx, pubsub)
+			}
+			sub.setPubSub(nil)
+			pubsub.Close()
+			pubsub = nil
+		}
+
+		if ctx.Err() != nil {
+			break
+		}
+
+		if sub.onResubscribe != nil {
+			sub.onResubscribe()
+		}
+
+		attempt++
+		backoff := expBackoff(sub.opts.MinRetryBackoff, sub.opts.MaxRetryBackoff, attempt)
+		sub.entry.loggerEntry.Warn("Resubscribing",
+			append(fields, zap.Int("attempt", attempt), zap.Duration("backoff", backoff), zap.Error(err))...)
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(backoff):
+		}
+	}
+
+	close(sub.buffer)
+	workers.Wait()
+
+	sub.entry.loggerEntry.Info("Stopping subscription", append(fields, zap.Uint64("dropped", sub.Dropped()))...)
+}
+
+// receive dispatches messages until error occurs, PING is sent if idle for HealthCheckInterval,
+// error would be returned if PONG is not received in the next interval.
+func (sub *Subscription) receive(ctx context.Context, pubsub *redis.PubSub) error {
+	pinged := false
+	for {
+		msg, err := pubsub.ReceiveTimeout(ctx, sub.opts.HealthCheckInterval)
+		if err != nil {
+			var netErr net.Error
+			if !pinged && errors.As(err, &netErr) && netErr.Timeout() {
+				if err := pubsub.Ping(ctx); err != nil {
+					return err
+				}
+				pinged = true
+				continue
+			}
+			return err
+		}
+		pinged = false
+
+		if m, ok := msg.(*redis.Message); ok {
+			sub.dispatch(ctx, m)
+		}
+	}
+}
+
+// dispatch puts message into buffer with overflow policy
+func (sub *Subscription) dispatch(ctx context.Context, msg *redis.Message) {
+	switch sub.opts.Overflow {
+	case OverflowDropNewest:
+		select {
+		case sub.buffer <- msg:
+		default:
+			atomic.AddUint64(&sub.dropped, 1)
+		}
+	case OverflowDropOldest:
+		for {
+			select {
+			case sub.buffer <- msg:
+				return
+			default:
+			}
+
+			select {
+			case <-sub.buffer:
+				atomic.AddUint64(&sub.dropped, 1)
+			default:
+			}
+		}
+	default:
+		select {
+		case sub.buffer <- msg:
+		case <-ctx.Done():
+		}
+	}
+}
+
+func (sub *Subscription) setPubSub(pubsub *redis.PubSub) {
+	sub.mutex.Lock()
+	defer sub.mutex.Unlock()
+	sub.pubsub = pubsub
+}
+
+// goroutineID returns id of current goroutine parsed from header of stack like "goroutine 18 [running]:"
+func goroutineID() uint64 {
+	buf := make([]byte, 64)
+	buf = bytes.TrimPrefix(buf[:runtime.Stack(buf, false)], []byte("goroutine "))
+	if i := bytes.IndexByte(buf, ' '); i > 0 {
+		buf = buf[:i]
+	}
+
+	id, _ := strconv.ParseUint(string(buf), 10, 64)
+	return id
+}
+
+// detachedContext keeps values of parent but is never canceled
+type detachedContext struct {
+	parent context.Context
+}
+
+func (ctx detachedContext) Deadline() (time.Time, bool)       { return time.Time{}, false }
+func (ctx detachedContext) Done() <-chan struct{}             { return nil }
+func (ctx detachedContext) Err() error                        { return nil }
+func (ctx detachedContext) Value(key interface{}) interface{} { return ctx.parent.Value(key) }
+
+// withoutCancel returns context with values of ctx which is not canceled when ctx is canceled
+func withoutCancel(ctx context.Context) context.Context {
+	return detachedContext{parent: ctx}
+}
@@ -0,0 +1,214 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkredis
+
+import (
+	"context"
+	"github.com/redis/go-redis/v9"
+	"github.com/rookie-ninja/rk-entry/v2/entry"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestWithSubscribeDefaults(t *testing.T) {
+	opts := withSubscribeDefaults(nil)
+	assert.Equal(t, 1, opts.Workers)
+	assert.Equal(t, 100, opts.BufferSize)
+	assert.Equal(t, OverflowBlock, opts.Overflow)
+	assert.Equal(t, 30*time.Second, opts.HealthCheckInterval)
+	assert.Equal(t, 100*time.Millisecond, opts.MinRetryBackoff)
+	assert.Equal(t, 10*time.Second, opts.MaxRetryBackoff)
+}
+
+func TestRedisEntry_Subscribe(t *testing.T) {
+	handler := func(ctx context.Context, msg *redis.Message) error { return nil }
+
+	// not bootstrapped
+	entry := RegisterRedisEntry()
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+	_, err := entry.Subscribe(context.TODO(), []string{"ch"}, handler, nil)
+	assert.NotNil(t, err)
+
+	entry = newMemoryEntry(t)
+
+	// invalid
+	_, err = entry.Subscribe(context.TODO(), nil, handler, nil)
+	assert.NotNil(t, err)
+	_, err = entry.Subscribe(context.TODO(), []string{"ch"}, nil, nil)
+	assert.NotNil(t, err)
+
+	// channels
+	received := make(chan *redis.Message, 10)
+	sub, err := entry.Subscribe(context.TODO(), []string{"ch"}, func(ctx context.Context, msg *redis.Message) error {
+		received <- msg
+		return nil
+	}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"ch"}, sub.Channels())
+
+	assert.Equal(t, int64(1), entry.Client.Publish(context.TODO(), "ch", "hello").Val())
+	assertMessage(t, received, "ch", "hello")
+
+	// patterns
+	_, err = entry.Subscribe(context.TODO(), []string{"user.*"}, func(ctx context.Context, msg *redis.Message) error {
+		received <- msg
+		return nil
+	}, &SubscribeOptions{Pattern: true})
+	assert.Nil(t, err)
+
+	assert.Equal(t, int64(1), entry.Client.Publish(context.TODO(), "user.1", "created").Val())
+	assertMessage(t, received, "user.1", "created")
+
+	// closed at Interrupt
+	entry.Interrupt(context.TODO())
+	_, err = entry.Subscribe(context.TODO(), []string{"ch"}, handler, nil)
+	assert.NotNil(t, err)
+}
+
+func TestSubscription_Resubscribe(t *testing.T) {
+	entry := newMemoryEntry(t)
+
+	received := make(chan *redis.Message, 10)
+	sub, err := entry.Subscribe(context.TODO(), []string{"ch"}, func(ctx context.Context, msg *redis.Message) error {
+		received <- msg
+		return nil
+	}, &SubscribeOptions{
+		HealthCheckInterval: 20 * time.Millisecond,
+		MinRetryBackoff:     10 * time.Millisecond,
+	})
+	assert.Nil(t, err)
+	defer sub.Close()
+
+	// idle with health check
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, int64(1), entry.Client.Publish(context.TODO(), "ch", "idle").Val())
+	assertMessage(t, received, "ch", "idle")
+
+	// connection broken
+	sub.mutex.Lock()
+	assert.Nil(t, sub.pubsub.Close())
+	sub.mutex.Unlock()
+	assert.Eventually(t, func() bool {
+		return entry.Client.Publish(context.TODO(), "ch", "reconnected").Val() == 1
+	}, 2*time.Second, 10*time.Millisecond)
+	assertMessage(t, received, "ch", "reconnected")
+}
+
+func TestSubscription_Overflow(t *testing.T) {
+	entry := newMemoryEntry(t)
+
+	newSub := func(overflow OverflowPolicy) (*Subscription, chan string, chan struct{}) {
+		received, release := make(chan string, 10), make(chan struct{})
+		sub, err := entry.Subscribe(context.TODO(), []string{"ch"}, func(ctx context.Context, msg *redis.Message) error {
+			<-release
+			received <- msg.Payload
+			return nil
+		}, &SubscribeOptions{BufferSize: 1, Overflow: overflow})
+		assert.Nil(t, err)
+		return sub, received, release
+	}
+
+	publish := func() {
+		for _, payload := range []string{"1", "2", "3", "4", "5"} {
+			entry.Client.Publish(context.TODO(), "ch", payload)
+			// make sure message is dispatched in order
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// drop newest
+	sub, received, release := newSub(OverflowDropNewest)
+	publish()
+	assert.Eventually(t, func() bool { return sub.Dropped() == 3 }, time.Second, 10*time.Millisecond)
+	close(release)
+	assert.Equal(t, "1", <-received)
+	assert.Equal(t, "2", <-received)
+	sub.Close()
+
+	// drop oldest
+	sub, received, release = newSub(OverflowDropOldest)
+	publish()
+	assert.Eventually(t, func() bool { return sub.Dropped() == 3 }, time.Second, 10*time.Millisecond)
+	close(release)
+	assert.Equal(t, "1", <-received)
+	assert.Equal(t, "5", <-received)
+	sub.Close()
+}
+
+func assertMessage(t *testing.T, received chan *redis.Message, channel, payload string) {
+	select {
+	case msg := <-received:
+		assert.Equal(t, channel, msg.Channel)
+		assert.Equal(t, payload, msg.Payload)
+	case <-time.After(time.Second):
+		assert.Fail(t, "message not received")
+	}
+}
+
+func TestSubscription_Close(t *testing.T) {
+	entry := newMemoryEntry(t)
+
+	// closed by handler without waiting for itself
+	var sub *Subscription
+	closed := make(chan struct{})
+	sub, err := entry.Subscribe(context.TODO(), []string{"ch"}, func(ctx context.Context, msg *redis.Message) error {
+		sub.Close()
+		close(closed)
+		return nil
+	}, nil)
+	assert.Nil(t, err)
+
+	entry.Client.Publish(context.TODO(), "ch", "close")
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		assert.Fail(t, "Close called by handler is blocked")
+	}
+	sub.Close()
+	assert.Empty(t, entry.subs)
+
+	// messages in buffer are handled with context not canceled
+	release := make(chan struct{})
+	ctxErrs := make(chan error, 10)
+	sub, err = entry.Subscribe(context.TODO(), []string{"ch"}, func(ctx context.Context, msg *redis.Message) error {
+		<-release
+		ctxErrs <- ctx.Err()
+		return nil
+	}, nil)
+	assert.Nil(t, err)
+
+	for i := 0; i < 3; i++ {
+		entry.Client.Publish(context.TODO(), "ch", "hello")
+	}
+	assert.Eventually(t, func() bool {
+		return len(sub.buffer) == 2
+	}, time.Second, 10*time.Millisecond)
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		close(release)
+	}()
+	sub.Close()
+
+	assert.Len(t, ctxErrs, 3)
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, <-ctxErrs)
+	}
+}
+
+func TestWithoutCancel(t *testing.T) {
+	parent, cancel := context.WithTimeout(context.WithValue(context.TODO(), "key", "value"), time.Millisecond)
+	ctx := withoutCancel(parent)
+	cancel()
+
+	assert.Nil(t, ctx.Err())
+	assert.Nil(t, ctx.Done())
+	_, ok := ctx.Deadline()
+	assert.False(t, ok)
+	assert.Equal(t, "value", ctx.Value("key"))
+	assert.NotZero(t, goroutineID())
+}
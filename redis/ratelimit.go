@@ -0,0 +1,370 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkredis
+
+import (
+	"context"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// GCRA generic cell rate algorithm, requests are spread over period and burst is allowed
+	GCRA = "gcra"
+	// SlidingWindow allows rate of requests in any window of period
+	SlidingWindow = "slidingWindow"
+
+	defaultRateLimitPrefix = "rk:rate:"
+)
+
+var (
+	// gcraScript is based on https://github.com/go-redis/redis_rate, time is computed in microseconds
+	// as integer to avoid precision loss of float.
+	//
+	// KEYS[1]: key, ARGV: burst, rate, period in microseconds, cost
+	// returns: allowed, remaining, retry after and reset after in microseconds, -1 if not applicable
+	gcraScript = redis.NewScript(`
+local key = KEYS[1]
+local burst = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local period = tonumber(ARGV[3])
+local cost = tonumber(ARGV[4])
+
+local emission_interval = math.floor(period / rate)
+local increment = emission_interval * cost
+local burst_offset = emission_interval * burst
+
+-- effects replication is required before writes after TIME in redis 3.2 to 4.x, default since 5.0
+redis.replicate_commands()
+
+local now = redis.call("TIME")
+now = tonumber(now[1]) * 1000000 + tonumber(now[2])
+
+local tat = tonumber(redis.call("GET", key) or now)
+tat = math.max(tat, now)
+
+local new_tat = tat + increment
+local diff = now - (new_tat - burst_offset)
+
+if diff < 0 then
+	local retry_after = -diff
+	if increment > burst_offset then
+		retry_after = -1
+	end
+	return {0, 0, retry_after, tat - now}
+end
+
+local reset_after = new_tat - now
+if reset_after > 0 then
+	redis.call("SET", key, string.format("%d", new_tat), "PX", math.ceil(reset_after / 1000))
+end
+
+return {cost, math.floor(diff / emission_interval), -1, reset_after}`)
+
+	// slidingWindowScript keeps timestamps of requests in sorted set
+	//
+	// KEYS[1]: key, ARGV: limit, period in microseconds, cost
+	// returns: allowed, remaining, retry after and reset after in microseconds, -1 if not applicable
+	slidingWindowScript = redis.NewScript(`
+local key = KEYS[1]
+local limit = tonumber(ARGV[1])
+local period = tonumber(ARGV[2])
+local cost = tonumber(ARGV[3])
+
+-- effects replication is required before writes after TIME in redis 3.2 to 4.x, default since 5.0
+redis.replicate_commands()
+
+local now = redis.call("TIME")
+now = tonumber(now[1]) * 1000000 + tonumber(now[2])
+
+redis.call("ZREMRANGEBYSCORE", key, "-inf", string.format("%d", now - period))
+local count = redis.call("ZCARD", key)
+
+if count + cost > limit then
+	local retry_after = -1
+	if cost <= limit then
+		local index = count + cost - limit - 1
+		local oldest = redis.call("ZRANGE", key, index, index, "WITHSCORES")
+		retry_after = tonumber(oldest[2]) + period - now
+	end
+	local reset_after = 0
+	local newest = redis.call("ZRANGE", key, -1, -1, "WITHSCORES")
+	if newest[2] then
+		reset_after = tonumber(newest[2]) + period - now
+	end
+	return {0, math.max(limit - count, 0), retry_after, reset_after}
+end
+
+for i = 1, cost do
+	redis.call("ZADD", key, string.format("%d", now), string.format("%d-%d", now, count + i))
+end
+redis.call("PEXPIRE", key, math.ceil(period / 1000))
+
+return {cost, limit - count - cost, -1, period}`)
+)
+
+// BootRedisRateLimit named rate limit declared in boot.yaml
+type BootRedisRateLimit struct {
+	Name      string `yaml:"name" json:"name"`
+	Algorithm string `yaml:"algorithm" json:"algorithm"`
+	Rate      int    `yaml:"rate" json:"rate"`
+	Burst     int    `yaml:"burst" json:"burst"`
+	PeriodMs  int64  `yaml:"periodMs" json:"periodMs"`
+}
+
+// RateLimit allows Rate requests per Period.
+//
+// For GCRA, requests are spread evenly over Period and Burst requests are allowed at once, default burst is Rate.
+// For SlidingWindow, at most Rate requests are allowed in any window of Period, Burst is ignored.
+type RateLimit struct {
+	Algorithm string        `yaml:"algorithm" json:"algorithm"`
+	Rate      int           `yaml:"rate" json:"rate"`
+	Burst     int           `yaml:"burst" json:"burst"`
+	Period    time.Duration `yaml:"period" json:"period"`
+}
+
+// PerSecond returns GCRA limit of rate per second with burst of rate
+func PerSecond(rate int) *RateLimit {
+	return &RateLimit{Algorithm: GCRA, Rate: rate, Burst: rate, Period: time.Second}
+}
+
+// PerMinute returns GCRA limit of rate per minute with burst of rate
+func PerMinute(rate int) *RateLimit {
+	return &RateLimit{Algorithm: GCRA, Rate: rate, Burst: rate, Period: time.Minute}
+}
+
+// PerHour returns GCRA limit of rate per hour with burst of rate
+func PerHour(rate int) *RateLimit {
+	return &RateLimit{Algorithm: GCRA, Rate: rate, Burst: rate, Period: time.Hour}
+}
+
+// ToRateLimit convert BootRedisRateLimit to RateLimit, algorithm is GCRA and period is one second by default
+func ToRateLimit(config *BootRedisRateLimit) *RateLimit {
+	if config == nil {
+		return nil
+	}
+
+	limit := &RateLimit{
+		Algorithm: GCRA,
+		Rate:      config.Rate,
+		Burst:     config.Burst,
+		Period:    time.Duration(config.PeriodMs) * time.Millisecond,
+	}
+
+	switch strings.ToLower(config.Algorithm) {
+	case "", GCRA:
+	case strings.ToLower(SlidingWindow):
+		limit.Algorithm = SlidingWindow
+	default:
+		limit.Algorithm = config.Algorithm
+	}
+
+	if limit.Period <= 0 {
+		limit.Period = time.Second
+	}
+
+	if limit.Burst <= 0 {
+		limit.Burst = limit.Rate
+	}
+
+	return limit
+}
+
+// Validate checks algorithm, rate and period of limit
+func (limit *RateLimit) Validate() error {
+	if limit.Algorithm != GCRA && limit.Algorithm != SlidingWindow {
+		return fmt.Errorf("unknown rate limit algorithm [%s], should be one of %s and %s", limit.Algorithm, GCRA, SlidingWindow)
+	}
+
+	if limit.Rate <= 0 || limit.Period <= 0 {
+		return fmt.Errorf("rate and period of rate limit should be positive, rate:%d, period:%v", limit.Rate, limit.Period)
+	}
+
+	return nil
+}
+
+func (limit *RateLimit) String() string {
+	return fmt.Sprintf("%s:%d/%v(burst %d)", limit.Algorithm, limit.Rate, limit.Period, limit.Burst)
+}
+
+// RateLimitResult result of RateLimiter
+type RateLimitResult struct {
+	// Limit used
+	Limit *RateLimit
+	// Allowed number of requests, zero means denied
+	Allowed int
+	// Remaining requests could be allowed at once
+	Remaining int
+	// RetryAfter is the time until the request would be allowed, -1 if allowed or would never be allowed
+	RetryAfter time.Duration
+	// ResetAfter is the time until limit of key is reset to initial state
+	ResetAfter time.Duration
+}
+
+// SetHeaders sets X-RateLimit-Limit, X-RateLimit-Remaining, X-RateLimit-Reset and Retry-After if denied,
+// in seconds, it could be used by HTTP middlewares of rk-gin, rk-echo and so on.
+func (res *RateLimitResult) SetHeaders(header http.Header) {
+	limit := res.Limit.Rate
+	if res.Limit.Algorithm == GCRA {
+		limit = res.Limit.Burst
+	}
+
+	header.Set("X-RateLimit-Limit", strconv.Itoa(limit))
+	header.Set("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	header.Set("X-RateLimit-Reset", strconv.Itoa(int(math.Ceil(res.ResetAfter.Seconds()))))
+
+	if res.Allowed < 1 && res.RetryAfter > 0 {
+		header.Set("Retry-After", strconv.Itoa(int(math.Ceil(res.RetryAfter.Seconds()))))
+	}
+}
+
+// RateLimiter limits requests with Lua scripts executed atomically on client of RedisEntry,
+// single, failover and cluster clients are supported since each key is handled by one script.
+type RateLimiter struct {
+	entry *RedisEntry
+}
+
+// GetRateLimiter returns RateLimiter of entry, client is resolved at each call, so it could be created before Bootstrap
+func (entry *RedisEntry) GetRateLimiter() *RateLimiter {
+	return &RateLimiter{entry: entry}
+}
+
+// GetRateLimit returns rate limit declared with name
+func (entry *RedisEntry) GetRateLimit(name string) *RateLimit {
+	return entry.rateLimits[name]
+}
+
+// Allow is shorthand of AllowN(ctx, key, limit, 1)
+func (r *RateLimiter) Allow(ctx context.Context, key string, limit *RateLimit) (*RateLimitResult, error) {
+	return r.AllowN(ctx, key, limit, 1)
+}
+
+// AllowByName allows one request of key with rate limit declared with name,
+// key in redis would be composed as prefix + name + ":" + key.
+func (r *RateLimiter) AllowByName(ctx context.Context, name, key string) (*RateLimitResult, error) {
+	limit := r.entry.GetRateLimit(name)
+	if limit == nil {
+		return nil, fmt.Errorf("rate limit [%s] not found in entry [%s]", name, r.entry.GetName())
+	}
+
+	return r.AllowN(ctx, name+":"+key, limit, 1)
+}
+
+// AllowN allows n requests of key at once, key in redis would be composed as prefix + key, n should be positive.
+func (r *RateLimiter) AllowN(ctx context.Context, key string, limit *RateLimit, n int) (*RateLimitResult, error) {
+	if limit == nil {
+		return nil, fmt.Errorf("nil rate limit of key [%s]", key)
+	}
+
+	// negative n would mint capacity in scripts
+	if n <= 0 {
+		return nil, fmt.Errorf("n of key [%s] should be positive, got %d", key, n)
+	}
+
+	if err := limit.Validate(); err != nil {
+		return nil, err
+	}
+
+	if r.entry.Client == nil {
+		return nil, fmt.Errorf("redis client of entry [%s] is not initialized, please call Bootstrap first", r.entry.GetName())
+	}
+
+	var cmd *redis.Cmd
+	switch limit.Algorithm {
+	case SlidingWindow:
+		cmd = slidingWindowScript.Run(ctx, r.entry.Client, []string{r.key(key)},
+			limit.Rate, limit.Period.Microseconds(), n)
+	default:
+		burst := limit.Burst
+		if burst <= 0 {
+			burst = limit.Rate
+		}
+		cmd = gcraScript.Run(ctx, r.entry.Client, []string{r.key(key)},
+			burst, limit.Rate, limit.Period.Microseconds(), n)
+	}
+
+	values, err := cmd.Slice()
+	if err != nil {
+		return nil, err
+	}
+
+	return toRateLimitResult(limit, values)
+}
+
+// Reset removes state of key
+func (r *RateLimiter) Reset(ctx context.Context, key string) error {
+	if r.entry.Client == nil {
+		return fmt.Errorf("redis client of entry [%s] is not initialized, please call Bootstrap first", r.entry.GetName())
+	}
+
+	return r.entry.Client.Del(ctx, r.key(key)).Err()
+}
+
+// HTTPMiddleware returns net/http middleware which allows one request of key returned by keyFunc
+// with rate limit declared with name. 429 would be returned if denied, and request would be passed
+// if redis is unavailable.
+func (r *RateLimiter) HTTPMiddleware(name string, keyFunc func(*http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			res, err := r.AllowByName(req.Context(), name, keyFunc(req))
+			if err != nil {
+				r.entry.loggerEntry.Warn("Rate limit failed, request is passed", zap.String("limit", name), zap.Error(err))
+				next.ServeHTTP(w, req)
+				return
+			}
+
+			res.SetHeaders(w.Header())
+			if res.Allowed < 1 {
+				http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(w, req)
+		})
+	}
+}
+
+func (r *RateLimiter) key(key string) string {
+	return r.entry.rateLimitPrefix + key
+}
+
+func toRateLimitResult(limit *RateLimit, values []interface{}) (*RateLimitResult, error) {
+	if len(values) != 4 {
+		return nil, fmt.Errorf("unexpected rate limit reply %v", values)
+	}
+
+	ints := make([]int64, len(values))
+	for i := range values {
+		v, ok := values[i].(int64)
+		if !ok {
+			return nil, fmt.Errorf("unexpected rate limit reply %v", values)
+		}
+		ints[i] = v
+	}
+
+	return &RateLimitResult{
+		Limit:      limit,
+		Allowed:    int(ints[0]),
+		Remaining:  int(ints[1]),
+		RetryAfter: toDuration(ints[2]),
+		ResetAfter: toDuration(ints[3]),
+	}, nil
+}
+
+// toDuration converts microseconds returned by script, -1 means not applicable
+func toDuration(us int64) time.Duration {
+	if us < 0 {
+		return -1
+	}
+
+	return time.Duration(us) * time.Microsecond
+}
@@ -0,0 +1,230 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkredis
+
+import (
+	"context"
+	"github.com/rookie-ninja/rk-entry/v2/entry"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestToRateLimit(t *testing.T) {
+	// with nil
+	assert.Nil(t, ToRateLimit(nil))
+
+	// with defaults
+	limit := ToRateLimit(&BootRedisRateLimit{Rate: 10})
+	assert.Equal(t, &RateLimit{Algorithm: GCRA, Rate: 10, Burst: 10, Period: time.Second}, limit)
+	assert.Nil(t, limit.Validate())
+
+	// sliding window
+	limit = ToRateLimit(&BootRedisRateLimit{Algorithm: "slidingwindow", Rate: 10, PeriodMs: 60000})
+	assert.Equal(t, SlidingWindow, limit.Algorithm)
+	assert.Equal(t, time.Minute, limit.Period)
+
+	// invalid
+	assert.NotNil(t, (&RateLimit{Algorithm: "unknown", Rate: 1, Period: time.Second}).Validate())
+	assert.NotNil(t, (&RateLimit{Algorithm: GCRA, Period: time.Second}).Validate())
+}
+
+func TestRateLimiter_GCRA(t *testing.T) {
+	entry := newMemoryEntry(t)
+	server := entry.GetMemoryServer()
+	server.SetTime(time.Now())
+	limiter := entry.GetRateLimiter()
+
+	limit := &RateLimit{Algorithm: GCRA, Rate: 10, Burst: 2, Period: time.Second}
+
+	// burst
+	res, err := limiter.Allow(context.TODO(), "key", limit)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, res.Allowed)
+	assert.Equal(t, 1, res.Remaining)
+	assert.Equal(t, time.Duration(-1), res.RetryAfter)
+	assert.InDelta(t, 100*time.Millisecond, res.ResetAfter, float64(time.Millisecond))
+	assert.True(t, server.Exists("rk:rate:key"))
+
+	res, err = limiter.Allow(context.TODO(), "key", limit)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+
+	// denied
+	res, err = limiter.Allow(context.TODO(), "key", limit)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, res.Allowed)
+	assert.InDelta(t, 100*time.Millisecond, res.RetryAfter, float64(time.Millisecond))
+	assert.InDelta(t, 200*time.Millisecond, res.ResetAfter, float64(time.Millisecond))
+
+	// allowed after emission interval
+	server.SetTime(time.Now().Add(100 * time.Millisecond))
+	res, err = limiter.Allow(context.TODO(), "key", limit)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, res.Allowed)
+
+	// cost larger than burst
+	res, err = limiter.AllowN(context.TODO(), "other", limit, 3)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, res.Allowed)
+
+	// non-positive cost would not mint capacity
+	for _, n := range []int{0, -1} {
+		res, err = limiter.AllowN(context.TODO(), "key", limit, n)
+		assert.NotNil(t, err)
+		assert.Nil(t, res)
+	}
+	res, err = limiter.Allow(context.TODO(), "key", limit)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, res.Allowed)
+
+	// reset
+	assert.Nil(t, limiter.Reset(context.TODO(), "key"))
+	assert.False(t, server.Exists("rk:rate:key"))
+}
+
+func TestRateLimiter_SlidingWindow(t *testing.T) {
+	entry := newMemoryEntry(t)
+	server := entry.GetMemoryServer()
+	now := time.Now()
+	server.SetTime(now)
+	limiter := entry.GetRateLimiter()
+
+	limit := &RateLimit{Algorithm: SlidingWindow, Rate: 2, Period: time.Second}
+
+	res, err := limiter.Allow(context.TODO(), "key", limit)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, res.Allowed)
+	assert.Equal(t, 1, res.Remaining)
+
+	server.SetTime(now.Add(500 * time.Millisecond))
+	res, err = limiter.Allow(context.TODO(), "key", limit)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+
+	// denied until the oldest request is out of window
+	res, err = limiter.Allow(context.TODO(), "key", limit)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, res.Allowed)
+	assert.InDelta(t, 500*time.Millisecond, res.RetryAfter, float64(time.Millisecond))
+	assert.InDelta(t, time.Second, res.ResetAfter, float64(time.Millisecond))
+
+	server.SetTime(now.Add(1001 * time.Millisecond))
+	res, err = limiter.Allow(context.TODO(), "key", limit)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+
+	// cost larger than rate
+	res, err = limiter.AllowN(context.TODO(), "other", limit, 3)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, res.Allowed)
+	assert.Equal(t, time.Duration(-1), res.RetryAfter)
+}
+
+func TestRateLimiter_AllowByName(t *testing.T) {
+	limiter := RegisterRedisEntry(WithRateLimit("tenant", PerSecond(1))).GetRateLimiter()
+	defer rkentry.GlobalAppCtx.RemoveEntry(limiter.entry)
+
+	// not found
+	_, err := limiter.AllowByName(context.TODO(), "not-exist", "key")
+	assert.NotNil(t, err)
+
+	// not bootstrapped
+	_, err = limiter.AllowByName(context.TODO(), "tenant", "key")
+	assert.NotNil(t, err)
+
+	// happy case
+	entry := newMemoryEntry(t)
+	WithRateLimitPrefix("quota:")(entry)
+	WithRateLimit("tenant", PerMinute(1))(entry)
+	res, err := entry.GetRateLimiter().AllowByName(context.TODO(), "tenant", "rk")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, res.Allowed)
+	assert.True(t, entry.GetMemoryServer().Exists("quota:tenant:rk"))
+}
+
+func TestRateLimiter_HTTPMiddleware(t *testing.T) {
+	entry := newMemoryEntry(t)
+	WithRateLimit("tenant", PerHour(1))(entry)
+
+	handler := entry.GetRateLimiter().HTTPMiddleware("tenant", func(req *http.Request) string {
+		return req.Header.Get("X-Tenant")
+	})(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Tenant", "rk")
+
+	// allowed
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "1", w.Header().Get("X-RateLimit-Limit"))
+	assert.Equal(t, "0", w.Header().Get("X-RateLimit-Remaining"))
+
+	// denied
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "3600", w.Header().Get("Retry-After"))
+
+	// passed if limit not found
+	handler = entry.GetRateLimiter().HTTPMiddleware("not-exist", func(req *http.Request) string {
+		return ""
+	})(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestRegisterRedisEntryYAML_WithRateLimit(t *testing.T) {
+	bootConfigStr := `
+redis:
+  - name: ut-redis-rate-limit
+    enabled: true
+    addrs: ["localhost:6379"]
+    rateLimit:
+      prefix: "quota:"
+      limits:
+        - name: tenant
+          rate: 100
+          burst: 200
+          periodMs: 60000
+        - name: login
+          algorithm: slidingWindow
+          rate: 5
+`
+
+	entries := RegisterRedisEntryYAML([]byte(bootConfigStr))
+
+	entry := entries["ut-redis-rate-limit"].(*RedisEntry)
+	assert.Equal(t, "quota:", entry.rateLimitPrefix)
+	assert.Equal(t, &RateLimit{Algorithm: GCRA, Rate: 100, Burst: 200, Period: time.Minute}, entry.GetRateLimit("tenant"))
+	assert.Equal(t, &RateLimit{Algorithm: SlidingWindow, Rate: 5, Burst: 5, Period: time.Second}, entry.GetRateLimit("login"))
+
+	rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	// invalid limit
+	defer assertPanic(t)
+	RegisterRedisEntryYAML([]byte(`
+redis:
+  - name: ut-redis-rate-limit
+    enabled: true
+    rateLimit:
+      limits:
+        - name: tenant
+          algorithm: unknown
+          rate: 100
+`))
+}
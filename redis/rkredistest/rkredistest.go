@@ -0,0 +1,41 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+// Package rkredistest provides utilities for testing code based on rkredis.RedisEntry without redis server.
+//
+// RedisEntry is bootstrapped in memory mode which starts an embedded redis server, tracer is attached as usual,
+// so code based on rkredis.GetRedisEntry could be tested unchanged.
+//
+//	func TestGetUser(t *testing.T) {
+//		entry := rkredistest.NewEntry(t, rkredis.WithName("redis"))
+//
+//		entry.GetMemoryServer().Set("user:1", "rk")
+//
+//		user, err := GetUser(context.TODO(), "1")
+//		assert.Nil(t, err)
+//		assert.Equal(t, "rk", user)
+//	}
+package rkredistest
+
+import (
+	"context"
+	"github.com/rookie-ninja/rk-db/redis"
+	"github.com/rookie-ninja/rk-entry/v2/entry"
+	"testing"
+)
+
+// NewEntry registers and bootstraps rkredis.RedisEntry in memory mode.
+// Entry would be interrupted and removed from rkentry.GlobalAppCtx at cleanup of t.
+func NewEntry(t testing.TB, opts ...rkredis.Option) *rkredis.RedisEntry {
+	entry := rkredis.RegisterRedisEntry(append(opts, rkredis.WithMode("memory"))...)
+	entry.Bootstrap(context.Background())
+
+	t.Cleanup(func() {
+		entry.Interrupt(context.Background())
+		rkentry.GlobalAppCtx.RemoveEntry(entry)
+	})
+
+	return entry
+}
@@ -0,0 +1,47 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkredistest
+
+import (
+	"context"
+	"github.com/rookie-ninja/rk-db/redis"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestNewEntry(t *testing.T) {
+	t.Run("memory entry", func(t *testing.T) {
+		entry := NewEntry(t, rkredis.WithName("ut-redis-memory"), rkredis.WithDatabase("cache", 1))
+		assert.Equal(t, entry, rkredis.GetRedisEntry("ut-redis-memory"))
+		assert.True(t, entry.IsMemoryMode())
+
+		client, ok := entry.GetClient()
+		assert.True(t, ok)
+		assert.Nil(t, client.Set(context.TODO(), "key", "value", time.Second).Err())
+
+		server := entry.GetMemoryServer()
+		assert.NotNil(t, server)
+		value, err := server.Get("key")
+		assert.Nil(t, err)
+		assert.Equal(t, "value", value)
+
+		// expire key by fast forward
+		server.FastForward(2 * time.Second)
+		assert.False(t, server.Exists("key"))
+
+		// logical database
+		cache := entry.GetClientByName("cache")
+		assert.NotNil(t, cache)
+		assert.Nil(t, cache.Set(context.TODO(), "key", "cache", 0).Err())
+		server.Select(1)
+		value, _ = server.Get("key")
+		assert.Equal(t, "cache", value)
+	})
+
+	// removed at cleanup
+	assert.Nil(t, rkredis.GetRedisEntry("ut-redis-memory"))
+}
@@ -0,0 +1,125 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkredis
+
+import (
+	"context"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// scriptExt is the file extension of Lua scripts loaded from directory
+const scriptExt = ".lua"
+
+// GetScript returns script registered with name, nil if not found
+func (entry *RedisEntry) GetScript(name string) *redis.Script {
+	return entry.scripts[name]
+}
+
+// ListScripts returns names of registered scripts in order
+func (entry *RedisEntry) ListScripts() []string {
+	res := make([]string, 0, len(entry.scripts))
+	for name := range entry.scripts {
+		res = append(res, name)
+	}
+	sort.Strings(res)
+
+	return res
+}
+
+// RunScript runs script registered with name by EVALSHA, script would be sent with EVAL transparently
+// if it is missing on server, for example, after failover or SCRIPT FLUSH.
+func (entry *RedisEntry) RunScript(ctx context.Context, name string, keys []string, args ...interface{}) *redis.Cmd {
+	script := entry.GetScript(name)
+
+	var err error
+	switch {
+	case script == nil:
+		err = fmt.Errorf("script [%s] not found in entry [%s]", name, entry.entryName)
+	case entry.Client == nil:
+		err = fmt.Errorf("redis client of entry [%s] is not initialized, please call Bootstrap first", entry.entryName)
+	}
+
+	if err != nil {
+		cmd := redis.NewCmd(ctx)
+		cmd.SetErr(err)
+		return cmd
+	}
+
+	return script.Run(ctx, entry.Client, keys, args...)
+}
+
+// readScripts reads *.lua files in dir of fsys recursively, name of script is relative path without extension,
+// like rate/gcra for rate/gcra.lua.
+func readScripts(fsys fs.FS, dir string) (map[string]string, error) {
+	if len(dir) < 1 {
+		dir = "."
+	}
+	dir = path.Clean(filepath.ToSlash(dir))
+
+	res := make(map[string]string)
+	err := fs.WalkDir(fsys, dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() || path.Ext(p) != scriptExt {
+			return nil
+		}
+
+		src, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return err
+		}
+
+		name := strings.TrimSuffix(strings.TrimPrefix(p, dir+"/"), scriptExt)
+		if dir == "." {
+			name = strings.TrimSuffix(p, scriptExt)
+		}
+		res[name] = string(src)
+
+		return nil
+	})
+
+	return res, err
+}
+
+// loadScripts loads scripts into script cache of every node, including replicas of cluster and shards of ring
+func (entry *RedisEntry) loadScripts(ctx context.Context) error {
+	if len(entry.scripts) < 1 {
+		return nil
+	}
+
+	load := func(ctx context.Context, client *redis.Client) error {
+		for _, name := range entry.ListScripts() {
+			script := entry.scripts[name]
+			sha, err := script.Load(ctx, client).Result()
+			if err != nil {
+				return fmt.Errorf("load script [%s] into %s failed, %v", name, client.Options().Addr, err)
+			}
+			if sha != script.Hash() {
+				return fmt.Errorf("load script [%s] into %s failed, unexpected sha %s", name, client.Options().Addr, sha)
+			}
+		}
+		return nil
+	}
+
+	switch client := entry.Client.(type) {
+	case *redis.ClusterClient:
+		return client.ForEachShard(ctx, load)
+	case *redis.Ring:
+		return client.ForEachShard(ctx, load)
+	case *redis.Client:
+		return load(ctx, client)
+	}
+
+	return nil
+}
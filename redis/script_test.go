@@ -0,0 +1,98 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkredis
+
+import (
+	"context"
+	"github.com/rookie-ninja/rk-entry/v2/entry"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+var scriptFS = fstest.MapFS{
+	"scripts/get.lua":      {Data: []byte(`return redis.call("GET", KEYS[1])`)},
+	"scripts/rate/set.lua": {Data: []byte(`return redis.call("SET", KEYS[1], ARGV[1])`)},
+	"scripts/README.md":    {Data: []byte(`not a script`)},
+}
+
+func TestReadScripts(t *testing.T) {
+	// happy case
+	scripts, err := readScripts(scriptFS, "scripts/")
+	assert.Nil(t, err)
+	assert.Len(t, scripts, 2)
+	assert.Contains(t, scripts, "get")
+	assert.Contains(t, scripts, "rate/set")
+
+	// root directory
+	scripts, err = readScripts(scriptFS, "")
+	assert.Nil(t, err)
+	assert.Contains(t, scripts, "scripts/get")
+
+	// directory not exist
+	_, err = readScripts(scriptFS, "not-exist")
+	assert.NotNil(t, err)
+}
+
+func TestRedisEntry_RunScript(t *testing.T) {
+	entry := RegisterRedisEntry(
+		WithMode("memory"),
+		WithScriptFS(scriptFS, "scripts"),
+		WithScript("del", `return redis.call("DEL", KEYS[1])`))
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+	assert.Equal(t, []string{"del", "get", "rate/set"}, entry.ListScripts())
+
+	// not bootstrapped
+	assert.NotNil(t, entry.RunScript(context.TODO(), "get", []string{"key"}).Err())
+
+	entry.Bootstrap(context.TODO())
+	defer entry.Interrupt(context.TODO())
+
+	// loaded at Bootstrap
+	exists, err := entry.Client.ScriptExists(context.TODO(),
+		entry.GetScript("get").Hash(), entry.GetScript("rate/set").Hash()).Result()
+	assert.Nil(t, err)
+	assert.Equal(t, []bool{true, true}, exists)
+
+	// happy case
+	assert.Nil(t, entry.RunScript(context.TODO(), "rate/set", []string{"key"}, "value").Err())
+	assert.Equal(t, "value", entry.RunScript(context.TODO(), "get", []string{"key"}).Val())
+
+	// script is missing on server
+	assert.Nil(t, entry.Client.ScriptFlush(context.TODO()).Err())
+	assert.Equal(t, "value", entry.RunScript(context.TODO(), "get", []string{"key"}).Val())
+
+	// script not found
+	assert.NotNil(t, entry.RunScript(context.TODO(), "not-exist", []string{"key"}).Err())
+}
+
+func TestRegisterRedisEntryYAML_WithScripts(t *testing.T) {
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "get.lua"), []byte(`return redis.call("GET", KEYS[1])`), 0644))
+
+	bootConfigStr := `
+redis:
+  - name: ut-redis-scripts
+    enabled: true
+    addrs: ["localhost:6379"]
+    scripts: ` + dir
+
+	entries := RegisterRedisEntryYAML([]byte(bootConfigStr))
+	entry := entries["ut-redis-scripts"].(*RedisEntry)
+	assert.Equal(t, []string{"get"}, entry.ListScripts())
+	rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	// directory not exist
+	defer assertPanic(t)
+	RegisterRedisEntryYAML([]byte(`
+redis:
+  - name: ut-redis-scripts
+    enabled: true
+    scripts: not-exist
+`))
+}
@@ -0,0 +1,524 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkredis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"github.com/rookie-ninja/rk-entry/v2/middleware"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// streamTracePrefix is the prefix of message fields which carry trace context of producer
+	streamTracePrefix = "_rk_trace_"
+	// deadLetterSuffix is appended to stream name as default dead letter stream
+	deadLetterSuffix = ":dead"
+)
+
+// StreamHandler handles message of stream, message would be acknowledged only if nil returned,
+// otherwise, it stays pending and would be claimed again after StreamConsumer.ClaimMinIdle.
+type StreamHandler func(ctx context.Context, msg redis.XMessage) error
+
+// StreamConsumer declares a consumer of consumer group started by RedisEntry.Consume
+type StreamConsumer struct {
+	// Stream consumed, required
+	Stream string
+	// Group of consumer, created with MKSTREAM if missing, required
+	Group string
+	// Consumer name, default: <hostname>-<pid>
+	Consumer string
+	// Handler of messages, required
+	Handler StreamHandler
+	// Concurrency number of handlers, default: 1
+	Concurrency int
+	// BatchSize max messages read at once, default: Concurrency
+	BatchSize int64
+	// Block duration of XREADGROUP, graceful stop waits at most Block, default: 5 seconds
+	Block time.Duration
+	// StartID of group while creating, default: 0, which consumes existing messages
+	StartID string
+	// ClaimMinIdle pending messages idle longer than it would be claimed by XAUTOCLAIM, negative disables claim,
+	// default: 1 minute
+	ClaimMinIdle time.Duration
+	// ClaimInterval interval of XAUTOCLAIM, default: ClaimMinIdle
+	ClaimInterval time.Duration
+	// MaxDeliveries claimed messages delivered more than it would be moved to dead letter stream,
+	// zero disables dead letter
+	MaxDeliveries int64
+	// DeadLetterStream default: <stream>:dead
+	DeadLetterStream string
+}
+
+// AddStreamMessage adds message to stream with XADD, trace context of ctx would be injected into message,
+// so that span of consumer would be linked to producer. Values should be map or slice of field value pairs.
+func (entry *RedisEntry) AddStreamMessage(ctx context.Context, args *redis.XAddArgs) (string, error) {
+	if entry.Client == nil {
+		return "", fmt.Errorf("redis client of entry [%s] is not initialized, please call Bootstrap first", entry.entryName)
+	}
+
+	ctx, span := getTracer(ctx).Start(ctx, "redis.stream.produce", trace.WithSpanKind(trace.SpanKindProducer))
+	span.SetAttributes(
+		attribute.String("db.system", "redis"),
+		attribute.String("messaging.system", "redis"),
+		attribute.String("messaging.destination", args.Stream),
+	)
+	defer span.End()
+
+	values, err := toStreamValues(args.Values)
+	if err != nil {
+		recordError(ctx, span, err)
+		return "", err
+	}
+	getPropagator(ctx).Inject(ctx, streamCarrier(values))
+
+	copied := *args
+	copied.Values = values
+
+	id, err := entry.Client.XAdd(ctx, &copied).Result()
+	if err != nil {
+		recordError(ctx, span, err)
+		return "", err
+	}
+	span.SetAttributes(attribute.String("messaging.message_id", id))
+
+	return id, nil
+}
+
+// Consume starts consumer of group in background until ctx done or entry interrupted.
+//
+// Messages are acknowledged after handled successfully. Pending messages idle longer than ClaimMinIdle are claimed
+// with XAUTOCLAIM, and moved to dead letter stream if delivered more than MaxDeliveries.
+// In-flight messages would be finished at Interrupt with ctx.
+func (entry *RedisEntry) Consume(ctx context.Context, consumer *StreamConsumer) error {
+	if err := validateStreamConsumer(consumer); err != nil {
+		return err
+	}
+
+	if entry.Client == nil {
+		return fmt.Errorf("redis client of entry [%s] is not initialized, please call Bootstrap first", entry.entryName)
+	}
+
+	entry.streamMutex.Lock()
+	defer entry.streamMutex.Unlock()
+
+	if entry.streamStopped {
+		return fmt.Errorf("entry [%s] is interrupted", entry.entryName)
+	}
+
+	c := withStreamConsumerDefaults(consumer)
+
+	stopCtx, cancel := context.WithCancel(ctx)
+	entry.streamCancels = append(entry.streamCancels, cancel)
+
+	entry.streamWg.Add(1)
+	go entry.runStreamConsumer(ctx, stopCtx, c)
+
+	return nil
+}
+
+// validateStreamConsumer checks required fields of StreamConsumer
+func validateStreamConsumer(consumer *StreamConsumer) error {
+	if consumer == nil {
+		return errors.New("nil stream consumer")
+	}
+
+	if len(consumer.Stream) < 1 || len(consumer.Group) < 1 {
+		return errors.New("stream and group of stream consumer are required")
+	}
+
+	if consumer.Handler == nil {
+		return fmt.Errorf("handler of stream consumer [%s/%s] is required", consumer.Stream, consumer.Group)
+	}
+
+	return nil
+}
+
+// withStreamConsumerDefaults returns copy of consumer with defaults
+func withStreamConsumerDefaults(consumer *StreamConsumer) *StreamConsumer {
+	c := *consumer
+
+	if len(c.Consumer) < 1 {
+		hostname, _ := os.Hostname()
+		c.Consumer = fmt.Sprintf("%s-%d", hostname, os.Getpid())
+	}
+
+	if c.Concurrency < 1 {
+		c.Concurrency = 1
+	}
+
+	if c.BatchSize < 1 {
+		c.BatchSize = int64(c.Concurrency)
+	}
+
+	if c.Block <= 0 {
+		c.Block = 5 * time.Second
+	}
+
+	if len(c.StartID) < 1 {
+		c.StartID = "0"
+	}
+
+	if c.ClaimMinIdle == 0 {
+		c.ClaimMinIdle = time.Minute
+	}
+
+	if c.ClaimInterval <= 0 {
+		c.ClaimInterval = c.ClaimMinIdle
+	}
+
+	if len(c.DeadLetterStream) < 1 {
+		c.DeadLetterStream = c.Stream + deadLetterSuffix
+	}
+
+	return &c
+}
+
+// stopStreamConsumers cancels all consumers and waits for in-flight messages, called at Interrupt
+func (entry *RedisEntry) stopStreamConsumers() {
+	entry.streamMutex.Lock()
+	entry.streamStopped = true
+	for i := range entry.streamCancels {
+		entry.streamCancels[i]()
+	}
+	entry.streamCancels = nil
+	entry.streamMutex.Unlock()
+
+	entry.streamWg.Wait()
+}
+
+// runStreamConsumer reads and claims messages until stopCtx done, messages are handled with ctx,
+// so that in-flight messages would not be canceled by Interrupt.
+func (entry *RedisEntry) runStreamConsumer(ctx, stopCtx context.Context, c *StreamConsumer) {
+	defer entry.streamWg.Done()
+
+	fields := []zap.Field{
+		zap.String("entryName", entry.entryName),
+		zap.String("stream", c.Stream),
+		zap.String("group", c.Group),
+		zap.String("consumer", c.Consumer),
+	}
+
+	entry.loggerEntry.Info("Starting stream consumer", fields...)
+
+	jobs := make(chan redis.XMessage)
+
+	workers := sync.WaitGroup{}
+	for i := 0; i < c.Concurrency; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for msg := range jobs {
+				entry.handleStreamMessage(ctx, c, msg)
+			}
+		}()
+	}
+
+	claimer := sync.WaitGroup{}
+	if c.ClaimMinIdle > 0 {
+		claimer.Add(1)
+		go func() {
+			defer claimer.Done()
+			entry.claimStreamMessages(stopCtx, c, jobs)
+		}()
+	}
+
+	entry.readStreamMessages(stopCtx, c, jobs)
+
+	claimer.Wait()
+	close(jobs)
+	workers.Wait()
+
+	entry.loggerEntry.Info("Stopping stream consumer", fields...)
+}
+
+// readStreamMessages reads new messages with XREADGROUP and dispatches them until stopCtx done
+func (entry *RedisEntry) readStreamMessages(stopCtx context.Context, c *StreamConsumer, jobs chan<- redis.XMessage) {
+	groupCreated := false
+	attempt := 0
+
+	for stopCtx.Err() == nil {
+		var err error
+		if !groupCreated {
+			err = entry.createStreamGroup(stopCtx, c)
+			groupCreated = err == nil
+		}
+
+		var streams []redis.XStream
+		if err == nil {
+			streams, err = entry.Client.XReadGroup(stopCtx, &redis.XReadGroupArgs{
+				Group:    c.Group,
+				Consumer: c.Consumer,
+				Streams:  []string{c.Stream, ">"},
+				Count:    c.BatchSize,
+				Block:    c.Block,
+			}).Result()
+		}
+
+		if err != nil && !errors.Is(err, redis.Nil) {
+			if stopCtx.Err() != nil {
+				return
+			}
+
+			// stream or group deleted
+			if strings.HasPrefix(err.Error(), "NOGROUP") {
+				groupCreated = false
+			}
+
+			attempt++
+			backoff := expBackoff(10*time.Millisecond, c.Block, attempt)
+			entry.loggerEntry.Warn("Reading stream failed",
+				zap.String("stream", c.Stream), zap.String("group", c.Group), zap.Duration("backoff", backoff), zap.Error(err))
+
+			select {
+			case <-stopCtx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			continue
+		}
+		attempt = 0
+
+		for _, stream := range streams {
+			for _, msg := range stream.Messages {
+				select {
+				case jobs <- msg:
+				case <-stopCtx.Done():
+					return
+				}
+			}
+		}
+	}
+}
+
+// claimStreamMessages claims idle pending messages with XAUTOCLAIM every ClaimInterval until stopCtx done
+func (entry *RedisEntry) claimStreamMessages(stopCtx context.Context, c *StreamConsumer, jobs chan<- redis.XMessage) {
+	ticker := time.NewTicker(c.ClaimInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopCtx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		start := "0-0"
+		for {
+			msgs, next, err := entry.Client.XAutoClaim(stopCtx, &redis.XAutoClaimArgs{
+				Stream:   c.Stream,
+				Group:    c.Group,
+				Consumer: c.Consumer,
+				MinIdle:  c.ClaimMinIdle,
+				Start:    start,
+				Count:    c.BatchSize,
+			}).Result()
+			if err != nil {
+				if stopCtx.Err() == nil && !strings.HasPrefix(err.Error(), "NOGROUP") {
+					entry.loggerEntry.Warn("Claiming stream messages failed",
+						zap.String("stream", c.Stream), zap.String("group", c.Group), zap.Error(err))
+				}
+				break
+			}
+
+			for _, msg := range msgs {
+				if c.MaxDeliveries > 0 && entry.deadLetterStreamMessage(stopCtx, c, msg) {
+					continue
+				}
+
+				select {
+				case jobs <- msg:
+				case <-stopCtx.Done():
+					return
+				}
+			}
+
+			if len(msgs) < 1 || next == "0-0" {
+				break
+			}
+			start = next
+		}
+	}
+}
+
+// deadLetterStreamMessage moves message to dead letter stream and acknowledges it
+// if delivered more than MaxDeliveries, returns true if moved.
+func (entry *RedisEntry) deadLetterStreamMessage(ctx context.Context, c *StreamConsumer, msg redis.XMessage) bool {
+	pending, err := entry.Client.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: c.Stream,
+		Group:  c.Group,
+		Start:  msg.ID,
+		End:    msg.ID,
+		Count:  1,
+	}).Result()
+	if err != nil || len(pending) < 1 || pending[0].RetryCount <= c.MaxDeliveries {
+		return false
+	}
+
+	values := make(map[string]interface{}, len(msg.Values)+4)
+	for k, v := range msg.Values {
+		values[k] = v
+	}
+	values["_rk_stream"] = c.Stream
+	values["_rk_group"] = c.Group
+	values["_rk_id"] = msg.ID
+	values["_rk_deliveries"] = pending[0].RetryCount
+
+	if err := entry.Client.XAdd(ctx, &redis.XAddArgs{Stream: c.DeadLetterStream, Values: values}).Err(); err != nil {
+		entry.loggerEntry.Warn("Moving stream message to dead letter stream failed",
+			zap.String("stream", c.Stream), zap.String("id", msg.ID), zap.Error(err))
+		return false
+	}
+
+	if err := entry.Client.XAck(ctx, c.Stream, c.Group, msg.ID).Err(); err != nil {
+		entry.loggerEntry.Warn("Acknowledging dead stream message failed",
+			zap.String("stream", c.Stream), zap.String("id", msg.ID), zap.Error(err))
+	}
+
+	entry.loggerEntry.Warn("Moved stream message to dead letter stream",
+		zap.String("stream", c.Stream),
+		zap.String("group", c.Group),
+		zap.String("id", msg.ID),
+		zap.String("deadLetterStream", c.DeadLetterStream),
+		zap.Int64("deliveries", pending[0].RetryCount))
+
+	return true
+}
+
+// handleStreamMessage handles message with span linked to producer and acknowledges it on success
+func (entry *RedisEntry) handleStreamMessage(ctx context.Context, c *StreamConsumer, msg redis.XMessage) {
+	producerCtx := getPropagator(ctx).Extract(context.Background(), streamCarrier(msg.Values))
+	msg.Values = stripTraceValues(msg.Values)
+
+	ctx, span := getTracer(ctx).Start(ctx, "redis.stream.consume",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithLinks(trace.LinkFromContext(producerCtx)))
+	span.SetAttributes(
+		attribute.String("db.system", "redis"),
+		attribute.String("messaging.system", "redis"),
+		attribute.String("messaging.destination", c.Stream),
+		attribute.String("messaging.message_id", msg.ID),
+		attribute.String("messaging.redis.group", c.Group),
+		attribute.String("messaging.redis.consumer", c.Consumer),
+	)
+	defer span.End()
+
+	if err := c.Handler(ctx, msg); err != nil {
+		recordError(ctx, span, err)
+		entry.loggerEntry.Warn("Handling stream message failed",
+			zap.String("stream", c.Stream), zap.String("group", c.Group), zap.String("id", msg.ID), zap.Error(err))
+		return
+	}
+
+	if err := entry.Client.XAck(ctx, c.Stream, c.Group, msg.ID).Err(); err != nil {
+		recordError(ctx, span, err)
+		entry.loggerEntry.Warn("Acknowledging stream message failed",
+			zap.String("stream", c.Stream), zap.String("group", c.Group), zap.String("id", msg.ID), zap.Error(err))
+	}
+}
+
+// createStreamGroup creates group with MKSTREAM, existing group is ignored
+func (entry *RedisEntry) createStreamGroup(ctx context.Context, c *StreamConsumer) error {
+	err := entry.Client.XGroupCreateMkStream(ctx, c.Stream, c.Group, c.StartID).Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+
+	return nil
+}
+
+// toStreamValues copies values of XAddArgs into map
+func toStreamValues(values interface{}) (map[string]interface{}, error) {
+	res := make(map[string]interface{})
+
+	switch v := values.(type) {
+	case nil:
+	case map[string]interface{}:
+		for k := range v {
+			res[k] = v[k]
+		}
+	case map[string]string:
+		for k := range v {
+			res[k] = v[k]
+		}
+	case []string:
+		if len(v)%2 != 0 {
+			return nil, errors.New("values of stream message should be field value pairs")
+		}
+		for i := 0; i < len(v); i += 2 {
+			res[v[i]] = v[i+1]
+		}
+	case []interface{}:
+		if len(v)%2 != 0 {
+			return nil, errors.New("values of stream message should be field value pairs")
+		}
+		for i := 0; i < len(v); i += 2 {
+			res[fmt.Sprint(v[i])] = v[i+1]
+		}
+	default:
+		return nil, fmt.Errorf("unsupported values of stream message %T", values)
+	}
+
+	return res, nil
+}
+
+// stripTraceValues removes trace fields injected by producer
+func stripTraceValues(values map[string]interface{}) map[string]interface{} {
+	res := make(map[string]interface{}, len(values))
+	for k, v := range values {
+		if !strings.HasPrefix(k, streamTracePrefix) {
+			res[k] = v
+		}
+	}
+
+	return res
+}
+
+// streamCarrier carries trace context in fields of stream message
+type streamCarrier map[string]interface{}
+
+func (c streamCarrier) Get(key string) string {
+	if v, ok := c[streamTracePrefix+key].(string); ok {
+		return v
+	}
+
+	return ""
+}
+
+func (c streamCarrier) Set(key, value string) {
+	c[streamTracePrefix+key] = value
+}
+
+func (c streamCarrier) Keys() []string {
+	res := make([]string, 0)
+	for k := range c {
+		if strings.HasPrefix(k, streamTracePrefix) {
+			res = append(res, strings.TrimPrefix(k, streamTracePrefix))
+		}
+	}
+
+	return res
+}
+
+// getPropagator returns propagator of tracing middleware in context, W3C trace context by default
+func getPropagator(ctx context.Context) propagation.TextMapPropagator {
+	if v := ctx.Value(rkmid.PropagatorKey); v != nil {
+		if res, ok := v.(propagation.TextMapPropagator); ok {
+			return res
+		}
+	}
+
+	return propagation.TraceContext{}
+}
@@ -0,0 +1,188 @@
+// Copyright (c) 2021 rookie-ninja
+//
+// Use of this source code is governed by an Apache-style
+// license that can be found in the LICENSE file.
+
+package rkredis
+
+import (
+	"context"
+	"errors"
+	"github.com/redis/go-redis/v9"
+	"github.com/rookie-ninja/rk-entry/v2/entry"
+	"github.com/rookie-ninja/rk-entry/v2/middleware"
+	"github.com/stretchr/testify/assert"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestToStreamValues(t *testing.T) {
+	// nil
+	values, err := toStreamValues(nil)
+	assert.Nil(t, err)
+	assert.Empty(t, values)
+
+	// map
+	values, err = toStreamValues(map[string]interface{}{"k": "v"})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"k": "v"}, values)
+
+	// pairs
+	values, err = toStreamValues([]string{"k", "v"})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"k": "v"}, values)
+	values, err = toStreamValues([]interface{}{"k", 1})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"k": 1}, values)
+
+	// invalid
+	_, err = toStreamValues([]string{"k"})
+	assert.NotNil(t, err)
+	_, err = toStreamValues(1)
+	assert.NotNil(t, err)
+}
+
+func TestStreamCarrier(t *testing.T) {
+	carrier := streamCarrier{"k": "v"}
+	carrier.Set("traceparent", "value")
+	assert.Equal(t, "value", carrier.Get("traceparent"))
+	assert.Equal(t, []string{"traceparent"}, carrier.Keys())
+	assert.Equal(t, map[string]interface{}{"k": "v"}, stripTraceValues(carrier))
+}
+
+func TestWithStreamConsumerDefaults(t *testing.T) {
+	c := withStreamConsumerDefaults(&StreamConsumer{Stream: "jobs", Group: "workers", Concurrency: 4})
+	assert.NotEmpty(t, c.Consumer)
+	assert.Equal(t, int64(4), c.BatchSize)
+	assert.Equal(t, 5*time.Second, c.Block)
+	assert.Equal(t, "0", c.StartID)
+	assert.Equal(t, time.Minute, c.ClaimMinIdle)
+	assert.Equal(t, time.Minute, c.ClaimInterval)
+	assert.Equal(t, "jobs:dead", c.DeadLetterStream)
+}
+
+func TestRedisEntry_Consume(t *testing.T) {
+	entry := RegisterRedisEntry()
+	defer rkentry.GlobalAppCtx.RemoveEntry(entry)
+
+	handler := func(ctx context.Context, msg redis.XMessage) error { return nil }
+
+	// invalid consumer
+	assert.NotNil(t, entry.Consume(context.TODO(), nil))
+	assert.NotNil(t, entry.Consume(context.TODO(), &StreamConsumer{Group: "workers", Handler: handler}))
+	assert.NotNil(t, entry.Consume(context.TODO(), &StreamConsumer{Stream: "jobs", Group: "workers"}))
+
+	// not bootstrapped
+	assert.NotNil(t, entry.Consume(context.TODO(), &StreamConsumer{Stream: "jobs", Group: "workers", Handler: handler}))
+	_, err := entry.AddStreamMessage(context.TODO(), &redis.XAddArgs{Stream: "jobs"})
+	assert.NotNil(t, err)
+
+	// interrupted
+	entry = newMemoryEntry(t)
+	entry.Interrupt(context.TODO())
+	assert.NotNil(t, entry.Consume(context.TODO(), &StreamConsumer{Stream: "jobs", Group: "workers", Handler: handler}))
+}
+
+func TestRedisEntry_ConsumeWithTrace(t *testing.T) {
+	entry := newMemoryEntry(t)
+
+	recorder := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("ut")
+	ctx := context.WithValue(context.TODO(), rkmid.TracerKey, tracer)
+
+	// producer
+	id, err := entry.AddStreamMessage(ctx, &redis.XAddArgs{Stream: "jobs", Values: []string{"job", "1"}})
+	assert.Nil(t, err)
+
+	received := make(chan redis.XMessage, 1)
+	assert.Nil(t, entry.Consume(ctx, &StreamConsumer{
+		Stream:   "jobs",
+		Group:    "workers",
+		Consumer: "ut",
+		Block:    10 * time.Millisecond,
+		Handler: func(ctx context.Context, msg redis.XMessage) error {
+			received <- msg
+			return nil
+		},
+	}))
+
+	select {
+	case msg := <-received:
+		assert.Equal(t, id, msg.ID)
+		assert.Equal(t, map[string]interface{}{"job": "1"}, msg.Values)
+	case <-time.After(time.Second):
+		assert.Fail(t, "message not received")
+	}
+
+	// acknowledged
+	assert.Eventually(t, func() bool {
+		pending, _ := entry.Client.XPending(context.TODO(), "jobs", "workers").Result()
+		return pending != nil && pending.Count == 0
+	}, time.Second, 10*time.Millisecond)
+
+	entry.Interrupt(context.TODO())
+
+	// consumer span is linked to producer span
+	spans := recorder.Ended()
+	var producer, consumer sdktrace.ReadOnlySpan
+	for _, span := range spans {
+		switch span.Name() {
+		case "redis.stream.produce":
+			producer = span
+		case "redis.stream.consume":
+			consumer = span
+		}
+	}
+	assert.NotNil(t, producer)
+	assert.NotNil(t, consumer)
+	assert.Len(t, consumer.Links(), 1)
+	assert.Equal(t, producer.SpanContext().SpanID(), consumer.Links()[0].SpanContext.SpanID())
+}
+
+func TestRedisEntry_ConsumeWithDeadLetter(t *testing.T) {
+	entry := newMemoryEntry(t)
+
+	first, err := entry.AddStreamMessage(context.TODO(), &redis.XAddArgs{Stream: "jobs", Values: []string{"job", "1"}})
+	assert.Nil(t, err)
+	_, err = entry.AddStreamMessage(context.TODO(), &redis.XAddArgs{Stream: "jobs", Values: []string{"job", "2"}})
+	assert.Nil(t, err)
+
+	// the first message always fails
+	var failed int32
+	assert.Nil(t, entry.Consume(context.TODO(), &StreamConsumer{
+		Stream:        "jobs",
+		Group:         "workers",
+		Concurrency:   2,
+		Block:         10 * time.Millisecond,
+		ClaimMinIdle:  time.Millisecond,
+		ClaimInterval: 10 * time.Millisecond,
+		MaxDeliveries: 2,
+		Handler: func(ctx context.Context, msg redis.XMessage) error {
+			if msg.ID == first {
+				atomic.AddInt32(&failed, 1)
+				return errors.New("ut error")
+			}
+			return nil
+		},
+	}))
+
+	// moved to dead letter stream after two failed deliveries
+	assert.Eventually(t, func() bool {
+		return entry.Client.XLen(context.TODO(), "jobs:dead").Val() == 1
+	}, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&failed))
+
+	dead := entry.Client.XRange(context.TODO(), "jobs:dead", "-", "+").Val()
+	assert.Equal(t, "1", dead[0].Values["job"])
+	assert.Equal(t, "jobs", dead[0].Values["_rk_stream"])
+	assert.Equal(t, "3", dead[0].Values["_rk_deliveries"])
+
+	// nothing pending
+	assert.Eventually(t, func() bool {
+		pending, _ := entry.Client.XPending(context.TODO(), "jobs", "workers").Result()
+		return pending != nil && pending.Count == 0
+	}, time.Second, 10*time.Millisecond)
+}
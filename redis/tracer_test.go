@@ -4,6 +4,7 @@ import (
 	"context"
 	"github.com/redis/go-redis/v9"
 	"github.com/stretchr/testify/assert"
+	"net"
 	"testing"
 )
 
@@ -11,25 +12,34 @@ func TestNewRedisTracer(t *testing.T) {
 	assert.NotNil(t, NewRedisTracer())
 }
 
-func TestRedisTracer_BeforeProcess(t *testing.T) {
+func TestRedisTracer_DialHook(t *testing.T) {
 	tracer := NewRedisTracer()
 
-	ctx, err := tracer.BeforeProcess(context.TODO(), redis.NewStringCmd(context.TODO()))
-	assert.NotNil(t, ctx)
+	hook := tracer.DialHook(func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return nil, nil
+	})
+
+	conn, err := hook(context.TODO(), "tcp", "localhost:6379")
+	assert.Nil(t, conn)
 	assert.Nil(t, err)
 }
 
-func TestRedisTracer_AfterProcess(t *testing.T) {
+func TestRedisTracer_ProcessHook(t *testing.T) {
 	tracer := NewRedisTracer()
 
-	err := tracer.AfterProcess(context.TODO(), redis.NewStringCmd(context.TODO()))
-	assert.Nil(t, err)
+	hook := tracer.ProcessHook(func(ctx context.Context, cmd redis.Cmder) error {
+		return nil
+	})
+
+	assert.Nil(t, hook(context.TODO(), redis.NewStringCmd(context.TODO())))
 }
 
-func TestRedisTracer_AfterProcessPipeline(t *testing.T) {
+func TestRedisTracer_ProcessPipelineHook(t *testing.T) {
 	tracer := NewRedisTracer()
 
-	ctx, err := tracer.BeforeProcessPipeline(context.TODO(), []redis.Cmder{redis.NewStringCmd(context.TODO())})
-	assert.NotNil(t, ctx)
-	assert.Nil(t, err)
+	hook := tracer.ProcessPipelineHook(func(ctx context.Context, cmds []redis.Cmder) error {
+		return nil
+	})
+
+	assert.Nil(t, hook(context.TODO(), []redis.Cmder{redis.NewStringCmd(context.TODO())}))
 }
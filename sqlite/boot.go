@@ -51,7 +51,8 @@ type BootSqliteE struct {
 		Params   []string `yaml:"params" json:"params"`
 		DryRun   bool     `yaml:"dryRun" json:"dryRun"`
 		Plugins  struct {
-			Prom plugins.PromConfig `yaml:"prom"`
+			Prom  plugins.PromConfig  `yaml:"prom"`
+			Cache plugins.CacheConfig `yaml:"cache"`
 		} `yaml:"plugins" json:"plugins"`
 	} `yaml:"database" json:"database"`
 	Logger struct {
@@ -261,6 +262,20 @@ func RegisterSqliteEntryYAML(raw []byte) map[string]rkentry.Entry {
 				prom := plugins.NewProm(&db.Plugins.Prom)
 				opts = append(opts, WithPlugin(db.Name, prom))
 			}
+			if db.Plugins.Cache.Enabled {
+				if len(db.Plugins.Cache.RedisEntry) < 1 {
+					rkentry.ShutdownWithError(fmt.Errorf("redisEntry of cache plugin is required, database:%s", db.Name))
+				}
+				if db.InMemory {
+					db.Plugins.Cache.DbAddr = "inMemory"
+				} else {
+					db.Plugins.Cache.DbAddr = db.DbDir
+				}
+				db.Plugins.Cache.DbName = db.Name
+				db.Plugins.Cache.DbType = "sqlite"
+				cache := plugins.NewCache(&db.Plugins.Cache)
+				opts = append(opts, WithPlugin(db.Name, cache))
+			}
 		}
 
 		entry := RegisterSqliteEntry(opts...)
@@ -0,0 +1,265 @@
+package plugins
+
+import (
+	"context"
+	"errors"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type cacheUser struct {
+	ID   uint `gorm:"primaryKey"`
+	Name string
+}
+
+func newCacheDB(t *testing.T, conf *CacheConfig) (*gorm.DB, *miniredis.Miniredis, *Prom) {
+	server := miniredis.RunT(t)
+	conf.Client = redis.NewClient(&redis.Options{Addr: server.Addr()})
+
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard})
+	assert.Nil(t, err)
+	assert.Nil(t, db.AutoMigrate(&cacheUser{}))
+
+	prom := NewProm(&PromConfig{Enabled: true, DbName: t.Name(), DbType: "sqlite"})
+	assert.Nil(t, db.Use(prom))
+	assert.Nil(t, db.Use(NewCache(conf)))
+
+	t.Cleanup(func() {
+		prom.MetricsSet.UnRegisterCounter("rowsAffected")
+		prom.MetricsSet.UnRegisterCounter("error")
+		prom.MetricsSet.UnRegisterCounter("cacheHit")
+		prom.MetricsSet.UnRegisterCounter("cacheMiss")
+		prom.MetricsSet.UnRegisterSummary("elapsedNano")
+	})
+
+	return db, server, prom
+}
+
+func TestNewCache(t *testing.T) {
+	cache := NewCache(&CacheConfig{
+		DbName: "ut",
+		TtlMs:  1000,
+		Tables: []*CacheTableConfig{{Name: "users", TtlMs: 5000}},
+	})
+
+	assert.Equal(t, "rk:gorm:ut:", cache.prefix)
+	assert.Equal(t, time.Second, cache.TTL("orders"))
+	assert.Equal(t, 5*time.Second, cache.TTL("users"))
+	assert.Equal(t, time.Minute, NewCache(&CacheConfig{}).TTL("users"))
+
+	// spaces of SQL are normalized
+	assert.Equal(t,
+		cache.queryKey("users", "", "SELECT *  FROM users\n WHERE id = ?", []interface{}{1}),
+		cache.queryKey("users", "0", "SELECT * FROM users WHERE id = ?", []interface{}{1}))
+	assert.NotEqual(t,
+		cache.queryKey("users", "0", "SELECT * FROM users WHERE id = ?", []interface{}{1}),
+		cache.queryKey("users", "0", "SELECT * FROM users WHERE id = ?", []interface{}{2}))
+}
+
+func TestCache_Query(t *testing.T) {
+	db, server, prom := newCacheDB(t, &CacheConfig{
+		Tables: []*CacheTableConfig{{Name: "cache_users", TtlMs: 5000}},
+	})
+	assert.Nil(t, db.Create(&cacheUser{ID: 1, Name: "ut"}).Error)
+
+	hit := prom.MetricsSet.GetCounterWithValues("cacheHit", t.Name(), "", "cache_users", "query")
+	miss := prom.MetricsSet.GetCounterWithValues("cacheMiss", t.Name(), "", "cache_users", "query")
+
+	// not enabled
+	users := make([]*cacheUser, 0)
+	assert.Nil(t, db.Find(&users).Error)
+	assert.Equal(t, []string{"rk:gorm::cache_users:version"}, server.Keys())
+
+	// enabled by scope, cached at the first time
+	users = make([]*cacheUser, 0)
+	assert.Nil(t, db.Scopes(QueryCache).Find(&users).Error)
+	assert.Len(t, users, 1)
+	assert.Len(t, server.Keys(), 2)
+	assert.Equal(t, 5*time.Second, server.TTL(server.Keys()[0]))
+	assert.Equal(t, float64(1), testutil.ToFloat64(miss))
+
+	// served by cache even if table changed with Exec, which is never invalidated
+	assert.Nil(t, db.Exec("UPDATE cache_users SET name = ?", "raw").Error)
+	ctx := WithQueryCache(context.TODO())
+	assert.Nil(t, db.WithContext(ctx).Where("id = ?", 1).First(&cacheUser{}).Error)
+	user := &cacheUser{}
+	assert.Nil(t, db.WithContext(ctx).Where("id  =  ?", 1).First(user).Error)
+	assert.Equal(t, "raw", user.Name)
+	assert.Equal(t, float64(1), testutil.ToFloat64(hit))
+
+	users = make([]*cacheUser, 0)
+	assert.Nil(t, db.WithContext(ctx).Find(&users).Error)
+	assert.Equal(t, "ut", users[0].Name)
+	assert.Equal(t, float64(2), testutil.ToFloat64(hit))
+
+	// invalidated by update
+	assert.Nil(t, db.Model(&cacheUser{}).Where("id = ?", 1).Update("name", "updated").Error)
+	users = make([]*cacheUser, 0)
+	assert.Nil(t, db.WithContext(ctx).Find(&users).Error)
+	assert.Equal(t, "updated", users[0].Name)
+
+	// not found is not cached
+	assert.Equal(t, gorm.ErrRecordNotFound, db.WithContext(ctx).Where("id = ?", 2).First(&cacheUser{}).Error)
+	assert.Nil(t, db.Create(&cacheUser{ID: 2, Name: "created"}).Error)
+	user = &cacheUser{}
+	assert.Nil(t, db.WithContext(ctx).Where("id = ?", 2).First(user).Error)
+	assert.Equal(t, "created", user.Name)
+}
+
+func TestCache_QueryWithoutRedis(t *testing.T) {
+	db, server, _ := newCacheDB(t, &CacheConfig{})
+	assert.Nil(t, db.Create(&cacheUser{ID: 1, Name: "ut"}).Error)
+
+	// executed without cache
+	server.Close()
+	users := make([]*cacheUser, 0)
+	assert.Nil(t, db.Scopes(QueryCache).Find(&users).Error)
+	assert.Len(t, users, 1)
+}
+
+func TestCache_Invalidate(t *testing.T) {
+	db, _, _ := newCacheDB(t, &CacheConfig{})
+	cache := db.Config.Plugins[(&Cache{}).Name()].(*Cache)
+	assert.Nil(t, db.Create(&cacheUser{ID: 1, Name: "ut"}).Error)
+	ctx := WithQueryCache(context.TODO())
+
+	users := make([]*cacheUser, 0)
+	assert.Nil(t, db.WithContext(ctx).Find(&users).Error)
+
+	// written with Exec and invalidated manually
+	assert.Nil(t, db.Exec("UPDATE cache_users SET name = ?", "raw").Error)
+	assert.Nil(t, cache.Invalidate(ctx, "cache_users"))
+	users = make([]*cacheUser, 0)
+	assert.Nil(t, db.WithContext(ctx).Find(&users).Error)
+	assert.Equal(t, "raw", users[0].Name)
+}
+
+func TestCache_Transaction(t *testing.T) {
+	db, server, _ := newCacheDB(t, &CacheConfig{})
+	ctx := WithQueryCache(context.TODO())
+	version := func() string {
+		res, _ := server.Get("rk:gorm::cache_users:version")
+		return res
+	}
+
+	// sql.DB is still accessible with wrapped pool
+	sqlDB, err := db.DB()
+	assert.Nil(t, err)
+	assert.NotNil(t, sqlDB)
+
+	// version is increased in transaction and again after commit
+	assert.Nil(t, db.Transaction(func(tx *gorm.DB) error {
+		assert.Nil(t, tx.Create(&cacheUser{ID: 1, Name: "ut"}).Error)
+		assert.Equal(t, "1", version())
+		return nil
+	}))
+	assert.Equal(t, "2", version())
+
+	// invalidated after default transaction of create committed
+	assert.Nil(t, db.Create(&cacheUser{ID: 2, Name: "ut"}).Error)
+	assert.Equal(t, "3", version())
+
+	// results read in transaction are not served after rollback
+	assert.NotNil(t, db.Transaction(func(tx *gorm.DB) error {
+		assert.Nil(t, tx.Create(&cacheUser{ID: 3, Name: "ut"}).Error)
+		users := make([]*cacheUser, 0)
+		assert.Nil(t, tx.WithContext(ctx).Find(&users).Error)
+		assert.Len(t, users, 3)
+		return errors.New("rollback")
+	}))
+	assert.Equal(t, "5", version())
+
+	users := make([]*cacheUser, 0)
+	assert.Nil(t, db.WithContext(ctx).Find(&users).Error)
+	assert.Len(t, users, 2)
+}
+
+type uncacheableUser struct {
+	ID       uint `gorm:"primaryKey"`
+	Name     string
+	Password string `json:"-"`
+}
+
+func TestIsCacheable(t *testing.T) {
+	type embedded struct {
+		Name string
+	}
+	type node struct {
+		embedded
+		Children  []*node
+		CreatedAt time.Time
+		DeletedAt gorm.DeletedAt
+		Scores    map[string]int
+	}
+
+	assert.True(t, isCacheable(reflect.TypeOf(&[]*cacheUser{})))
+	assert.True(t, isCacheable(reflect.TypeOf(&node{})))
+	assert.True(t, isCacheable(reflect.TypeOf(new(int64))))
+
+	assert.False(t, isCacheable(nil))
+	assert.False(t, isCacheable(reflect.TypeOf(&[]*uncacheableUser{})))
+	assert.False(t, isCacheable(reflect.TypeOf(&map[string]interface{}{})))
+	assert.False(t, isCacheable(reflect.TypeOf(&struct{ name string }{})))
+	assert.False(t, isCacheable(reflect.TypeOf(&struct{ Value interface{} }{})))
+}
+
+func TestCache_QueryWithUncacheableDest(t *testing.T) {
+	db, server, _ := newCacheDB(t, &CacheConfig{})
+	assert.Nil(t, db.Create(&cacheUser{ID: 1, Name: "ut"}).Error)
+	ctx := WithQueryCache(context.TODO())
+
+	// fields ignored by JSON would be lost
+	user := &uncacheableUser{}
+	assert.Nil(t, db.WithContext(ctx).Table("cache_users").First(user).Error)
+	assert.Equal(t, []string{"rk:gorm::cache_users:version"}, server.Keys())
+
+	// numbers would be decoded as float64
+	res := make(map[string]interface{})
+	assert.Nil(t, db.WithContext(ctx).Table("cache_users").Where("id = ?", 1).Take(&res).Error)
+	assert.Equal(t, []string{"rk:gorm::cache_users:version"}, server.Keys())
+	assert.Equal(t, int64(1), res["id"])
+}
+
+type cacheOrder struct {
+	ID     uint `gorm:"primaryKey"`
+	UserID uint
+	Item   string
+}
+
+func TestCache_QueryWithJoins(t *testing.T) {
+	db, server, prom := newCacheDB(t, &CacheConfig{})
+	assert.Nil(t, db.AutoMigrate(&cacheOrder{}))
+	assert.Nil(t, db.Create(&cacheUser{ID: 1, Name: "ut"}).Error)
+	ctx := WithQueryCache(context.TODO())
+	miss := prom.MetricsSet.GetCounterWithValues("cacheMiss", t.Name(), "", "cache_users", "query")
+
+	query := func() []*cacheUser {
+		users := make([]*cacheUser, 0)
+		assert.Nil(t, db.WithContext(ctx).
+			Joins("JOIN cache_orders ON cache_orders.user_id = cache_users.id").
+			Where("cache_orders.item = ?", "book").Find(&users).Error)
+		return users
+	}
+	assert.Empty(t, query())
+
+	// joined table is written, the next read must not be served by cache
+	assert.Nil(t, db.Create(&cacheOrder{ID: 1, UserID: 1, Item: "book"}).Error)
+	assert.Len(t, query(), 1)
+
+	assert.Nil(t, db.Model(&cacheOrder{}).Where("id = ?", 1).Update("item", "pen").Error)
+	assert.Empty(t, query())
+
+	// not cached at all
+	assert.Zero(t, testutil.ToFloat64(miss))
+	for _, key := range server.Keys() {
+		assert.Contains(t, key, ":version")
+	}
+}
@@ -59,7 +59,8 @@ type BootSqlServerE struct {
 		DryRun     bool     `yaml:"dryRun" json:"dryRun"`
 		AutoCreate bool     `yaml:"autoCreate" json:"autoCreate"`
 		Plugins    struct {
-			Prom plugins.PromConfig `yaml:"prom"`
+			Prom  plugins.PromConfig  `yaml:"prom"`
+			Cache plugins.CacheConfig `yaml:"cache"`
 		} `yaml:"plugins" json:"plugins"`
 	} `yaml:"database" json:"database"`
 	Logger struct {
@@ -289,6 +290,16 @@ func RegisterSqlServerEntryYAML(raw []byte) map[string]rkentry.Entry {
 				prom := plugins.NewProm(&db.Plugins.Prom)
 				opts = append(opts, WithPlugin(db.Name, prom))
 			}
+			if db.Plugins.Cache.Enabled {
+				if len(db.Plugins.Cache.RedisEntry) < 1 {
+					rkentry.ShutdownWithError(fmt.Errorf("redisEntry of cache plugin is required, database:%s", db.Name))
+				}
+				db.Plugins.Cache.DbAddr = element.Addr
+				db.Plugins.Cache.DbName = db.Name
+				db.Plugins.Cache.DbType = "sqlserver"
+				cache := plugins.NewCache(&db.Plugins.Cache)
+				opts = append(opts, WithPlugin(db.Name, cache))
+			}
 		}
 
 		entry := RegisterSqlServerEntry(opts...)
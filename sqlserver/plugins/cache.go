@@ -0,0 +1,512 @@
+package plugins
+
+import (
+	"context"
+	"crypto/sha1"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/redis/go-redis/v9"
+	"github.com/rookie-ninja/rk-entry/v2/entry"
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+	"gorm.io/gorm/clause"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	cacheEnabledKey = "rk-cache"
+	redisEntryType  = "RedisEntry"
+	defaultCacheTTL = time.Minute
+)
+
+type cacheContextKey struct{}
+
+// WithQueryCache returns context which enables caching of queries executed with it,
+// like db.WithContext(plugins.WithQueryCache(ctx)).Find(&users)
+func WithQueryCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, cacheContextKey{}, true)
+}
+
+// QueryCache is a scope which enables caching of query, like db.Scopes(plugins.QueryCache).Find(&users)
+func QueryCache(db *gorm.DB) *gorm.DB {
+	return db.Set(cacheEnabledKey, true)
+}
+
+type CacheTableConfig struct {
+	Name  string `yaml:"name" json:"name"`
+	TtlMs int    `yaml:"ttlMs" json:"ttlMs"`
+}
+
+type CacheConfig struct {
+	Enabled    bool                  `yaml:"enabled" json:"enabled"`
+	RedisEntry string                `yaml:"redisEntry" json:"redisEntry"`
+	Prefix     string                `yaml:"prefix" json:"prefix"`
+	TtlMs      int                   `yaml:"ttlMs" json:"ttlMs"`
+	Tables     []*CacheTableConfig   `yaml:"tables" json:"tables"`
+	Client     redis.UniversalClient `yaml:"-" json:"-"`
+	DbAddr     string                `yaml:"-" json:"-"`
+	DbName     string                `yaml:"-" json:"-"`
+	DbType     string                `yaml:"-" json:"-"`
+}
+
+// redisClientProvider is implemented by RedisEntry
+type redisClientProvider interface {
+	GetUniversalClient() redis.UniversalClient
+}
+
+// cachedResult is the value of cached query
+type cachedResult struct {
+	Dest         json.RawMessage `json:"dest"`
+	RowsAffected int64           `json:"rowsAffected"`
+}
+
+// NewCache creates plugin which caches results of queries in RedisEntry.
+//
+// Caching is enabled per query with WithQueryCache or QueryCache, key of result is composed of table,
+// version of table and normalized SQL with vars. Version of table is increased by create, update and delete,
+// so that cached results of the table are invalidated, and increased again after commit or rollback if written
+// in transaction.
+// Queries are executed without cache if redis is unavailable.
+//
+// Results are stored as JSON, queries whose destination could not survive JSON round trip are not cached,
+// like map[string]interface{} or struct with unexported fields or fields tagged with json:"-".
+// Queries with joins are not cached either, since only version of table of statement is tracked.
+//
+// Writes executed with Exec or Raw are never invalidated, call Invalidate with tables written by them.
+func NewCache(conf *CacheConfig) *Cache {
+	// copy config, since it may be reused by caller for other databases
+	copied := *conf
+
+	res := &Cache{
+		Conf:   &copied,
+		prefix: conf.Prefix,
+		ttl:    time.Duration(conf.TtlMs) * time.Millisecond,
+		ttls:   make(map[string]time.Duration),
+	}
+
+	if len(res.prefix) < 1 {
+		res.prefix = "rk:gorm:" + conf.DbName + ":"
+	}
+
+	if res.ttl <= 0 {
+		res.ttl = defaultCacheTTL
+	}
+
+	for _, table := range conf.Tables {
+		if table != nil && len(table.Name) > 0 && table.TtlMs > 0 {
+			res.ttls[table.Name] = time.Duration(table.TtlMs) * time.Millisecond
+		}
+	}
+
+	return res
+}
+
+type Cache struct {
+	Conf   *CacheConfig
+	prefix string
+	ttl    time.Duration
+	ttls   map[string]time.Duration
+	query  func(db *gorm.DB)
+}
+
+func (c *Cache) Name() string {
+	return "rk-cache-plugin"
+}
+
+func (c *Cache) Initialize(db *gorm.DB) error {
+	// begin transactions with wrapped pool, so that tables written in transaction are invalidated after commit or rollback
+	pool := &cacheConnPool{ConnPool: db.ConnPool, cache: c}
+	db.ConnPool = pool
+	db.Statement.ConnPool = pool
+
+	// query
+	c.query = db.Callback().Query().Get("gorm:query")
+	if c.query == nil {
+		return errors.New("callback gorm:query not found")
+	}
+	if err := db.Callback().Query().Replace("gorm:query", c.queryWithCache); err != nil {
+		return err
+	}
+
+	// create
+	if err := db.Callback().Create().After("gorm:create").Register(":invalidate_create", c.invalidate); err != nil {
+		return err
+	}
+
+	// update
+	if err := db.Callback().Update().After("gorm:update").Register(":invalidate_update", c.invalidate); err != nil {
+		return err
+	}
+
+	// delete
+	if err := db.Callback().Delete().After("gorm:delete").Register(":invalidate_delete", c.invalidate); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// TTL returns TTL of cached results of table
+func (c *Cache) TTL(table string) time.Duration {
+	if ttl, ok := c.ttls[table]; ok {
+		return ttl
+	}
+
+	return c.ttl
+}
+
+func (c *Cache) queryWithCache(db *gorm.DB) {
+	client := c.getClient()
+	if db.Error != nil || db.DryRun || len(db.Statement.Table) < 1 || client == nil || !c.isEnabled(db) ||
+		hasJoins(db.Statement) || !isCacheable(reflect.TypeOf(db.Statement.Dest)) {
+		c.query(db)
+		return
+	}
+
+	callbacks.BuildQuerySQL(db)
+	if db.Error != nil {
+		return
+	}
+
+	ctx := db.Statement.Context
+	table := db.Statement.Table
+
+	version, err := client.Get(ctx, c.versionKey(table)).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		c.query(db)
+		return
+	}
+
+	key := c.queryKey(table, version, db.Statement.SQL.String(), db.Statement.Vars)
+	if c.load(ctx, client, key, db) {
+		c.count(db, "cacheHit")
+		return
+	}
+	c.count(db, "cacheMiss")
+
+	c.query(db)
+	if db.Error != nil {
+		return
+	}
+
+	dest, err := json.Marshal(db.Statement.Dest)
+	if err != nil {
+		return
+	}
+
+	if data, err := json.Marshal(&cachedResult{Dest: dest, RowsAffected: db.RowsAffected}); err == nil {
+		client.Set(ctx, key, data, c.TTL(table))
+	}
+}
+
+// load decodes cached result into destination of statement, false would be returned if missing
+func (c *Cache) load(ctx context.Context, client redis.UniversalClient, key string, db *gorm.DB) bool {
+	data, err := client.Get(ctx, key).Bytes()
+	if err != nil {
+		return false
+	}
+
+	res := &cachedResult{}
+	if err := json.Unmarshal(data, res); err != nil {
+		return false
+	}
+
+	if err := json.Unmarshal(res.Dest, db.Statement.Dest); err != nil {
+		return false
+	}
+
+	db.RowsAffected = res.RowsAffected
+
+	return true
+}
+
+// Invalidate increases versions of tables, which should be called after tables written with Exec or Raw
+func (c *Cache) Invalidate(ctx context.Context, tables ...string) error {
+	client := c.getClient()
+	if client == nil {
+		return errors.New("redis client of cache plugin is not available")
+	}
+
+	for i := range tables {
+		if err := client.Incr(ctx, c.versionKey(tables[i])).Err(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// invalidate increases version of table, cached results of previous version would be expired by TTL.
+// Table written in transaction is invalidated again after commit or rollback, since results read before
+// that may be cached with the new version.
+//
+// RowsAffected is not checked, since it is always 0 for some dialects like mutations of clickhouse.
+func (c *Cache) invalidate(db *gorm.DB) {
+	if db.Error != nil || db.DryRun || len(db.Statement.Table) < 1 {
+		return
+	}
+
+	c.Invalidate(db.Statement.Context, db.Statement.Table)
+
+	if tx, ok := db.Statement.ConnPool.(*cacheTx); ok {
+		tx.add(db.Statement.Table)
+	}
+}
+
+func (c *Cache) isEnabled(db *gorm.DB) bool {
+	if v, ok := db.Get(cacheEnabledKey); ok {
+		enabled, _ := v.(bool)
+		return enabled
+	}
+
+	if db.Statement.Context != nil {
+		enabled, _ := db.Statement.Context.Value(cacheContextKey{}).(bool)
+		return enabled
+	}
+
+	return false
+}
+
+func (c *Cache) getClient() redis.UniversalClient {
+	if c.Conf.Client != nil {
+		return c.Conf.Client
+	}
+
+	if v := rkentry.GlobalAppCtx.GetEntry(redisEntryType, c.Conf.RedisEntry); v != nil {
+		if provider, ok := v.(redisClientProvider); ok {
+			return provider.GetUniversalClient()
+		}
+	}
+
+	return nil
+}
+
+// count increases counter of prom plugin if exists
+func (c *Cache) count(db *gorm.DB, name string) {
+	prom, ok := db.Plugins[promPluginName].(*Prom)
+	if !ok {
+		return
+	}
+
+	if counter := prom.MetricsSet.GetCounter(name); counter != nil {
+		if c, err := counter.GetMetricWithLabelValues(prom.Conf.DbName, prom.Conf.DbAddr, db.Statement.Table, "query"); err == nil {
+			c.Inc()
+		}
+	}
+}
+
+func (c *Cache) versionKey(table string) string {
+	return c.prefix + table + ":version"
+}
+
+// queryKey returns key of query with SQL whose spaces are normalized and vars
+func (c *Cache) queryKey(table, version, sql string, vars []interface{}) string {
+	if len(version) < 1 {
+		version = "0"
+	}
+
+	hash := sha1.New()
+	hash.Write([]byte(strings.Join(strings.Fields(sql), " ")))
+	// vars may be nil or empty for the same SQL
+	if len(vars) > 0 {
+		if data, err := json.Marshal(vars); err == nil {
+			hash.Write(data)
+		}
+	}
+
+	return c.prefix + table + ":" + version + ":" + hex.EncodeToString(hash.Sum(nil))
+}
+
+// cacheConnPool wraps gorm.ConnPool, tables written in transactions begun by it are invalidated after commit or rollback
+type cacheConnPool struct {
+	gorm.ConnPool
+	cache *Cache
+}
+
+func (p *cacheConnPool) BeginTx(ctx context.Context, opts *sql.TxOptions) (gorm.ConnPool, error) {
+	var tx gorm.ConnPool
+
+	switch beginner := p.ConnPool.(type) {
+	case gorm.TxBeginner:
+		sqlTx, err := beginner.BeginTx(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		tx = sqlTx
+	case gorm.ConnPoolBeginner:
+		poolTx, err := beginner.BeginTx(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		tx = poolTx
+	default:
+		return nil, gorm.ErrInvalidTransaction
+	}
+
+	return &cacheTx{ConnPool: tx, cache: p.cache, tables: make(map[string]bool)}, nil
+}
+
+// GetDBConn returns *sql.DB of wrapped pool, which is used by gorm.DB.DB()
+func (p *cacheConnPool) GetDBConn() (*sql.DB, error) {
+	if connector, ok := p.ConnPool.(gorm.GetDBConnector); ok && connector != nil {
+		return connector.GetDBConn()
+	}
+
+	if sqlDB, ok := p.ConnPool.(*sql.DB); ok {
+		return sqlDB, nil
+	}
+
+	return nil, gorm.ErrInvalidDB
+}
+
+// cacheTx wraps transaction and records tables written in it
+type cacheTx struct {
+	gorm.ConnPool
+	cache  *Cache
+	tables map[string]bool
+	mutex  sync.Mutex
+}
+
+func (tx *cacheTx) add(table string) {
+	tx.mutex.Lock()
+	defer tx.mutex.Unlock()
+	tx.tables[table] = true
+}
+
+func (tx *cacheTx) Commit() error {
+	committer, ok := tx.ConnPool.(gorm.TxCommitter)
+	if !ok {
+		return gorm.ErrInvalidTransaction
+	}
+
+	err := committer.Commit()
+	tx.invalidate()
+
+	return err
+}
+
+func (tx *cacheTx) Rollback() error {
+	committer, ok := tx.ConnPool.(gorm.TxCommitter)
+	if !ok {
+		return gorm.ErrInvalidTransaction
+	}
+
+	err := committer.Rollback()
+	tx.invalidate()
+
+	return err
+}
+
+// invalidate increases versions of tables written in transaction, since results read in transaction
+// may be cached with version increased in transaction
+func (tx *cacheTx) invalidate() {
+	tx.mutex.Lock()
+	tables := make([]string, 0, len(tx.tables))
+	for table := range tx.tables {
+		tables = append(tables, table)
+	}
+	tx.tables = make(map[string]bool)
+	tx.mutex.Unlock()
+
+	if len(tables) > 0 {
+		tx.cache.Invalidate(context.Background(), tables...)
+	}
+}
+
+// StmtContext is required by gorm.Tx for prepared statements
+func (tx *cacheTx) StmtContext(ctx context.Context, stmt *sql.Stmt) *sql.Stmt {
+	if inner, ok := tx.ConnPool.(interface {
+		StmtContext(ctx context.Context, stmt *sql.Stmt) *sql.Stmt
+	}); ok {
+		return inner.StmtContext(ctx, stmt)
+	}
+
+	return stmt
+}
+
+// hasJoins checks whether statement reads other tables with Joins or join clause
+func hasJoins(stmt *gorm.Statement) bool {
+	if len(stmt.Joins) > 0 {
+		return true
+	}
+
+	if c, ok := stmt.Clauses["FROM"]; ok {
+		if from, ok := c.Expression.(clause.From); ok && len(from.Joins) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+var (
+	cacheableTypes      sync.Map
+	jsonMarshalerType   = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+)
+
+// isCacheable checks whether value of type survives JSON round trip
+func isCacheable(t reflect.Type) bool {
+	if t == nil {
+		return false
+	}
+
+	if v, ok := cacheableTypes.Load(t); ok {
+		return v.(bool)
+	}
+
+	res := checkCacheable(t, make(map[reflect.Type]bool))
+	cacheableTypes.Store(t, res)
+
+	return res
+}
+
+func checkCacheable(t reflect.Type, visited map[reflect.Type]bool) bool {
+	// types encoded by themselves, like time.Time
+	if t.Implements(jsonMarshalerType) && reflect.PtrTo(t).Implements(jsonUnmarshalerType) {
+		return true
+	}
+
+	// recursive types, like associations
+	if visited[t] {
+		return true
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		return checkCacheable(t.Elem(), visited)
+	case reflect.Map:
+		switch t.Key().Kind() {
+		case reflect.String, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return checkCacheable(t.Elem(), visited)
+		}
+		return false
+	case reflect.Struct:
+		visited[t] = true
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.Tag.Get("json") == "-" {
+				return false
+			}
+			// exported fields of embedded struct are encoded even if struct is unexported
+			if len(field.PkgPath) > 0 && !(field.Anonymous && field.Type.Kind() == reflect.Struct) {
+				return false
+			}
+			if !checkCacheable(field.Type, visited) {
+				return false
+			}
+		}
+		return true
+	case reflect.Interface, reflect.Func, reflect.Chan, reflect.Complex64, reflect.Complex128, reflect.UnsafePointer:
+		// numbers in interface are decoded as float64
+		return false
+	}
+
+	return true
+}
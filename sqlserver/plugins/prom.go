@@ -29,12 +29,16 @@ func NewProm(conf *PromConfig) *Prom {
 	res.MetricsSet.RegisterCounter("rowsAffected", res.LabelKeys...)
 	res.MetricsSet.RegisterCounter("error", res.LabelKeys...)
 	res.MetricsSet.RegisterSummary("elapsedNano", rkmidprom.SummaryObjectives, res.LabelKeys...)
+	// hit and miss of cache plugin
+	res.MetricsSet.RegisterCounter("cacheHit", res.LabelKeys...)
+	res.MetricsSet.RegisterCounter("cacheMiss", res.LabelKeys...)
 
 	return res
 }
 
 const (
-	startTimeKey = "rk-startTime"
+	startTimeKey   = "rk-startTime"
+	promPluginName = "rk-prom-plugin"
 )
 
 type PromConfig struct {
@@ -51,7 +55,7 @@ type Prom struct {
 }
 
 func (p *Prom) Name() string {
-	return "rk-prom-plugin"
+	return promPluginName
 }
 
 func (p *Prom) before() func(db *gorm.DB) {